@@ -0,0 +1,88 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"invoice-agent/pkg/util"
+)
+
+// 事件流类型，与会话或任务ID组成事件流的 key
+const (
+	SSEKindChat    = "chat"
+	SSEKindParse   = "parse"
+	SSEKindFilling = "filling"
+)
+
+// sseWriter 把事件流挂到 gin 的 ResponseWriter 上，经 util.WriteSSE 写出的事件都会带ID并缓存
+type sseWriter struct {
+	gin.ResponseWriter
+	stream *util.SSEStream
+}
+
+func (w *sseWriter) SSEStream() *util.SSEStream {
+	return w.stream
+}
+
+// SSEStreamKey 事件流的 key
+func SSEStreamKey(kind, id string) string {
+	return kind + ":" + id
+}
+
+func setSSEHeader(ctx *gin.Context) {
+	ctx.Header("Content-Type", "text/event-stream; charset=utf-8")
+	ctx.Header("Cache-Control", "no-cache")
+	ctx.Header("Connection", "keep-alive")
+}
+
+// StartSSE 设置流式输出响应头并打开可补发的事件流，返回的函数在处理结束时调用以结束事件流。
+// id 为空时无法重连，只输出不缓存
+func StartSSE(ctx *gin.Context, kind, id string) func() {
+	setSSEHeader(ctx)
+	if id == "" {
+		return func() {}
+	}
+	stream := util.OpenSSEStream(SSEStreamKey(kind, id))
+	ctx.Writer = &sseWriter{ResponseWriter: ctx.Writer, stream: stream}
+	return stream.Close
+}
+
+// ResumeSSE 客户端携带 Last-Event-ID 重连时，补发错过的事件并继续转发直到事件流结束。
+// 返回 false 表示不是重连请求或事件流已不存在，由调用方按新请求处理
+func ResumeSSE(ctx *gin.Context, kind, id string) bool {
+	lastID, err := strconv.ParseUint(ctx.GetHeader("Last-Event-ID"), 10, 64)
+	if err != nil || id == "" {
+		return false
+	}
+	stream, ok := util.GetSSEStream(SSEStreamKey(kind, id))
+	if !ok {
+		return false
+	}
+	setSSEHeader(ctx)
+	stream.Replay(ctx.Writer, lastID, ctx.Request.Context().Done())
+	return true
+}
+
+// ReplaySSE 按 kind/id 重新订阅事件流，Last-Event-ID 请求头或 last_event_id 参数为空时从头补发
+func ReplaySSE(ctx *gin.Context) {
+	kind, id := ctx.Param("kind"), ctx.Param("id")
+	lastEventID := ctx.GetHeader("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = ctx.DefaultQuery("last_event_id", "0")
+	}
+	lastID, err := strconv.ParseUint(lastEventID, 10, 64)
+	if err != nil {
+		Response(ctx, http.StatusBadRequest, "参数错误", "invalid last event id")
+		return
+	}
+	stream, ok := util.GetSSEStream(SSEStreamKey(kind, id))
+	if !ok {
+		Response(ctx, http.StatusNotFound, "事件流不存在或已过期", nil)
+		return
+	}
+
+	setSSEHeader(ctx)
+	stream.Replay(ctx.Writer, lastID, ctx.Request.Context().Done())
+}
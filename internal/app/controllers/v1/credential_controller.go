@@ -0,0 +1,93 @@
+package v1
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"invoice-agent/internal/app/controllers"
+	"invoice-agent/internal/app/models"
+	"invoice-agent/internal/app/services"
+)
+
+type CredentialController struct {
+	service services.ICredential
+}
+
+func NewCredentialController(service services.ICredential) *CredentialController {
+	return &CredentialController{service: service}
+}
+
+// SetCredential 设置OA账号和密码
+func (c *CredentialController) SetCredential(ctx *gin.Context) {
+	var req models.CredentialRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		controllers.Response(ctx, http.StatusBadRequest, "参数错误", err)
+		return
+	}
+
+	credential, err := c.service.SetCredential(req.UserId, req.Username, req.Password)
+	if err != nil {
+		controllers.Response(ctx, http.StatusInternalServerError, "设置OA账号失败", err.Error())
+		return
+	}
+
+	controllers.Response(ctx, http.StatusOK, "设置成功", credential)
+}
+
+// RotateCredential 更换OA密码
+func (c *CredentialController) RotateCredential(ctx *gin.Context) {
+	var req models.CredentialRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		controllers.Response(ctx, http.StatusBadRequest, "参数错误", err)
+		return
+	}
+
+	credential, err := c.service.RotateCredential(req.UserId, req.Password)
+	if err != nil {
+		controllers.Response(ctx, credentialErrorCode(err), "更换OA密码失败", err.Error())
+		return
+	}
+
+	controllers.Response(ctx, http.StatusOK, "更换成功", credential)
+}
+
+// TestCredential 使用保存的OA账号尝试登录
+func (c *CredentialController) TestCredential(ctx *gin.Context) {
+	var req models.CredentialRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		controllers.Response(ctx, http.StatusBadRequest, "参数错误", err)
+		return
+	}
+
+	credential, err := c.service.TestCredential(req.UserId)
+	if err != nil {
+		if credential != nil {
+			controllers.Response(ctx, http.StatusOK, "登录失败", credential)
+			return
+		}
+		controllers.Response(ctx, credentialErrorCode(err), "测试OA账号失败", err.Error())
+		return
+	}
+
+	controllers.Response(ctx, http.StatusOK, "登录成功", credential)
+}
+
+// GetCredential 获取OA账号信息，不返回密码
+func (c *CredentialController) GetCredential(ctx *gin.Context) {
+	credential, err := c.service.GetCredentialInfo(ctx.Param("user_id"))
+	if err != nil {
+		controllers.Response(ctx, credentialErrorCode(err), "获取OA账号失败", err.Error())
+		return
+	}
+
+	controllers.Response(ctx, http.StatusOK, "获取成功", credential)
+}
+
+func credentialErrorCode(err error) int {
+	if errors.Is(err, services.ErrCredentialNotFound) {
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
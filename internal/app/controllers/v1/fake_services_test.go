@@ -0,0 +1,201 @@
+package v1
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"invoice-agent/internal/app/models"
+	"invoice-agent/internal/app/services"
+	"invoice-agent/internal/pkg/llmfixture"
+	"invoice-agent/pkg/config"
+)
+
+// 模型服务的录制文件目录；设置 LLM_FIXTURE_MODE=record 并在 conf/dev/openai.yaml 配置可用的 apikey 后重新录制
+const fixtureDir = "testdata/llm"
+
+// TestMain 在仓库根目录加载 dev 配置，模型服务使用录制文件回放，不访问网络
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	dir, err := filepath.Abs(fixtureDir)
+	if err != nil {
+		panic(err)
+	}
+	if err := os.Chdir(filepath.Join("..", "..", "..", "..")); err != nil {
+		panic(err)
+	}
+	config.Init("dev")
+
+	conf := config.GetOpenaiConf()
+	conf.Provider = services.ProviderDashScope
+	conf.FixtureMode = llmfixture.ModeReplay
+	if mode := os.Getenv("LLM_FIXTURE_MODE"); mode != "" {
+		conf.FixtureMode = mode
+	}
+	conf.FixtureDir = dir
+	services.ChatClient = services.NewChatProvider(conf)
+	os.Exit(m.Run())
+}
+
+// fakeInvoiceFiles 内存中的票据，未实现的方法调用时 panic
+type fakeInvoiceFiles struct {
+	services.IInvoiceFile
+	files   map[string]*models.InvoiceFile
+	session []models.InvoiceFile // PairItineraries 返回的报销单票据
+
+	corrected  *models.InvoiceFile // CorrectInvoiceFile 收到的修正内容
+	zeroFields []string
+}
+
+func newFakeInvoiceFiles(files ...models.InvoiceFile) *fakeInvoiceFiles {
+	f := &fakeInvoiceFiles{files: make(map[string]*models.InvoiceFile), session: files}
+	for i := range files {
+		file := files[i]
+		f.files[file.FileID] = &file
+	}
+	return f
+}
+
+func (f *fakeInvoiceFiles) GetInvoiceFileByFileID(fileID string) (*models.InvoiceFile, error) {
+	file, ok := f.files[fileID]
+	if !ok {
+		return nil, fmt.Errorf("票据不存在: %s", fileID)
+	}
+	copied := *file
+	return &copied, nil
+}
+
+func (f *fakeInvoiceFiles) UpdateInvoiceFileByFileId(fileId string, invoiceFile *models.InvoiceFile) error {
+	updated := *invoiceFile
+	f.files[fileId] = &updated
+	return nil
+}
+
+func (f *fakeInvoiceFiles) CorrectInvoiceFile(id uint64, correction *models.InvoiceFile, zeroFields ...string) (*models.InvoiceFile, error) {
+	f.corrected = correction
+	f.zeroFields = zeroFields
+	return correction, nil
+}
+
+func (f *fakeInvoiceFiles) CheckDuplicate(fileId string) (*models.InvoiceFile, error) {
+	return f.GetInvoiceFileByFileID(fileId)
+}
+
+func (f *fakeInvoiceFiles) PairItineraries(sessionId string) ([]models.InvoiceFile, error) {
+	return f.session, nil
+}
+
+// fakeReimbursement 记录报销单状态的推进和确认
+type fakeReimbursement struct {
+	services.IReimbursement
+	advanced   []models.ReimbursementStatus
+	confirmed  int
+	confirmErr error
+}
+
+func (f *fakeReimbursement) Advance(sessionId string, to models.ReimbursementStatus, message string) {
+	f.advanced = append(f.advanced, to)
+}
+
+func (f *fakeReimbursement) ConfirmFilling(sessionId string, req *models.AutoFillingRequest) error {
+	f.confirmed++
+	return f.confirmErr
+}
+
+// fakeChatHistory 内存中的对话记录
+type fakeChatHistory struct {
+	services.IChatHistory
+	messages []models.ChatMessage
+}
+
+func (f *fakeChatHistory) AddMessage(sessionId, userId string, role models.ChatRole, content string, usage *models.TokenUsage) error {
+	message := models.ChatMessage{SessionId: sessionId, UserId: userId, Role: role, Content: content}
+	if usage != nil {
+		message.TotalTokens = usage.TotalTokens
+	}
+	f.messages = append(f.messages, message)
+	return nil
+}
+
+func (f *fakeChatHistory) History(sessionId string, limit int) ([]models.ChatMessage, error) {
+	return nil, nil
+}
+
+// fakeSlotFilling 内存中的报销信息，不识别用户输入
+type fakeSlotFilling struct {
+	services.ISlotFilling
+	state  *models.SlotState
+	setErr error // SetSlots 校验失败时返回的错误
+}
+
+func (f *fakeSlotFilling) Update(sessionId, input string) (*models.SlotState, models.MissingSlotsEvent, error) {
+	return f.state, models.MissingSlotsEvent{}, nil
+}
+
+func (f *fakeSlotFilling) SetSlots(sessionId string, values map[string]string) (*models.SlotState, models.MissingSlotsEvent, error) {
+	if f.setErr != nil {
+		return nil, models.MissingSlotsEvent{}, f.setErr
+	}
+	for key, value := range values {
+		f.state.Set(key, value)
+	}
+	return f.state, models.MissingSlotsEvent{Complete: true}, nil
+}
+
+func (f *fakeSlotFilling) FillingRequest(sessionId string) (*models.AutoFillingRequest, models.MissingSlotsEvent, error) {
+	return &models.AutoFillingRequest{SessionId: sessionId, BasicInfo: f.state.BasicInfo, PayInfo: f.state.PayInfo},
+		models.MissingSlotsEvent{Complete: true}, nil
+}
+
+// fakeCredential 固定的OA账号
+type fakeCredential struct {
+	services.ICredential
+}
+
+func (f *fakeCredential) GetCredential(userId string) (string, string, error) {
+	return "oa-user", "oa-password", nil
+}
+
+// serveSSE 调用流式接口，返回拼接后的 append-text 内容以及是否以 [DONE] 结束
+func serveSSE(t *testing.T, handler gin.HandlerFunc, body interface{}) (string, bool) {
+	t.Helper()
+	data, err := json.Marshal(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	engine := gin.New()
+	engine.POST("/", handler)
+	recorder := httptest.NewRecorder()
+	engine.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(data)))
+
+	var text strings.Builder
+	done := false
+	for _, event := range strings.Split(recorder.Body.String(), "\n\n") {
+		for _, line := range strings.Split(event, "\n") {
+			payload, ok := strings.CutPrefix(line, "data: ")
+			if !ok {
+				continue
+			}
+			if payload == "[DONE]" {
+				done = true
+				continue
+			}
+			var e struct {
+				Type string `json:"type"`
+				Text string `json:"text"`
+			}
+			if json.Unmarshal([]byte(payload), &e) == nil && e.Type == "append-text" {
+				text.WriteString(e.Text)
+			}
+		}
+	}
+	return text.String(), done
+}
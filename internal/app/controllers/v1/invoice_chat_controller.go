@@ -2,23 +2,26 @@ package v1
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
 	log "github.com/sirupsen/logrus"
 	"invoice-agent/internal/app/controllers"
 	"invoice-agent/internal/app/models"
 	"invoice-agent/internal/app/services"
+	"invoice-agent/pkg/config"
 	"invoice-agent/pkg/util"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 )
 
 type InvoiceChatController struct {
-	service *services.QwenLongClient
+	service services.ChatProvider
 }
 
-func NewInvoiceChatController(service *services.QwenLongClient) *InvoiceChatController {
+func NewInvoiceChatController(service services.ChatProvider) *InvoiceChatController {
 	return &InvoiceChatController{service: service}
 }
 
@@ -34,67 +37,212 @@ func (c *InvoiceChatController) Chat(ctx *gin.Context) {
 	log.Infoln("====== request input: : ", req.Input)
 	log.Infoln("====== request history: ", req.History)
 
-	// 设置响应头支持流式输出
-	ctx.Header("Content-Type", "text/event-stream; charset=utf-8")
-	ctx.Header("Cache-Control", "no-cache")
-	ctx.Header("Connection", "keep-alive")
-
-	contentChan, errorChan := services.ChatClient.ChatStream(ctx, req)
+	// 断线重连时补发事件，否则开始新的流式输出
+	if controllers.ResumeSSE(ctx, controllers.SSEKindChat, req.SessionId) {
+		return
+	}
+	finish := controllers.StartSSE(ctx, controllers.SSEKindChat, req.SessionId)
+	defer finish()
 
 	if req.Parse {
-		_ = util.WriteAppendText(ctx.Writer, "## 报销信息")
-		_ = util.WriteAppendText(ctx.Writer, "\n```json")
-		_ = util.WriteAppendText(ctx.Writer, "\n")
+		chat, reply, ok := c.slotFillingRequest(ctx, &req)
+		saveChatTurn(&req, reply)
+		if ok {
+			c.fillingStart(ctx, &req, &chat)
+		}
+		util.WriteDone(ctx.Writer)
+		return
+	}
+
+	// 报销信息由服务端按轮次更新。开启 keyword_reply 时，本轮提到报销信息字段（如“紧急”“预算”“付款”）
+	// 就直接回复确认表格，不调用模型；否则规则更新后仍由模型回复
+	state, event, err := services.SlotFilling.Update(req.SessionId, req.Input)
+	if err != nil {
+		_ = util.WriteAppendText(ctx.Writer, fmt.Sprintf("\nAI助手: 更新报销信息失败: %v", err))
+		util.WriteDone(ctx.Writer)
+		return
+	}
+	var reply string
+	var session *services.ToolSession
+	mentioned := len(event.Updated) > 0 || len(event.Invalid) > 0
+	if !mentioned || !config.GetSlotFilling().KeywordReply {
+		req.History = services.RenderSlotState(state) + invalidSlotsText(event.Invalid)
+		req.Messages, err = services.ChatHistory.History(req.SessionId, services.HistoryMessages())
+		if err != nil {
+			log.Warnf("获取对话历史失败, session_id: %s, err: %v", req.SessionId, err)
+		}
+		req.Usage = &models.TokenUsage{}
+		if caller, ok := c.service.(services.ToolCaller); ok && config.GetOpenaiConf().Tools {
+			session = &services.ToolSession{SessionId: req.SessionId, UserId: req.UserId}
+			reply, err = c.chatWithTools(ctx, caller, req, session)
+		} else {
+			reply, err = c.streamChat(ctx, req)
+		}
+		if err != nil {
+			log.Errorf("模型回复失败, session_id: %s, err: %v", req.SessionId, err)
+			reply = req.History
+			_ = util.WriteAppendText(ctx.Writer, "\n"+reply)
+		}
+	} else {
+		reply = services.RenderSlotState(state) + invalidSlotsText(event.Invalid)
+		_ = util.WriteAppendText(ctx.Writer, reply)
+	}
+
+	// 模型调用了 start_filling 时在回复后开始填报
+	var chat string
+	startFilling := false
+	if session != nil && session.StartFilling {
+		req.DryRun = session.DryRun
+		var fillingReply string
+		chat, fillingReply, startFilling = c.slotFillingRequest(ctx, &req)
+		reply += "\n" + fillingReply
+	}
+	saveChatTurn(&req, reply)
+	_ = util.WriteMissingSlots(ctx.Writer, event)
+	if startFilling {
+		c.fillingStart(ctx, &req, &chat)
+	}
+	util.WriteDone(ctx.Writer)
+}
+
+// chatWithTools 由模型调用工具后回复，调用工具时输出提示
+func (c *InvoiceChatController) chatWithTools(ctx *gin.Context, caller services.ToolCaller, req models.ChatRequest, session *services.ToolSession) (string, error) {
+	reply, err := caller.ChatWithTools(ctx, req, session, func(tool string) {
+		_ = util.WriteAppendText(ctx.Writer, fmt.Sprintf("> 🔧 %s...\n", services.ToolLabel(tool)))
+	})
+	if err != nil {
+		return "", err
 	}
+	_ = util.WriteAppendText(ctx.Writer, reply)
+	return reply, nil
+}
 
+// streamChat 流式输出模型的回复，返回完整内容
+func (c *InvoiceChatController) streamChat(ctx *gin.Context, req models.ChatRequest) (string, error) {
 	var fullContent strings.Builder
+	contentChan, errorChan := c.service.ChatStream(ctx, req)
 	for {
 		select {
 		case content, ok := <-contentChan:
 			if !ok {
-				// 流结束，开始解析数据
-				log.Info("===== 流结束，开始解析数据")
-				// 获取完整内容
-				contentStr := fullContent.String()
-				log.Infoln("提取的信息为：\n", contentStr)
-				_ = util.WriteAppendText(ctx.Writer, "\n```")
-				_ = util.WriteAppendText(ctx.Writer, "\n")
-				//所有信息收集完成，开始进行数据解析和填报发票单流程
-				if req.Parse {
-					c.fillingStart(ctx, &req, &contentStr)
-				}
-				//结束
-				util.WriteDone(ctx.Writer)
-				return
+				return fullContent.String(), nil
 			}
-			// 实时处理内容
-			fmt.Print(content)
 			fullContent.WriteString(content)
 			_ = util.WriteAppendText(ctx.Writer, content)
 		case err, ok := <-errorChan:
 			if ok && err != nil {
-				// 处理错误
-				fmt.Printf("Error: %v\n", err)
-				return
+				return fullContent.String(), err
 			}
+			errorChan = nil
 		}
 	}
-	//controllers.Response(ctx, http.StatusOK, "开始自动填开发票", *chat)
 }
 
-func (c *InvoiceChatController) StartFilling(ctx *gin.Context) {
-	// 设置响应头支持流式输出
-	ctx.Header("Content-Type", "text/event-stream; charset=utf-8")
-	ctx.Header("Cache-Control", "no-cache")
-	ctx.Header("Connection", "keep-alive")
+// saveChatTurn 保存本轮的用户输入和回复，模型回复时记录token用量
+func saveChatTurn(req *models.ChatRequest, reply string) {
+	if err := services.ChatHistory.AddMessage(req.SessionId, req.UserId, models.ChatRoleUser, req.Input, nil); err != nil {
+		log.Warnf("保存对话消息失败, session_id: %s, err: %v", req.SessionId, err)
+		return
+	}
+	if err := services.ChatHistory.AddMessage(req.SessionId, req.UserId, models.ChatRoleAssistant, reply, req.Usage); err != nil {
+		log.Warnf("保存对话消息失败, session_id: %s, err: %v", req.SessionId, err)
+	}
+}
+
+// invalidSlotsText 提示不在可选范围内的报销信息
+func invalidSlotsText(invalid []models.SlotItem) string {
+	var b strings.Builder
+	for _, item := range invalid {
+		b.WriteString(fmt.Sprintf("\n> ⚠️ %s「%s」不在可选范围内，请选择：%s\n",
+			item.Label, item.Value, strings.Join(item.Options, "、")))
+	}
+	return b.String()
+}
+
+// slotFillingRequest 由已收集的报销信息生成填报请求并输出，缺少字段时提示补充；
+// 返回填报请求JSON、输出的内容，以及是否可以开始填报
+func (c *InvoiceChatController) slotFillingRequest(ctx *gin.Context, req *models.ChatRequest) (string, string, bool) {
+	fillingRequest, event, err := services.SlotFilling.FillingRequest(req.SessionId)
+	if errors.Is(err, services.ErrSlotsIncomplete) {
+		var reply string
+		if state, _, err := services.SlotFilling.GetState(req.SessionId); err == nil {
+			reply = services.RenderSlotState(state)
+		}
+		reply += invalidSlotsText(event.Invalid) + fmt.Sprintf("\nAI助手: %v，请补充后再报销", err)
+		_ = util.WriteAppendText(ctx.Writer, reply)
+		_ = util.WriteMissingSlots(ctx.Writer, event)
+		return "", reply, false
+	}
+	var data []byte
+	if err == nil {
+		data, err = json.Marshal(fillingRequest)
+	}
+	if err != nil {
+		reply := fmt.Sprintf("\nAI助手: 获取报销信息失败: %v", err)
+		_ = util.WriteAppendText(ctx.Writer, reply)
+		return "", reply, false
+	}
 
+	chat := string(data)
+	log.Infoln("提取的信息为：\n", chat)
+	reply := "## 报销信息\n```json\n" + chat + "\n```\n"
+	_ = util.WriteAppendText(ctx.Writer, reply)
+	return chat, reply, true
+}
+
+func (c *InvoiceChatController) StartFilling(ctx *gin.Context) {
 	var req models.ChatRequest
 	if err := ctx.ShouldBindJSON(&req); err != nil {
 		controllers.Response(ctx, http.StatusBadRequest, "参数错误", gin.H{"error": err.Error()})
 		return
 	}
 
-	c.fillingStart(ctx, &req, &req.History)
+	// 填报耗时较长，断线重连时补发事件并继续输出进度
+	if controllers.ResumeSSE(ctx, controllers.SSEKindFilling, req.SessionId) {
+		return
+	}
+	finish := controllers.StartSSE(ctx, controllers.SSEKindFilling, req.SessionId)
+	defer finish()
+
+	// 传入的报销信息按可选值校验后保存，填报请求始终由服务端收集的报销信息生成
+	if req.History != "" {
+		if err := saveHistorySlots(req.SessionId, req.History); err != nil {
+			_ = util.WriteAppendText(ctx.Writer, fmt.Sprintf("\nAI助手: 报销信息不合法: %v", err))
+			util.WriteDone(ctx.Writer)
+			return
+		}
+	}
+	if chat, _, ok := c.slotFillingRequest(ctx, &req); ok {
+		c.fillingStart(ctx, &req, &chat)
+	}
+	util.WriteDone(ctx.Writer)
+}
+
+// saveHistorySlots 把客户端传入的报销信息JSON中填写了的字段保存到报销信息收集状态
+func saveHistorySlots(sessionId, history string) error {
+	var request models.AutoFillingRequest
+	if err := json.Unmarshal([]byte(history), &request); err != nil {
+		return fmt.Errorf("报销信息格式错误: %w", err)
+	}
+	basic, pay := request.BasicInfo, request.PayInfo
+	values := map[string]string{
+		"Category":     basic.Category,
+		"Title":        basic.Title,
+		"UrgentType":   basic.UrgentType,
+		"Comment":      basic.Comment,
+		"BusinessDept": pay.BusinessDept,
+		"BudgetDept":   pay.BudgetDept,
+		"PayDept":      pay.PayDept,
+		"ProjectType":  pay.ProjectType,
+		"Project":      pay.Project,
+	}
+	for key, value := range values {
+		if value == "" {
+			delete(values, key)
+		}
+	}
+	_, _, err := services.SlotFilling.SetSlots(sessionId, values)
+	return err
 }
 
 func (c *InvoiceChatController) fillingStart(ctx *gin.Context, req *models.ChatRequest, chat *string) {
@@ -105,26 +253,54 @@ func (c *InvoiceChatController) fillingStart(ctx *gin.Context, req *models.ChatR
 		controllers.Response(ctx, http.StatusInternalServerError, errorMsg, nil)
 		return
 	}
-	invoiceFile := models.InvoiceFile{
-		SessionId:   req.SessionId,
-		ServiceType: models.ServiceType(3),
-	}
-	files, err := services.InvoiceFile.ListInvoiceFilesByCont(invoiceFile, 100, 0)
+	check, err := services.CheckBeforeFilling(req.SessionId, req.UserId)
 	if err != nil {
-		controllers.Response(ctx, http.StatusInternalServerError, "自动填开发票失败", gin.H{})
+		_ = util.WriteAppendText(ctx.Writer, fmt.Sprintf("\nAI助手: %v", err))
 		return
 	}
 	autoFillingRequest.SessionId = req.SessionId
-	autoFillingRequest.Username = "tyzq-wangmeng5"
-	autoFillingRequest.Password = "tyzq123456"
-	autoFillingRequest.CostItems = models.StatByExpenseCategory(files)
-	_ = models.CollateFile(files, &autoFillingRequest)
+	autoFillingRequest.DryRun = req.DryRun
+	autoFillingRequest.Username, autoFillingRequest.Password = check.Username, check.Password
+	// 疑似重复报销的票据需人工确认后才能填报
+	if len(check.Duplicates) > 0 {
+		_ = util.WriteAppendText(ctx.Writer, fmt.Sprintf("\nAI助手: 有%d张票据疑似重复报销，确认不是重复报销后才能填报\n", len(check.Duplicates)))
+		for _, f := range check.Duplicates {
+			_ = util.WriteAppendText(ctx.Writer, fmt.Sprintf("- 票据 %d %s: %s\n", f.ID, f.FileName, f.DuplicateReason))
+		}
+		return
+	}
+	// 待人工审核的票据不参与报销
+	if len(check.Pending) > 0 {
+		_ = util.WriteAppendText(ctx.Writer, fmt.Sprintf("\nAI助手: 有%d张票据待人工审核，本次报销不包含这些票据\n", len(check.Pending)))
+	}
+	autoFillingRequest.CostItems = check.CostItems
+	// 不符合公司报销政策时不能填报
+	if check.Violations.HasErrors() {
+		_ = util.WriteAppendText(ctx.Writer, "\nAI助手: 报销单不符合公司报销政策，修改后才能填报\n")
+		for _, violation := range check.Violations {
+			_ = util.WriteAppendText(ctx.Writer, fmt.Sprintf("- %s\n", violation.Message))
+		}
+		return
+	}
+	_ = models.CollateFile(check.Files, &autoFillingRequest)
 	//controllers.Response(ctx, http.StatusOK, "开始自动填开发票", autoFillingRequest)
 	//return
-	log.Infoln("1---: ", autoFillingRequest)
+	log.Infof("开始自动填报, session_id: %s, user_id: %s", req.SessionId, req.UserId)
+	// 预览只生成填报计划，用户确认前不改变报销单状态
+	if !req.DryRun {
+		if err := services.Reimbursement.ConfirmFilling(req.SessionId, &autoFillingRequest); err != nil {
+			log.Warnf("记录报销单确认信息失败, session_id: %s, err: %v", req.SessionId, err)
+			_ = util.WriteAppendText(ctx.Writer, fmt.Sprintf("\nAI助手: 确认报销单失败: %v", err))
+			return
+		}
+		services.Reimbursement.Advance(req.SessionId, models.ReimbursementStatusSubmitting, "")
+	}
 	err = services.AutoFilling.StartAutoFilling(autoFillingRequest.SessionId, &autoFillingRequest)
 	if err != nil {
-		_ = util.WriteAppendText(ctx.Writer, "\nAI助手: 填开发票失败")
+		if !req.DryRun {
+			services.Reimbursement.Advance(req.SessionId, models.ReimbursementStatusFailed, err.Error())
+		}
+		_ = util.WriteAppendText(ctx.Writer, fmt.Sprintf("\nAI助手: 填开发票失败: %v", err))
 		return
 	} // 获取进度通道
 
@@ -133,8 +309,7 @@ func (c *InvoiceChatController) fillingStart(ctx *gin.Context, req *models.ChatR
 		_ = util.WriteAppendText(ctx.Writer, "\nAI助手: 填开发票失败")
 		return
 	}
-	// 设置监听条件
-	timeout := time.After(30 * time.Minute) // 30分钟超时
+	// 任务超时由任务自身的截止时间控制，从开始执行计算，排队等待的时间不计入
 	clientGone := ctx.Request.Context().Done()
 
 	// 监听自动填充服务的进度
@@ -143,24 +318,25 @@ func (c *InvoiceChatController) fillingStart(ctx *gin.Context, req *models.ChatR
 		case progress, ok := <-progressChan:
 			if !ok {
 				// 通道关闭，任务完成
-				_ = util.WriteAppendText(ctx.Writer, "\n## ✅ 报销服务已完成，请查看OA系统，审核后提交。。。")
+				task, _ := services.AutoFilling.GetTaskStatus(autoFillingRequest.SessionId)
+				switch {
+				case task != nil && task.Status == services.TaskStatusCancelled:
+					_ = util.WriteAppendText(ctx.Writer, "\nAI助手: 报销任务已取消")
+				case task != nil && task.Status == services.TaskStatusFailed:
+					_ = util.WriteAppendText(ctx.Writer, fmt.Sprintf("\nAI助手: 报销任务失败: %s", task.Error))
+				case req.DryRun:
+					writeFillingPlan(ctx, autoFillingRequest.SessionId)
+				default:
+					_ = util.WriteAppendText(ctx.Writer, "\n## ✅ 报销服务已完成，请查看OA系统，审核后提交。。。")
+				}
 				return
 			}
 			_ = util.WriteAppendText(ctx.Writer, progress)
 
 		case <-clientGone:
-			// 客户端断开连接
-			log.Warning("\n> 客户端连接断开，任务已取消")
-			_ = util.WriteAppendText(ctx.Writer, "\nAI助手: 客户端连接断开，任务已取消")
-			//c.service.CancelTask(taskID)
-			return
-
-		case <-timeout:
-			// 超时
-			log.Warning("\n> 任务执行超时，已取消\n")
-			_ = util.WriteAppendText(ctx.Writer, "\nAI助手: 任务执行超时，已取消")
-			services.AutoFilling.CancelTask(autoFillingRequest.SessionId)
-			return
+			// 客户端断开连接后任务继续执行，进度仍写入事件流，客户端可携带 Last-Event-ID 重连
+			log.Warning("\n> 客户端连接断开，任务继续执行")
+			clientGone = nil
 
 		case <-time.After(30 * time.Second):
 			// 心跳检测，保持连接活跃
@@ -168,3 +344,173 @@ func (c *InvoiceChatController) fillingStart(ctx *gin.Context, req *models.ChatR
 		}
 	}
 }
+
+// GetFillingTask 获取自动填报任务状态
+func (c *InvoiceChatController) GetFillingTask(ctx *gin.Context) {
+	task, err := services.AutoFilling.GetTaskRecord(ctx.Param("task_id"))
+	if err != nil {
+		controllers.Response(ctx, http.StatusNotFound, "填报任务不存在", "filling task not found")
+		return
+	}
+
+	controllers.Response(ctx, http.StatusOK, "获取成功", task)
+}
+
+// writeFillingPlan 预览结束后输出填报计划，供用户确认
+func writeFillingPlan(ctx *gin.Context, taskID string) {
+	task, err := services.AutoFilling.GetTaskRecord(taskID)
+	if err != nil || task.Plan == nil {
+		_ = util.WriteAppendText(ctx.Writer, "\nAI助手: 预览未生成填报计划，请查看进度日志")
+		return
+	}
+
+	var b strings.Builder
+	b.WriteString("\n## 📋 填报计划\n\n| 字段 | 填写值 | 实际选项 | 匹配方式 |\n| --- | --- | --- | --- |\n")
+	for _, field := range task.Plan.Fields {
+		name := field.Step
+		if field.Row > 0 {
+			name = fmt.Sprintf("明细%d·%s", field.Row, field.Step)
+		}
+		b.WriteString(fmt.Sprintf("| %s | %s | %s | %s |\n", name, field.Value, field.Selected, planMatchText[field.Match]))
+	}
+	b.WriteString(fmt.Sprintf("\n> 以上内容尚未保存到OA。确认无误请调用 /invoice/chat/filling/%s/confirm 后再正式填报", taskID))
+	_ = util.WriteAppendText(ctx.Writer, b.String())
+}
+
+var planMatchText = map[models.PlanMatch]string{
+	models.PlanMatchInput:       "直接填写",
+	models.PlanMatchExact:       "精确匹配",
+	models.PlanMatchFuzzy:       "模糊匹配",
+	models.PlanMatchFirstOption: "⚠️ 第一个选项",
+	models.PlanMatchOption:      "按选项定位",
+	models.PlanMatchNone:        "⚠️ 无可选项",
+}
+
+// ConfirmFillingPlan 确认预览生成的填报计划，确认后才允许正式填报
+func (c *InvoiceChatController) ConfirmFillingPlan(ctx *gin.Context) {
+	task, err := services.AutoFilling.ConfirmPreview(ctx.Param("task_id"))
+	if err != nil {
+		controllers.Response(ctx, http.StatusBadRequest, "确认填报计划失败", err.Error())
+		return
+	}
+
+	controllers.Response(ctx, http.StatusOK, "确认成功", task)
+}
+
+// CancelFillingTask 取消排队中或执行中的填报任务，等待任务停止后返回最终状态
+func (c *InvoiceChatController) CancelFillingTask(ctx *gin.Context) {
+	taskID := ctx.Param("task_id")
+	if !services.AutoFilling.CancelTask(taskID) {
+		controllers.Response(ctx, http.StatusBadRequest, "取消失败", "任务不存在或已结束")
+		return
+	}
+
+	if !services.AutoFilling.WaitTask(taskID, 10*time.Second) {
+		controllers.Response(ctx, http.StatusAccepted, "正在取消", gin.H{"task_id": taskID})
+		return
+	}
+	task, err := services.AutoFilling.GetTaskRecord(taskID)
+	if err != nil {
+		controllers.Response(ctx, http.StatusInternalServerError, "获取任务状态失败", err.Error())
+		return
+	}
+
+	controllers.Response(ctx, http.StatusOK, "已取消", task)
+}
+
+// ListFillingArtifacts 获取填报任务保存的截图、页面快照和追踪文件
+func (c *InvoiceChatController) ListFillingArtifacts(ctx *gin.Context) {
+	artifacts, err := services.AutoFilling.ListArtifacts(ctx.Param("task_id"))
+	if err != nil {
+		controllers.Response(ctx, http.StatusNotFound, "填报任务不存在", "filling task not found")
+		return
+	}
+
+	controllers.Response(ctx, http.StatusOK, "获取成功", artifacts)
+}
+
+// GetFillingArtifact 下载填报任务保存的文件
+func (c *InvoiceChatController) GetFillingArtifact(ctx *gin.Context) {
+	name := ctx.Param("name")
+	path, err := services.AutoFilling.GetArtifact(ctx.Param("task_id"), name)
+	if err != nil {
+		controllers.Response(ctx, http.StatusNotFound, "文件不存在", err.Error())
+		return
+	}
+
+	if models.ArtifactKindOf(name) == models.ArtifactTrace {
+		ctx.FileAttachment(path, name)
+		return
+	}
+	ctx.File(path)
+}
+
+// GetFillingProgress 获取自动填报任务的完整进度日志
+func (c *InvoiceChatController) GetFillingProgress(ctx *gin.Context) {
+	progress, err := services.AutoFilling.GetTaskProgressLog(ctx.Param("task_id"))
+	if err != nil {
+		controllers.Response(ctx, http.StatusNotFound, "填报任务不存在", "filling task not found")
+		return
+	}
+
+	controllers.Response(ctx, http.StatusOK, "获取成功", progress)
+}
+
+// GetSlots 获取对话中已收集的报销信息和缺少的字段
+func (c *InvoiceChatController) GetSlots(ctx *gin.Context) {
+	state, event, err := services.SlotFilling.GetState(ctx.Param("session_id"))
+	if err != nil {
+		controllers.Response(ctx, http.StatusInternalServerError, "获取报销信息失败", err.Error())
+		return
+	}
+	controllers.Response(ctx, http.StatusOK, "获取成功", gin.H{"state": state, "slots": event})
+}
+
+// UpdateSlots 直接修改报销信息字段，字段名与 basic_info/pay_info 一致
+func (c *InvoiceChatController) UpdateSlots(ctx *gin.Context) {
+	var values map[string]string
+	if err := ctx.ShouldBindJSON(&values); err != nil {
+		controllers.Response(ctx, http.StatusBadRequest, "参数错误", err.Error())
+		return
+	}
+	state, event, err := services.SlotFilling.SetSlots(ctx.Param("session_id"), values)
+	if err != nil {
+		controllers.Response(ctx, http.StatusBadRequest, "修改报销信息失败", err.Error())
+		return
+	}
+	controllers.Response(ctx, http.StatusOK, "修改成功", gin.H{"state": state, "slots": event})
+}
+
+// ResetSlots 清空对话中已收集的报销信息
+func (c *InvoiceChatController) ResetSlots(ctx *gin.Context) {
+	if err := services.SlotFilling.Reset(ctx.Param("session_id")); err != nil {
+		controllers.Response(ctx, http.StatusInternalServerError, "清空报销信息失败", err.Error())
+		return
+	}
+	controllers.Response(ctx, http.StatusOK, "清空成功", nil)
+}
+
+// ListChatSessions 获取会话列表，可按 user_id 过滤
+func (c *InvoiceChatController) ListChatSessions(ctx *gin.Context) {
+	limit, _ := strconv.Atoi(ctx.DefaultQuery("limit", "100"))
+	offset, _ := strconv.Atoi(ctx.DefaultQuery("offset", "0"))
+
+	sessions, err := services.ChatHistory.ListSessions(ctx.Query("user_id"), limit, offset)
+	if err != nil {
+		controllers.Response(ctx, http.StatusInternalServerError, "获取会话列表失败", err.Error())
+		return
+	}
+	controllers.Response(ctx, http.StatusOK, "获取成功", sessions)
+}
+
+// GetChatHistory 按时间顺序获取会话的对话消息，limit 为0时获取全部
+func (c *InvoiceChatController) GetChatHistory(ctx *gin.Context) {
+	limit, _ := strconv.Atoi(ctx.DefaultQuery("limit", "0"))
+
+	messages, err := services.ChatHistory.History(ctx.Param("session_id"), limit)
+	if err != nil {
+		controllers.Response(ctx, http.StatusInternalServerError, "获取对话历史失败", err.Error())
+		return
+	}
+	controllers.Response(ctx, http.StatusOK, "获取成功", messages)
+}
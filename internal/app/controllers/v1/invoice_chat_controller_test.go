@@ -0,0 +1,178 @@
+package v1
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"invoice-agent/internal/app/models"
+	"invoice-agent/internal/app/services"
+)
+
+// fillingFakes 替换填报用到的服务，测试结束后恢复
+func fillingFakes(t *testing.T, files ...models.InvoiceFile) (*fakeInvoiceFiles, *fakeReimbursement) {
+	t.Helper()
+	invoiceFiles, reimbursement := newFakeInvoiceFiles(files...), &fakeReimbursement{}
+	oldInvoiceFile, oldReimbursement, oldCredential := services.InvoiceFile, services.Reimbursement, services.Credential
+	oldChatHistory, oldSlotFilling, oldAutoFilling := services.ChatHistory, services.SlotFilling, services.AutoFilling
+	services.InvoiceFile, services.Reimbursement, services.Credential = invoiceFiles, reimbursement, &fakeCredential{}
+	services.ChatHistory, services.SlotFilling = &fakeChatHistory{}, &fakeSlotFilling{state: &models.SlotState{}}
+	t.Cleanup(func() {
+		services.InvoiceFile, services.Reimbursement, services.Credential = oldInvoiceFile, oldReimbursement, oldCredential
+		services.ChatHistory, services.SlotFilling, services.AutoFilling = oldChatHistory, oldSlotFilling, oldAutoFilling
+	})
+	return invoiceFiles, reimbursement
+}
+
+func fillingRequestJSON(t *testing.T) string {
+	t.Helper()
+	data, err := json.Marshal(models.AutoFillingRequest{
+		BasicInfo: models.BasicItem{Category: "差旅费报销", Title: "北京出差", UrgentType: "一般", Comment: "客户现场支持"},
+		PayInfo:   models.PayItem{BusinessDept: "技术研发部", BudgetDept: "技术研发部", PayDept: "天宇正清科技有限公司", ProjectType: "研发项目", Project: "发票智能体"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestChatReplaysModelReply(t *testing.T) {
+	fillingFakes(t)
+	history := &fakeChatHistory{}
+	services.ChatHistory = history
+	services.SlotFilling = &fakeSlotFilling{state: &models.SlotState{SessionId: "chat-session"}}
+
+	c := NewInvoiceChatController(services.ChatClient)
+	text, done := serveSSE(t, c.Chat, models.ChatRequest{
+		SessionId: "chat-session",
+		UserId:    "u-1",
+		Input:     "报销需要准备哪些材料？",
+	})
+	if !done {
+		t.Fatal("事件流没有以 [DONE] 结束")
+	}
+	if !strings.Contains(text, "请上传需要报销的发票和行程单") {
+		t.Errorf("没有输出模型的回复: %s", text)
+	}
+	if len(history.messages) != 2 {
+		t.Fatalf("保存了%d条对话消息，期望2条", len(history.messages))
+	}
+	if reply := history.messages[1]; reply.Role != models.ChatRoleAssistant || reply.TotalTokens == 0 {
+		t.Errorf("助手消息 %+v 缺少回复或token用量", reply)
+	}
+}
+
+func TestStartFillingBlocksDuplicates(t *testing.T) {
+	_, reimbursement := fillingFakes(t, models.InvoiceFile{
+		ID: 1, FileID: "file-1", FileName: "taxi.pdf", ServiceType: models.ServiceTypeInvoice,
+		TotalAmount: 86.5, ExpenseCategory: "市内交通费", DuplicateOf: "file-0", DuplicateReason: "发票号码相同",
+	})
+
+	c := NewInvoiceChatController(services.ChatClient)
+	text, done := serveSSE(t, c.StartFilling, models.ChatRequest{SessionId: "dup-session", Input: "开始报销", History: fillingRequestJSON(t)})
+	if !done {
+		t.Error("事件流没有以 [DONE] 结束")
+	}
+	if !strings.Contains(text, "疑似重复报销") || !strings.Contains(text, "发票号码相同") {
+		t.Errorf("没有提示重复报销: %s", text)
+	}
+	if reimbursement.confirmed != 0 || len(reimbursement.advanced) != 0 {
+		t.Errorf("重复报销时不应确认报销单: confirmed=%d advanced=%v", reimbursement.confirmed, reimbursement.advanced)
+	}
+}
+
+func TestStartFillingBlocksPolicyViolations(t *testing.T) {
+	_, reimbursement := fillingFakes(t, models.InvoiceFile{
+		ID: 1, FileID: "file-1", FileName: "dinner.pdf", ServiceType: models.ServiceTypeInvoice,
+		TotalAmount: 4200, ItemName: "餐饮服务", ExpenseCategory: "业务招待费",
+	})
+
+	c := NewInvoiceChatController(services.ChatClient)
+	text, _ := serveSSE(t, c.StartFilling, models.ChatRequest{SessionId: "policy-session", Input: "开始报销", History: fillingRequestJSON(t)})
+	if !strings.Contains(text, "不符合公司报销政策") || !strings.Contains(text, "业务招待费合计4200.00元") {
+		t.Errorf("没有提示报销政策: %s", text)
+	}
+	if reimbursement.confirmed != 0 {
+		t.Errorf("不符合报销政策时不应确认报销单")
+	}
+}
+
+func TestStartFillingStopsWhenConfirmFails(t *testing.T) {
+	_, reimbursement := fillingFakes(t, models.InvoiceFile{
+		ID: 1, FileID: "file-1", FileName: "taxi.pdf", ServiceType: models.ServiceTypeInvoice,
+		TotalAmount: 86.5, ItemName: "运输服务", ExpenseCategory: "市内交通费",
+	})
+	reimbursement.confirmErr = errors.New("报销单已提交，不能重复确认")
+
+	c := NewInvoiceChatController(services.ChatClient)
+	text, _ := serveSSE(t, c.StartFilling, models.ChatRequest{SessionId: "confirm-session", Input: "开始报销", History: fillingRequestJSON(t)})
+	if !strings.Contains(text, "确认报销单失败") {
+		t.Errorf("没有提示确认失败: %s", text)
+	}
+	if len(reimbursement.advanced) != 0 {
+		t.Errorf("确认失败时不应推进报销单状态: %v", reimbursement.advanced)
+	}
+}
+
+func TestStartFillingDryRunKeepsReimbursement(t *testing.T) {
+	_, reimbursement := fillingFakes(t, models.InvoiceFile{
+		ID: 1, FileID: "file-1", FileName: "taxi.pdf", ServiceType: models.ServiceTypeInvoice,
+		TotalAmount: 86.5, ItemName: "运输服务", ExpenseCategory: "市内交通费",
+	})
+	// 未启动队列的服务不接受新任务，预览在排队时失败
+	services.AutoFilling = &services.AutoFillingService{}
+
+	c := NewInvoiceChatController(services.ChatClient)
+	text, _ := serveSSE(t, c.StartFilling, models.ChatRequest{SessionId: "dry-run-session", Input: "预览", History: fillingRequestJSON(t), DryRun: true})
+	if !strings.Contains(text, "填开发票失败") {
+		t.Errorf("没有提示任务启动失败: %s", text)
+	}
+	if reimbursement.confirmed != 0 || len(reimbursement.advanced) != 0 {
+		t.Errorf("预览不应改变报销单: confirmed=%d advanced=%v", reimbursement.confirmed, reimbursement.advanced)
+	}
+}
+
+func TestStartFillingRejectsInvalidHistory(t *testing.T) {
+	_, reimbursement := fillingFakes(t, models.InvoiceFile{
+		ID: 1, FileID: "file-1", FileName: "taxi.pdf", ServiceType: models.ServiceTypeInvoice,
+		TotalAmount: 86.5, ItemName: "运输服务", ExpenseCategory: "市内交通费",
+	})
+	services.SlotFilling = &fakeSlotFilling{state: &models.SlotState{}, setErr: errors.New("付款公司只能是：天宇正清(重庆)科技有限公司")}
+
+	c := NewInvoiceChatController(services.ChatClient)
+	text, done := serveSSE(t, c.StartFilling, models.ChatRequest{SessionId: "invalid-session", Input: "开始报销", History: fillingRequestJSON(t)})
+	if !done {
+		t.Error("事件流没有以 [DONE] 结束")
+	}
+	if !strings.Contains(text, "报销信息不合法") || strings.Contains(text, "## 报销信息") {
+		t.Errorf("传入的报销信息不合法时应拒绝填报: %s", text)
+	}
+	if reimbursement.confirmed != 0 {
+		t.Errorf("报销信息不合法时不应确认报销单")
+	}
+
+	text, done = serveSSE(t, c.StartFilling, models.ChatRequest{SessionId: "invalid-session", Input: "开始报销", History: "{"})
+	if !done || !strings.Contains(text, "报销信息格式错误") {
+		t.Errorf("报销信息不是JSON时应提示格式错误: %s", text)
+	}
+}
+
+func TestStartFillingUsesSlotState(t *testing.T) {
+	_, reimbursement := fillingFakes(t, models.InvoiceFile{
+		ID: 1, FileID: "file-1", FileName: "taxi.pdf", ServiceType: models.ServiceTypeInvoice,
+		TotalAmount: 86.5, ItemName: "运输服务", ExpenseCategory: "市内交通费",
+	})
+	reimbursement.confirmErr = errors.New("报销单已提交，不能重复确认")
+	services.SlotFilling = &fakeSlotFilling{state: &models.SlotState{BasicInfo: models.BasicItem{Title: "上海出差"}}}
+
+	// 只传入部分字段时与对话中收集的报销信息合并
+	c := NewInvoiceChatController(services.ChatClient)
+	text, done := serveSSE(t, c.StartFilling, models.ChatRequest{SessionId: "slot-session", Input: "开始报销", History: `{"basic_info":{"Comment":"客户现场支持"}}`})
+	if !done {
+		t.Error("事件流没有以 [DONE] 结束")
+	}
+	if !strings.Contains(text, "上海出差") || !strings.Contains(text, "客户现场支持") {
+		t.Errorf("填报请求应由报销信息收集状态生成: %s", text)
+	}
+}
@@ -5,14 +5,19 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 	log "github.com/sirupsen/logrus"
 	"invoice-agent/internal/app/controllers"
 	"invoice-agent/internal/app/models"
 	"invoice-agent/internal/app/services"
+	"invoice-agent/internal/pkg/imagehash"
+	"invoice-agent/internal/pkg/ofd"
+	"invoice-agent/internal/pkg/qrcode"
 	"invoice-agent/pkg/util"
 	"net/http"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 )
@@ -130,10 +135,12 @@ func (c *InvoiceFileController) DeleteInvoiceFile(ctx *gin.Context) {
 		return
 	}
 
-	err = services.FileClient.DeleteFile(ctx.Request.Context(), strings.TrimSpace(invoiceFile.FileID))
-	if err != nil {
-		controllers.Response(ctx, http.StatusInternalServerError, "删除发票文件失败", err)
-		return
+	if !models.IsLocalFileID(invoiceFile.FileID) {
+		err = services.FileClient.DeleteFile(ctx.Request.Context(), strings.TrimSpace(invoiceFile.FileID))
+		if err != nil {
+			controllers.Response(ctx, http.StatusInternalServerError, "删除发票文件失败", err)
+			return
+		}
 	}
 
 	controllers.Response(ctx, http.StatusOK, "删除成功", nil)
@@ -152,11 +159,97 @@ func (c *InvoiceFileController) GetInvoiceFileInExpensive(ctx *gin.Context) {
 		return
 	}
 
-	category := models.StatByExpenseCategory(invoiceFiles)
+	// 待人工审核的票据不计入统计
+	counted, _ := models.SplitByReview(invoiceFiles)
+	category := models.StatByExpenseCategory(counted)
 
 	controllers.Response(ctx, http.StatusOK, "获取成功", category)
 }
 
+// ListReviewInvoiceFiles 获取待人工审核的票据
+func (c *InvoiceFileController) ListReviewInvoiceFiles(ctx *gin.Context) {
+	limit, _ := strconv.Atoi(ctx.DefaultQuery("limit", "100"))
+	offset, _ := strconv.Atoi(ctx.DefaultQuery("offset", "0"))
+	sessionId := ctx.Query("session_id")
+
+	invoiceFiles, err := c.invoiceFileService.ListPendingReview(sessionId, limit, offset)
+	if err != nil {
+		controllers.Response(ctx, http.StatusInternalServerError, "获取待审核票据失败", err)
+		return
+	}
+
+	controllers.Response(ctx, http.StatusOK, "获取成功", invoiceFiles)
+}
+
+// CorrectInvoiceFile 人工修正待审核票据的字段
+func (c *InvoiceFileController) CorrectInvoiceFile(ctx *gin.Context) {
+	id, err := strconv.ParseUint(ctx.Param("id"), 10, 64)
+	if err != nil {
+		controllers.Response(ctx, http.StatusBadRequest, "参数错误", "invalid id")
+		return
+	}
+	var correction models.InvoiceFile
+	if err := ctx.ShouldBindBodyWith(&correction, binding.JSON); err != nil {
+		controllers.Response(ctx, http.StatusBadRequest, "参数错误", err)
+		return
+	}
+	// 零值会被忽略，请求中明确传入0的金额字段单独修正，如免税发票的税额
+	var keys map[string]json.RawMessage
+	if err := ctx.ShouldBindBodyWith(&keys, binding.JSON); err != nil {
+		controllers.Response(ctx, http.StatusBadRequest, "参数错误", err)
+		return
+	}
+	var zeroFields []string
+	for field, value := range map[string]float64{"amount": correction.Amount, "tax_amount": correction.TaxAmount, "total_amount": correction.TotalAmount} {
+		if _, ok := keys[field]; ok && value == 0 {
+			zeroFields = append(zeroFields, field)
+		}
+	}
+	sort.Strings(zeroFields)
+
+	invoiceFile, err := c.invoiceFileService.CorrectInvoiceFile(id, &correction, zeroFields...)
+	if err != nil {
+		controllers.Response(ctx, http.StatusInternalServerError, "修正票据失败", err)
+		return
+	}
+
+	controllers.Response(ctx, http.StatusOK, "修正成功", invoiceFile)
+}
+
+// OverrideDuplicate 确认疑似重复的票据不是重复报销
+func (c *InvoiceFileController) OverrideDuplicate(ctx *gin.Context) {
+	id, err := strconv.ParseUint(ctx.Param("id"), 10, 64)
+	if err != nil {
+		controllers.Response(ctx, http.StatusBadRequest, "参数错误", "invalid id")
+		return
+	}
+
+	invoiceFile, err := c.invoiceFileService.OverrideDuplicate(id)
+	if err != nil {
+		controllers.Response(ctx, http.StatusInternalServerError, "确认票据失败", err)
+		return
+	}
+
+	controllers.Response(ctx, http.StatusOK, "已确认不是重复报销", invoiceFile)
+}
+
+// ApproveInvoiceFile 审核通过票据
+func (c *InvoiceFileController) ApproveInvoiceFile(ctx *gin.Context) {
+	id, err := strconv.ParseUint(ctx.Param("id"), 10, 64)
+	if err != nil {
+		controllers.Response(ctx, http.StatusBadRequest, "参数错误", "invalid id")
+		return
+	}
+
+	invoiceFile, err := c.invoiceFileService.ApproveInvoiceFile(id)
+	if err != nil {
+		controllers.Response(ctx, http.StatusInternalServerError, "审核票据失败", err)
+		return
+	}
+
+	controllers.Response(ctx, http.StatusOK, "审核通过", invoiceFile)
+}
+
 func (c *InvoiceFileController) DeleteUploadedInvoiceFile(ctx *gin.Context) {
 	// 从请求体中读取原始数据
 	rawData, err := ctx.GetRawData()
@@ -181,6 +274,9 @@ func (c *InvoiceFileController) DeleteUploadedInvoiceFile(ctx *gin.Context) {
 
 	for _, id := range fileIds {
 		log.Infoln("---------delete file: ", id)
+		if models.IsLocalFileID(strings.TrimSpace(id)) {
+			continue
+		}
 		err := services.FileClient.DeleteFile(ctx.Request.Context(), strings.TrimSpace(id))
 		if err != nil {
 			log.Infoln("---------delete file err: ", err)
@@ -221,13 +317,6 @@ func (c *InvoiceFileController) UploadInvoiceFile(ctx *gin.Context) {
 		SessionId: sessionId,
 		MD5:       md5,
 	}
-	//去重出去，重复的数据要进行删除
-	files, _ := services.InvoiceFile.ListInvoiceFilesByCont(tmp, 10, 0)
-	if files != nil && len(files) > 0 {
-		log.Errorf("文件重复, file: %s, md5: %s", fileHeader.Filename, md5)
-		controllers.Response(ctx, http.StatusBadRequest, "重复的文件...", tmp)
-		return
-	}
 
 	// 创建目录路径
 	dirPath := filepath.Join("/app/output/uploads")
@@ -237,54 +326,105 @@ func (c *InvoiceFileController) UploadInvoiceFile(ctx *gin.Context) {
 		return
 	}
 
-	// 保存文件到本地时间命名的目录
-	localFilePath := filepath.Join(dirPath, fileHeader.Filename)
-	if err := ctx.SaveUploadedFile(fileHeader, localFilePath); err != nil {
-		log.Errorf("保存文件到本地失败:%s", fileHeader.Filename)
+	// 先保存到临时文件并计算摘要，校验和去重通过后再移动到正式路径
+	uploadingPath, digest, err := util.SaveUploadedFileToTemp(fileHeader, dirPath)
+	if err != nil {
+		log.Errorf("保存文件到本地失败:%s, err: %v", fileHeader.Filename, err)
 		controllers.Response(ctx, http.StatusInternalServerError, "保存文件到本地失败", tmp)
 		return
 	}
+	if !strings.EqualFold(md5, digest.MD5) {
+		_ = os.Remove(uploadingPath)
+		log.Errorf("文件MD5不一致, file: %s, 客户端: %s, 服务端: %s", fileHeader.Filename, md5, digest.MD5)
+		controllers.Response(ctx, http.StatusBadRequest, "文件MD5校验失败，请重新上传", tmp)
+		return
+	}
+	tmp.MD5 = digest.MD5
+	tmp.SHA256 = digest.SHA256
 
-	// 计算文件MD5值
-	//md5Hash, err := util.CalculateFileMD5(localFilePath)
-	//if err != nil {
-	//	// 如果计算MD5失败，删除已保存的本地文件
-	//	os.Remove(localFilePath)
-	//	controllers.Response(ctx, http.StatusInternalServerError, "计算文件MD5值失败", err)
-	//	return
-	//}
-
-	// 从本地文件上传到OpenAI
-	fileId, err := services.FileClient.UploadFile(
-		ctx.Request.Context(),
-		localFilePath,
-		"file-extract", // 或其他适当的purpose
-	)
-	if err != nil {
-		// 如果上传OpenAI失败，删除已保存的本地文件
-		_ = os.Remove(localFilePath)
-		controllers.Response(ctx, http.StatusInternalServerError, fmt.Sprintf("文件上传到OpenAI失败:%s", err), tmp)
+	//去重出去，重复的数据要进行删除
+	files, _ := services.InvoiceFile.ListInvoiceFilesByCont(tmp, 10, 0)
+	if files != nil && len(files) > 0 {
+		_ = os.Remove(uploadingPath)
+		log.Errorf("文件重复, file: %s, sha256: %s", fileHeader.Filename, digest.SHA256)
+		controllers.Response(ctx, http.StatusBadRequest, "重复的文件...", tmp)
+		return
+	}
+	// 按内容摘要分目录保存，不同报销单的同名文件不会互相覆盖，上传到OA时仍使用原始文件名；
+	// 同一路径已存在时内容相同，失败时也不能删除，其他报销单可能在使用
+	localFilePath := filepath.Join(dirPath, digest.SHA256, filepath.Base(fileHeader.Filename))
+	_, statErr := os.Stat(localFilePath)
+	createdLocal := os.IsNotExist(statErr)
+	if err := os.MkdirAll(filepath.Dir(localFilePath), os.ModePerm); err != nil {
+		_ = os.Remove(uploadingPath)
+		log.Errorf("本地目录:%s, 创建失败", filepath.Dir(localFilePath))
+		controllers.Response(ctx, http.StatusInternalServerError, "创建本地目录失败", tmp)
+		return
+	}
+	if err := os.Rename(uploadingPath, localFilePath); err != nil {
+		_ = os.Remove(uploadingPath)
+		log.Errorf("保存文件到本地失败:%s, err: %v", fileHeader.Filename, err)
+		controllers.Response(ctx, http.StatusInternalServerError, "保存文件到本地失败", tmp)
 		return
 	}
+	removeLocal := func() {
+		if createdLocal {
+			_ = os.Remove(localFilePath)
+		}
+	}
 
-	// 创建发票文件记录
-	invoiceFile := models.InvoiceFile{
-		SessionId: sessionId,
-		FileName:  fileHeader.Filename,
-		FilePath:  localFilePath,
-		FileID:    fileId, // 使用OpenAI返回的文件ID
-		MD5:       md5,
+	// OFD/XML全电发票直接本地解析，不需要上传到OpenAI
+	invoiceFile, parsed := parseLocalInvoice(localFilePath, fileHeader.Filename)
+	if !parsed {
+		// 从本地文件上传到OpenAI
+		fileId, err := services.FileClient.UploadFile(
+			ctx.Request.Context(),
+			localFilePath,
+			"file-extract", // 或其他适当的purpose
+		)
+		if err != nil {
+			// 如果上传OpenAI失败，删除已保存的本地文件
+			removeLocal()
+			controllers.Response(ctx, http.StatusInternalServerError, fmt.Sprintf("文件上传到OpenAI失败:%s", err), tmp)
+			return
+		}
+		invoiceFile.FileID = fileId // 使用OpenAI返回的文件ID
+		seedFromQRCode(invoiceFile, localFilePath, fileHeader.Filename)
+	}
+	if imagehash.IsSupported(fileHeader.Filename) {
+		if hash, err := imagehash.HashFile(localFilePath); err == nil {
+			invoiceFile.ImageHash = hash
+		} else {
+			log.Warnf("计算图片哈希失败, file: %s, err: %v", fileHeader.Filename, err)
+		}
 	}
 
+	// 创建发票文件记录
+	invoiceFile.SessionId = sessionId
+	invoiceFile.FileName = fileHeader.Filename
+	invoiceFile.FilePath = localFilePath
+	invoiceFile.MD5 = digest.MD5
+	invoiceFile.SHA256 = digest.SHA256
+
 	// 保存到数据库
-	if err := c.invoiceFileService.CreateInvoiceFile(&invoiceFile); err != nil {
+	if err := c.invoiceFileService.CreateInvoiceFile(invoiceFile); err != nil {
 		// 如果数据库保存失败，删除已保存的本地文件和OpenAI文件
-		_ = os.Remove(localFilePath)
-		_ = services.FileClient.DeleteFile(ctx.Request.Context(), fileId)
+		removeLocal()
+		if !parsed {
+			_ = services.FileClient.DeleteFile(ctx.Request.Context(), invoiceFile.FileID)
+		}
 		controllers.Response(ctx, http.StatusInternalServerError, "创建发票文件记录失败", invoiceFile)
 		return
 	}
 
+	// 检查是否在其他报销单中报销过
+	if checked, err := c.invoiceFileService.CheckDuplicate(invoiceFile.FileID); err == nil {
+		invoiceFile = checked
+	} else {
+		log.Warnf("重复报销检测失败, file_id: %s, err: %v", invoiceFile.FileID, err)
+	}
+
+	services.Reimbursement.Advance(sessionId, models.ReimbursementStatusCollecting, "")
 	controllers.Response(ctx, http.StatusOK, "文件上传和保存成功", invoiceFile)
 }
 
@@ -302,11 +442,105 @@ func (c *InvoiceFileController) FileParseChat(ctx *gin.Context) {
 		return
 	}
 
-	// 设置响应头支持流式输出
-	ctx.Header("Content-Type", "text/event-stream; charset=utf-8")
-	ctx.Header("Cache-Control", "no-cache")
-	ctx.Header("Connection", "keep-alive")
+	// 断线重连时补发事件，否则开始新的流式输出
+	if controllers.ResumeSSE(ctx, controllers.SSEKindParse, req.SessionId) {
+		return
+	}
+	finish := controllers.StartSSE(ctx, controllers.SSEKindParse, req.SessionId)
+	defer finish()
+
+	// 本地已解析的文件不再交给大模型
+	localFiles, remoteFileIds := c.splitLocalParsedFiles(req.FileIds)
+	if len(remoteFileIds) == 0 {
+		writeParseResult(ctx, localFiles)
+		writePairing(ctx, req.SessionId)
+		services.Reimbursement.Advance(req.SessionId, models.ReimbursementStatusParsed, "")
+		util.WriteDone(ctx.Writer)
+		return
+	}
+	req.FileIds = remoteFileIds
+
+	// 识别结果校验失败时，把错误反馈给模型重新识别
+	var invoiceFiles []models.InvoiceFile
+	var parseErr *services.FileParseError
+	maxRetries := services.ParseMaxRetries()
+	for attempt := 0; attempt <= maxRetries; attempt++ {
+		if attempt > 0 {
+			_ = util.WriteAppendText(ctx.Writer, fmt.Sprintf("\n> ⚠️ %s，第%d次重新识别...\n", parseErr.Message, attempt))
+		}
+		contentStr, err := streamFileParse(ctx, req)
+		if err != nil {
+			log.Errorf("票据识别失败, session_id: %s, err: %v", req.SessionId, err)
+			_ = util.WriteAppendText(ctx.Writer, fmt.Sprintf("\nAI助手: 票据识别失败: %v", err))
+			util.WriteDone(ctx.Writer)
+			return
+		}
+		invoiceFiles, parseErr = services.ValidateFileParseOutput(contentStr, req.FileIds)
+		if parseErr == nil {
+			break
+		}
+		log.Warnf("票据识别结果校验失败, attempt: %d, err: %s", attempt, util.GetJson(parseErr))
+		req.Feedback = parseErr.Feedback(contentStr)
+	}
+	if parseErr != nil {
+		writeParseError(ctx, parseErr)
+		util.WriteDone(ctx.Writer)
+		return
+	}
+
+	for i := range invoiceFiles {
+		invoiceFile := &invoiceFiles[i]
+		c.crossCheckQRCode(invoiceFile)
+		invoiceFile.ApplyLLMConfidence()
+		invoiceFile.UpdateReviewStatus(services.ReviewThreshold())
+		err := services.InvoiceFile.UpdateInvoiceFileByFileId(invoiceFile.FileID, invoiceFile)
+		if err != nil {
+			errorMsg := fmt.Sprintf("AI助手: 更新发票文件失败: %v\n", err)
+			_ = util.WriteAppendText(ctx.Writer, "\n")
+			_ = util.WriteAppendText(ctx.Writer, errorMsg)
+			continue
+		}
+		if checked, err := services.InvoiceFile.CheckDuplicate(invoiceFile.FileID); err == nil {
+			invoiceFile.DuplicateOf = checked.DuplicateOf
+			invoiceFile.DuplicateReason = checked.DuplicateReason
+			invoiceFile.DuplicateOverride = checked.DuplicateOverride
+		} else {
+			log.Warnf("重复报销检测失败, file_id: %s, err: %v", invoiceFile.FileID, err)
+		}
+	}
+
+	writeParseResult(ctx, append(localFiles, invoiceFiles...))
+	writePairing(ctx, req.SessionId)
+	services.Reimbursement.Advance(req.SessionId, models.ReimbursementStatusParsed, "")
+	util.WriteDone(ctx.Writer)
+}
 
+// writePairing 为报销单中的行程单配对发票并输出配对结果
+func writePairing(ctx *gin.Context, sessionId string) {
+	files, err := services.InvoiceFile.PairItineraries(sessionId)
+	if err != nil {
+		log.Warnf("行程单配对失败, session_id: %s, err: %v", sessionId, err)
+		return
+	}
+	names := make(map[uint64]string)
+	for _, f := range files {
+		names[f.ID] = f.FileName
+	}
+	var lines strings.Builder
+	for _, f := range files {
+		if f.ParentID != 0 {
+			lines.WriteString(fmt.Sprintf("- %s → %s\n", f.FileName, names[f.ParentID]))
+		}
+	}
+	if lines.Len() == 0 {
+		return
+	}
+	_ = util.WriteAppendText(ctx.Writer, "\n## 🔗 行程单配对\n以下行程单与发票合并为一张票据报销：\n")
+	_ = util.WriteAppendText(ctx.Writer, lines.String())
+}
+
+// streamFileParse 流式输出一次票据识别结果，返回完整内容或模型调用的错误
+func streamFileParse(ctx *gin.Context, req models.ChatRequest) (string, error) {
 	contentChan, errorChan := services.ChatClient.FileParseStream(ctx.Request.Context(), req)
 	_ = util.WriteAppendText(ctx.Writer, "\n## 所有单据信息")
 	_ = util.WriteAppendText(ctx.Writer, "\n```json")
@@ -321,52 +555,129 @@ func (c *InvoiceFileController) FileParseChat(ctx *gin.Context) {
 				log.Info("===== 流结束，开始解析数据")
 				_ = util.WriteAppendText(ctx.Writer, "\n```")
 				_ = util.WriteAppendText(ctx.Writer, "\n")
-				// 获取完整内容
-				contentStr := fullContent.String()
-				var invoiceFiles []models.InvoiceFile
-				// 解析JSON数据
-				if err := json.Unmarshal([]byte(contentStr), &invoiceFiles); err != nil {
-					errorMsg := fmt.Sprintf("AI助手: JSON解析失败: %v\n", err)
-					_ = util.WriteAppendText(ctx.Writer, "\n")
-					_ = util.WriteAppendText(ctx.Writer, errorMsg)
-					return
-				}
-
-				for _, invoiceFile := range invoiceFiles {
-					err := services.InvoiceFile.UpdateInvoiceFileByFileId(invoiceFile.FileID, &invoiceFile)
-					if err != nil {
-						errorMsg := fmt.Sprintf("AI助手: 更新发票文件失败: %v\n", err)
-						_ = util.WriteAppendText(ctx.Writer, "\n")
-						_ = util.WriteAppendText(ctx.Writer, errorMsg)
-					}
-				}
-
-				// 发送解析结果
-				resultMsg := fmt.Sprintf("## 📋AI助手: 共解析%d条发票记录\n", len(invoiceFiles))
-				_ = util.WriteAppendText(ctx.Writer, "\n")
-				_ = util.WriteAppendText(ctx.Writer, resultMsg)
-
-				// 发送每条记录的详细信息
-				for i, invoice := range invoiceFiles {
-					detailMsg := fmt.Sprintf("- 票据%d: %s (%s) - %.2f元, %s\n",
-						i+1, invoice.InvoiceType, invoice.ItemName, invoice.TotalAmount, invoice.FileName)
-					_ = util.WriteAppendText(ctx.Writer, "\n")
-					_ = util.WriteAppendText(ctx.Writer, detailMsg)
-				}
-				util.WriteDone(ctx.Writer)
-				return
+				return fullContent.String(), nil
 			}
 			// 实时处理内容
-			fmt.Print(content)
+			log.Debug(content)
 			fullContent.WriteString(content)
 
 			_ = util.WriteAppendText(ctx.Writer, content)
 		case err, ok := <-errorChan:
-			if ok && err != nil {
-				// 处理错误
-				fmt.Printf("Error: %v\n", err)
-				return
+			if !ok {
+				// 错误通道关闭后不再等待，避免空转
+				errorChan = nil
+				continue
 			}
+			if err != nil {
+				return "", err
+			}
+		}
+	}
+}
+
+// writeParseError 输出识别失败的文件及原因
+func writeParseError(ctx *gin.Context, parseErr *services.FileParseError) {
+	_ = util.WriteAppendText(ctx.Writer, fmt.Sprintf("\nAI助手: %s，已重试%d次仍未通过校验\n", parseErr.Message, services.ParseMaxRetries()))
+	for _, f := range parseErr.Files {
+		_ = util.WriteAppendText(ctx.Writer, fmt.Sprintf("- 文件 %s %s: %s\n", f.FileID, f.FileName, strings.Join(f.Errors, "; ")))
+	}
+	_ = util.WriteParseError(ctx.Writer, parseErr.Message, parseErr)
+}
+
+// parseLocalInvoice 尝试本地解析OFD/XML发票，失败时返回空记录，由大模型识别
+func parseLocalInvoice(localFilePath, fileName string) (*models.InvoiceFile, bool) {
+	if !ofd.IsSupported(fileName) {
+		return &models.InvoiceFile{}, false
+	}
+	invoiceFile, err := ofd.ParseFile(localFilePath)
+	if err != nil {
+		log.Warnf("本地解析发票失败，回退到大模型识别, file: %s, err: %v", fileName, err)
+		return &models.InvoiceFile{}, false
+	}
+	invoiceFile.FileID = models.NewLocalFileID()
+	invoiceFile.UpdateReviewStatus(services.ReviewThreshold())
+	return invoiceFile, true
+}
+
+// splitLocalParsedFiles 拆分本地已解析的文件和需要大模型识别的文件
+func (c *InvoiceFileController) splitLocalParsedFiles(fileIds []string) ([]models.InvoiceFile, []string) {
+	localFiles := make([]models.InvoiceFile, 0)
+	remoteFileIds := make([]string, 0, len(fileIds))
+	for _, fileId := range fileIds {
+		if !models.IsLocalFileID(fileId) {
+			remoteFileIds = append(remoteFileIds, fileId)
+			continue
 		}
+		invoiceFile, err := c.invoiceFileService.GetInvoiceFileByFileID(fileId)
+		if err != nil {
+			log.Errorf("获取本地解析文件失败, file_id: %s, err: %v", fileId, err)
+			continue
+		}
+		// 离线模式上传的文件同样是本地ID，但尚未识别
+		if invoiceFile.ServiceType == 0 {
+			remoteFileIds = append(remoteFileIds, fileId)
+			continue
+		}
+		localFiles = append(localFiles, *invoiceFile)
+	}
+	return localFiles, remoteFileIds
+}
+
+// writeParseResult 发送解析结果汇总
+func writeParseResult(ctx *gin.Context, invoiceFiles []models.InvoiceFile) {
+	resultMsg := fmt.Sprintf("## 📋AI助手: 共解析%d条发票记录\n", len(invoiceFiles))
+	_ = util.WriteAppendText(ctx.Writer, "\n")
+	_ = util.WriteAppendText(ctx.Writer, resultMsg)
+
+	// 发送每条记录的详细信息
+	for i, invoice := range invoiceFiles {
+		detailMsg := fmt.Sprintf("- 票据%d: %s (%s) - %.2f元, %s\n",
+			i+1, invoice.InvoiceType, invoice.ItemName, invoice.TotalAmount, invoice.FileName)
+		_ = util.WriteAppendText(ctx.Writer, "\n")
+		_ = util.WriteAppendText(ctx.Writer, detailMsg)
+		if invoice.QRMismatch != "" {
+			_ = util.WriteAppendText(ctx.Writer, fmt.Sprintf("  - ⚠️ 与发票二维码不一致，已按二维码修正: %s\n", invoice.QRMismatch))
+		}
+		for _, violation := range invoice.Violations.BySeverity(models.RuleSeverityError) {
+			_ = util.WriteAppendText(ctx.Writer, fmt.Sprintf("  - ❗ %s\n", violation.Message))
+		}
+		for _, violation := range invoice.Violations.BySeverity(models.RuleSeverityWarning) {
+			_ = util.WriteAppendText(ctx.Writer, fmt.Sprintf("  - 提示：%s\n", violation.Message))
+		}
+		if invoice.IsBlockedDuplicate() {
+			_ = util.WriteAppendText(ctx.Writer, fmt.Sprintf("  - ⚠️ 疑似重复报销：%s，确认不是重复报销前不能填报\n", invoice.DuplicateReason))
+		}
+		if invoice.ReviewStatus == models.ReviewStatusPending {
+			lowFields := invoice.LowConfidenceFields(services.ReviewThreshold())
+			_ = util.WriteAppendText(ctx.Writer, fmt.Sprintf("  - 🔍 待人工审核，审核通过前不计入报销金额，低置信度字段: %s\n", strings.Join(lowFields, "、")))
+		}
+	}
+}
+
+// seedFromQRCode 识别发票二维码，预填发票号码、日期、金额
+func seedFromQRCode(invoiceFile *models.InvoiceFile, localFilePath, fileName string) {
+	if !qrcode.IsSupported(fileName) {
+		return
+	}
+	qr, err := qrcode.DecodeFile(localFilePath)
+	if err != nil {
+		log.Infof("未识别到发票二维码, file: %s, err: %v", fileName, err)
+		return
+	}
+	qr.Seed(invoiceFile)
+}
+
+// crossCheckQRCode 用上传时识别的二维码校验大模型返回的结果
+func (c *InvoiceFileController) crossCheckQRCode(invoiceFile *models.InvoiceFile) {
+	stored, err := c.invoiceFileService.GetInvoiceFileByFileID(invoiceFile.FileID)
+	if err != nil || stored.QRCode == "" {
+		return
+	}
+	qr, err := qrcode.ParsePayload(stored.QRCode)
+	if err != nil {
+		return
+	}
+	if mismatches := qr.Reconcile(invoiceFile); len(mismatches) > 0 {
+		log.Warnf("发票识别结果与二维码不一致, file_id: %s, %v", invoiceFile.FileID, mismatches)
 	}
 }
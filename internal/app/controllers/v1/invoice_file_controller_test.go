@@ -0,0 +1,116 @@
+package v1
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"invoice-agent/internal/app/models"
+	"invoice-agent/internal/app/services"
+)
+
+func TestFileParseChatReplaysRecognition(t *testing.T) {
+	invoiceFiles, reimbursement := fillingFakes(t, models.InvoiceFile{FileID: "file-fe-taxi", FileName: "taxi.pdf", SessionId: "parse-session"})
+
+	c := NewInvoiceFileController(invoiceFiles)
+	text, done := serveSSE(t, c.FileParseChat, models.ChatRequest{
+		SessionId: "parse-session",
+		Input:     "识别票据",
+		FileIds:   []string{"file-fe-taxi"},
+	})
+	if !done {
+		t.Fatal("事件流没有以 [DONE] 结束")
+	}
+	if !strings.Contains(text, "共解析1条发票记录") || !strings.Contains(text, "86.50元") {
+		t.Errorf("没有输出识别结果: %s", text)
+	}
+	if strings.Contains(text, "重新识别") {
+		t.Errorf("识别结果合法时不应重新识别: %s", text)
+	}
+
+	saved, _ := invoiceFiles.GetInvoiceFileByFileID("file-fe-taxi")
+	if saved.TotalAmount != 86.5 || saved.ExpenseCategory != "市内交通费" || saved.ReviewStatus != models.ReviewStatusAuto {
+		t.Errorf("保存的票据不正确: %+v", saved)
+	}
+	if len(reimbursement.advanced) != 1 || reimbursement.advanced[0] != models.ReimbursementStatusParsed {
+		t.Errorf("报销单状态推进为 %v，期望 parsed", reimbursement.advanced)
+	}
+}
+
+func TestFileParseChatRetriesInvalidOutput(t *testing.T) {
+	invoiceFiles, _ := fillingFakes(t, models.InvoiceFile{FileID: "file-fe-dinner", FileName: "dinner.pdf", SessionId: "retry-session"})
+
+	c := NewInvoiceFileController(invoiceFiles)
+	text, _ := serveSSE(t, c.FileParseChat, models.ChatRequest{
+		SessionId: "retry-session",
+		Input:     "识别票据",
+		FileIds:   []string{"file-fe-dinner"},
+	})
+	if !strings.Contains(text, "第1次重新识别") {
+		t.Errorf("第一次识别缺少文件时应重新识别: %s", text)
+	}
+	saved, _ := invoiceFiles.GetInvoiceFileByFileID("file-fe-dinner")
+	if saved.TotalAmount != 468 || saved.ExpenseCategory != "业务招待费" {
+		t.Errorf("重新识别后保存的票据不正确: %+v", saved)
+	}
+}
+
+func TestCorrectInvoiceFilePassesZeroAmounts(t *testing.T) {
+	invoiceFiles := newFakeInvoiceFiles()
+	c := NewInvoiceFileController(invoiceFiles)
+	engine := gin.New()
+	engine.PUT("/review/:id", c.CorrectInvoiceFile)
+
+	// 免税发票的税额修正为0，未传入的金额字段不修改
+	body := `{"amount": 86.5, "tax_amount": 0, "seller_name": "北京滴滴出行科技有限公司"}`
+	recorder := httptest.NewRecorder()
+	engine.ServeHTTP(recorder, httptest.NewRequest(http.MethodPut, "/review/1", strings.NewReader(body)))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("修正票据返回 %d: %s", recorder.Code, recorder.Body.String())
+	}
+	if len(invoiceFiles.zeroFields) != 1 || invoiceFiles.zeroFields[0] != "tax_amount" {
+		t.Errorf("修正为0的金额字段为 %v，期望 [tax_amount]", invoiceFiles.zeroFields)
+	}
+	if invoiceFiles.corrected.Amount != 86.5 || invoiceFiles.corrected.SellerName != "北京滴滴出行科技有限公司" {
+		t.Errorf("修正内容不正确: %+v", invoiceFiles.corrected)
+	}
+}
+
+// failingProvider 票据识别时模型服务返回错误
+type failingProvider struct {
+	services.ChatProvider
+}
+
+func (p *failingProvider) FileParseStream(ctx context.Context, req models.ChatRequest) (<-chan string, <-chan error) {
+	errorChan := make(chan error, 1)
+	errorChan <- errors.New("模型服务不可用")
+	return make(chan string), errorChan
+}
+
+func TestFileParseChatEndsStreamOnModelError(t *testing.T) {
+	invoiceFiles, reimbursement := fillingFakes(t, models.InvoiceFile{FileID: "file-fe-taxi", FileName: "taxi.pdf", SessionId: "error-session"})
+	oldChatClient := services.ChatClient
+	services.ChatClient = &failingProvider{}
+	t.Cleanup(func() { services.ChatClient = oldChatClient })
+
+	c := NewInvoiceFileController(invoiceFiles)
+	text, done := serveSSE(t, c.FileParseChat, models.ChatRequest{
+		SessionId: "error-session",
+		Input:     "识别票据",
+		FileIds:   []string{"file-fe-taxi"},
+	})
+	if !done {
+		t.Error("事件流没有以 [DONE] 结束")
+	}
+	if !strings.Contains(text, "票据识别失败: 模型服务不可用") {
+		t.Errorf("没有输出模型服务的错误: %s", text)
+	}
+	if len(reimbursement.advanced) != 0 {
+		t.Errorf("识别失败时不应推进报销单状态: %v", reimbursement.advanced)
+	}
+}
@@ -0,0 +1,134 @@
+package v1
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"invoice-agent/internal/app/controllers"
+	"invoice-agent/internal/app/models"
+	"invoice-agent/internal/app/services"
+)
+
+type ReimbursementController struct {
+	service services.IReimbursement
+}
+
+func NewReimbursementController(service services.IReimbursement) *ReimbursementController {
+	return &ReimbursementController{service: service}
+}
+
+// TransitionRequest 报销单状态流转请求
+type TransitionRequest struct {
+	Status  models.ReimbursementStatus `json:"status" binding:"required"`
+	Message string                     `json:"message"` // 流转到 failed 时的失败原因
+}
+
+// CreateReimbursement 创建报销单
+func (c *ReimbursementController) CreateReimbursement(ctx *gin.Context) {
+	var reimbursement models.Reimbursement
+	if err := ctx.ShouldBindJSON(&reimbursement); err != nil {
+		controllers.Response(ctx, http.StatusBadRequest, "参数错误", err)
+		return
+	}
+
+	if err := c.service.CreateReimbursement(&reimbursement); err != nil {
+		controllers.Response(ctx, http.StatusInternalServerError, "创建报销单失败", err)
+		return
+	}
+
+	controllers.Response(ctx, http.StatusOK, "创建成功", reimbursement)
+}
+
+// GetReimbursement 获取报销单，id 为数字时按主键查询，否则按报销单据编号查询
+func (c *ReimbursementController) GetReimbursement(ctx *gin.Context) {
+	var reimbursement *models.Reimbursement
+	var err error
+	if id, parseErr := strconv.ParseUint(ctx.Param("id"), 10, 64); parseErr == nil {
+		reimbursement, err = c.service.GetReimbursement(id)
+	} else {
+		reimbursement, err = c.service.GetReimbursementBySession(ctx.Param("id"))
+	}
+	if err != nil {
+		controllers.Response(ctx, http.StatusNotFound, "报销单不存在", "reimbursement not found")
+		return
+	}
+
+	controllers.Response(ctx, http.StatusOK, "获取成功", reimbursement)
+}
+
+// ListReimbursements 获取报销单列表
+func (c *ReimbursementController) ListReimbursements(ctx *gin.Context) {
+	limit, _ := strconv.Atoi(ctx.DefaultQuery("limit", "100"))
+	offset, _ := strconv.Atoi(ctx.DefaultQuery("offset", "0"))
+	status := models.ReimbursementStatus(ctx.Query("status"))
+
+	reimbursements, err := c.service.ListReimbursements(status, limit, offset)
+	if err != nil {
+		controllers.Response(ctx, http.StatusInternalServerError, "获取报销单列表失败", err)
+		return
+	}
+
+	controllers.Response(ctx, http.StatusOK, "获取成功", reimbursements)
+}
+
+// UpdateReimbursement 修改报销信息
+func (c *ReimbursementController) UpdateReimbursement(ctx *gin.Context) {
+	id, err := strconv.ParseUint(ctx.Param("id"), 10, 64)
+	if err != nil {
+		controllers.Response(ctx, http.StatusBadRequest, "参数错误", "invalid id")
+		return
+	}
+	var update models.Reimbursement
+	if err := ctx.ShouldBindJSON(&update); err != nil {
+		controllers.Response(ctx, http.StatusBadRequest, "参数错误", err)
+		return
+	}
+
+	reimbursement, err := c.service.UpdateReimbursement(id, &update)
+	if err != nil {
+		controllers.Response(ctx, http.StatusInternalServerError, "修改报销单失败", err.Error())
+		return
+	}
+
+	controllers.Response(ctx, http.StatusOK, "修改成功", reimbursement)
+}
+
+// DeleteReimbursement 删除报销单
+func (c *ReimbursementController) DeleteReimbursement(ctx *gin.Context) {
+	id, err := strconv.ParseUint(ctx.Param("id"), 10, 64)
+	if err != nil {
+		controllers.Response(ctx, http.StatusBadRequest, "参数错误", "invalid id")
+		return
+	}
+
+	if err := c.service.DeleteReimbursement(id); err != nil {
+		controllers.Response(ctx, http.StatusInternalServerError, "删除报销单失败", err.Error())
+		return
+	}
+
+	controllers.Response(ctx, http.StatusOK, "删除成功", nil)
+}
+
+// TransitionReimbursement 流转报销单状态
+func (c *ReimbursementController) TransitionReimbursement(ctx *gin.Context) {
+	id, err := strconv.ParseUint(ctx.Param("id"), 10, 64)
+	if err != nil {
+		controllers.Response(ctx, http.StatusBadRequest, "参数错误", "invalid id")
+		return
+	}
+	var req TransitionRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		controllers.Response(ctx, http.StatusBadRequest, "参数错误", err)
+		return
+	}
+
+	reimbursement, err := c.service.TransitionReimbursement(id, req.Status, req.Message)
+	if err != nil {
+		controllers.Response(ctx, http.StatusBadRequest, "报销单状态变更失败", err.Error())
+		return
+	}
+
+	controllers.Response(ctx, http.StatusOK, "状态变更成功", reimbursement)
+}
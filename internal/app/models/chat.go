@@ -4,8 +4,14 @@ package models
 // ChatRequest 聊天请求结构体
 type ChatRequest struct {
 	SessionId string   `json:"session_id"`
+	UserId    string   `json:"user_id"`                  // 填报时使用该用户保存的OA账号
 	Input     string   `json:"input" binding:"required"` // 用户输入
-	History   string   `json:"history,omitempty"`        // 对话历史
+	History   string   `json:"history,omitempty"`        // 已收集的报销信息
 	Parse     bool     `json:"parse"`
 	FileIds   []string `json:"file_ids"`
+	DryRun    bool     `json:"dry_run"` // 只预览填报计划，不保存到OA
+	Feedback  string   `json:"-"`       // 重新识别时附加的校验错误提示
+
+	Messages []ChatMessage `json:"-"` // 服务端保存的对话历史，按时间顺序
+	Usage    *TokenUsage   `json:"-"` // 不为空时由模型服务在流结束后写入token用量
 }
@@ -0,0 +1,56 @@
+package models
+
+import "time"
+
+// ChatRole 对话消息的角色
+type ChatRole string
+
+const (
+	ChatRoleUser      ChatRole = "user"
+	ChatRoleAssistant ChatRole = "assistant"
+)
+
+// TokenUsage 一次模型请求的token用量
+type TokenUsage struct {
+	PromptTokens     int64 `json:"prompt_tokens"`
+	CompletionTokens int64 `json:"completion_tokens"`
+	TotalTokens      int64 `json:"total_tokens"`
+}
+
+// ChatMessage 对话消息，按报销单据编号保存
+type ChatMessage struct {
+	ID               uint64    `gorm:"primaryKey;autoIncrement;comment:主键" json:"id"`
+	SessionId        string    `gorm:"size:100;not null;index;comment:报销单据编号" json:"session_id"`
+	UserId           string    `gorm:"size:100;default:null;index;comment:用户ID" json:"user_id,omitempty"`
+	Role             ChatRole  `gorm:"size:20;not null;comment:角色：user/assistant" json:"role"`
+	Content          string    `gorm:"type:mediumtext;comment:消息内容" json:"content"`
+	PromptTokens     int64     `gorm:"not null;default:0;comment:输入token数" json:"prompt_tokens"`
+	CompletionTokens int64     `gorm:"not null;default:0;comment:输出token数" json:"completion_tokens"`
+	TotalTokens      int64     `gorm:"not null;default:0;comment:总token数" json:"total_tokens"`
+	CreatedAt        time.Time `gorm:"type:datetime;not null;default:CURRENT_TIMESTAMP;comment:记录创建时间" json:"created_at"`
+}
+
+// TableName 指定表名
+func (ChatMessage) TableName() string {
+	return "chat_message"
+}
+
+// SetUsage 记录生成该消息的token用量
+func (m *ChatMessage) SetUsage(usage *TokenUsage) {
+	if usage == nil {
+		return
+	}
+	m.PromptTokens = usage.PromptTokens
+	m.CompletionTokens = usage.CompletionTokens
+	m.TotalTokens = usage.TotalTokens
+}
+
+// ChatSession 会话概要，由对话消息汇总得到
+type ChatSession struct {
+	SessionId     string    `json:"session_id"`
+	UserId        string    `json:"user_id,omitempty"`
+	Messages      int64     `json:"messages"`
+	TotalTokens   int64     `json:"total_tokens"`
+	StartedAt     time.Time `json:"started_at"`
+	LastMessageAt time.Time `json:"last_message_at"`
+}
@@ -0,0 +1,37 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ComputeIdentityKey 票据标识：发票号码|开票日期|销售方识别号|合计金额，
+// 日期统一为 YYYYMMDD，无法解析时保留原文，没有发票号码或金额的票据（如行程单）不参与标识比对
+func (i *InvoiceFile) ComputeIdentityKey() string {
+	code := strings.TrimSpace(i.InvoiceCode)
+	if code == "" || i.TotalAmount <= 0 {
+		return ""
+	}
+	date := strings.TrimSpace(i.IssueDate)
+	if t, ok := ParseIssueDate(date); ok {
+		date = t.Format("20060102")
+	}
+	sellerId := strings.ToUpper(strings.TrimSpace(i.SellerID))
+	return fmt.Sprintf("%s|%s|%s|%.2f", code, date, sellerId, i.TotalAmount)
+}
+
+// IsBlockedDuplicate 疑似重复报销且未被确认放行
+func (i *InvoiceFile) IsBlockedDuplicate() bool {
+	return i.DuplicateOf != "" && !i.DuplicateOverride
+}
+
+// BlockedDuplicates 疑似重复报销且未被确认放行的票据
+func BlockedDuplicates(files []InvoiceFile) []InvoiceFile {
+	duplicates := make([]InvoiceFile, 0)
+	for _, file := range files {
+		if file.IsBlockedDuplicate() {
+			duplicates = append(duplicates, file)
+		}
+	}
+	return duplicates
+}
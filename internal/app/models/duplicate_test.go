@@ -0,0 +1,32 @@
+package models
+
+import "testing"
+
+func TestComputeIdentityKey(t *testing.T) {
+	base := InvoiceFile{InvoiceCode: " 25312000000087654321 ", IssueDate: "2025年03月01日", SellerID: "91110000ma01abcd1x", TotalAmount: 1300}
+	want := "25312000000087654321|20250301|91110000MA01ABCD1X|1300.00"
+
+	// 同一天的不同写法得到相同的标识
+	for _, date := range []string{"2025年03月01日", "2025年3月1日", "2025-03-01", "2025/03/01", "20250301"} {
+		file := base
+		file.IssueDate = date
+		if key := file.ComputeIdentityKey(); key != want {
+			t.Errorf("开票日期 %s 的票据标识为 %q，期望 %q", date, key, want)
+		}
+	}
+
+	file := base
+	file.IssueDate = "三月一日"
+	if key := file.ComputeIdentityKey(); key != "25312000000087654321|三月一日|91110000MA01ABCD1X|1300.00" {
+		t.Errorf("无法解析的开票日期应保留原文: %q", key)
+	}
+
+	for name, file := range map[string]InvoiceFile{
+		"没有发票号码": {IssueDate: "2025年03月01日", TotalAmount: 1300},
+		"没有金额":   {InvoiceCode: "25312000000087654321", IssueDate: "2025年03月01日"},
+	} {
+		if key := file.ComputeIdentityKey(); key != "" {
+			t.Errorf("%s的票据不参与标识比对: %q", name, key)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package models
+
+import (
+	"crypto/sha256"
+	"database/sql/driver"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// PlanMatch 预览时字段取值的匹配方式
+type PlanMatch string
+
+const (
+	PlanMatchInput       PlanMatch = "input"        // 文本框直接填写
+	PlanMatchExact       PlanMatch = "exact"        // 下拉选项精确匹配
+	PlanMatchFuzzy       PlanMatch = "fuzzy"        // 下拉选项包含填写值
+	PlanMatchFirstOption PlanMatch = "first_option" // 无匹配项，选择第一个选项
+	PlanMatchOption      PlanMatch = "option"       // 按脚本配置的选项定位选择
+	PlanMatchNone        PlanMatch = "none"         // 没有可选项，未选择
+)
+
+// PlanField 预览计划中的一个字段
+type PlanField struct {
+	Step       string    `json:"step"`                 // 脚本步骤名称
+	Row        int       `json:"row,omitempty"`        // 报销明细的行号，从1开始
+	Value      string    `json:"value"`                // 计划填写的值
+	Selected   string    `json:"selected,omitempty"`   // 下拉框实际选中的选项
+	Match      PlanMatch `json:"match"`                // 匹配方式
+	Screenshot string    `json:"screenshot,omitempty"` // 填写后的截图文件名
+}
+
+// FillingPlan 预览模式生成的填报计划，执行到保存前停止
+type FillingPlan struct {
+	Digest     string      `json:"digest"` // 填报内容摘要，正式填报时内容须与确认的计划一致
+	Fields     []PlanField `json:"fields"`
+	Screenshot string      `json:"screenshot"` // 保存前整页截图文件名
+}
+
+func (p *FillingPlan) Value() (driver.Value, error) {
+	if p == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(p)
+	return string(data), err
+}
+
+func (p *FillingPlan) Scan(value interface{}) error {
+	var data []byte
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return fmt.Errorf("不支持的填报计划类型: %T", value)
+	}
+	if len(data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(data, p)
+}
+
+// AddField 追加字段
+func (p *FillingPlan) AddField(field PlanField) {
+	p.Fields = append(p.Fields, field)
+}
+
+// digestContent 参与摘要的填报内容：只取填到OA的值，费用明细和文件按固定顺序排列，
+// 票据记录的更新时间、校验结果等变化不影响摘要
+type digestContent struct {
+	BasicInfo    BasicItem    `json:"basic_info"`
+	PayInfo      PayItem      `json:"pay_info"`
+	CostItems    []digestCost `json:"cost_items"`
+	InvoiceFiles []string     `json:"invoice_files"`
+	OtherFiles   []string     `json:"other_files"`
+}
+
+type digestCost struct {
+	Category   string `json:"category"`
+	Name       string `json:"name"`
+	Comment    string `json:"comment"`
+	Cost       string `json:"cost"`
+	BillNumber string `json:"bill_number"`
+}
+
+// Digest 填报内容摘要，不包含OA账号
+func (r *AutoFillingRequest) Digest() string {
+	content := digestContent{
+		BasicInfo:    r.BasicInfo,
+		PayInfo:      r.PayInfo,
+		CostItems:    make([]digestCost, 0),
+		InvoiceFiles: sortedCopy(r.InvoiceFiles),
+		OtherFiles:   sortedCopy(r.OtherFiles),
+	}
+	if r.CostItems != nil {
+		for _, item := range *r.CostItems {
+			content.CostItems = append(content.CostItems, digestCost{
+				Category:   item.Category,
+				Name:       item.Name,
+				Comment:    item.Comment,
+				Cost:       item.Cost,
+				BillNumber: item.BillNumber,
+			})
+		}
+	}
+	sort.Slice(content.CostItems, func(i, j int) bool {
+		return content.CostItems[i].Category < content.CostItems[j].Category
+	})
+	data, _ := json.Marshal(content)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func sortedCopy(values []string) []string {
+	result := append(make([]string, 0, len(values)), values...)
+	sort.Strings(result)
+	return result
+}
@@ -0,0 +1,79 @@
+package models
+
+import (
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// FillingTask 自动填报任务记录，同一任务ID重新提交时会产生多条记录
+type FillingTask struct {
+	ID        uint64     `gorm:"primaryKey;autoIncrement;comment:主键" json:"id"`
+	TaskID    string     `gorm:"size:100;not null;index;comment:任务ID" json:"task_id"`
+	SessionId string     `gorm:"size:100;default:null;index;comment:报销单据编号" json:"session_id"`
+	Status    string     `gorm:"size:20;not null;comment:任务状态：pending/running/completed/failed/cancelled" json:"status"`
+	Progress  string     `gorm:"size:1000;default:null;comment:最新进度" json:"progress"`
+	Error     string     `gorm:"type:text;comment:失败原因" json:"error,omitempty"`
+	StartedAt time.Time  `gorm:"type:datetime;not null;comment:开始时间" json:"started_at"`
+	EndedAt   *time.Time `gorm:"type:datetime;default:null;comment:结束时间" json:"ended_at,omitempty"`
+
+	DryRun      bool         `gorm:"not null;default:false;comment:是否为预览任务" json:"dry_run"`
+	Digest      string       `gorm:"size:64;default:null;comment:填报内容摘要" json:"digest,omitempty"`
+	Plan        *FillingPlan `gorm:"type:mediumtext;comment:预览生成的填报计划" json:"plan,omitempty"`
+	ConfirmedAt *time.Time   `gorm:"type:datetime;default:null;comment:预览计划确认时间" json:"confirmed_at,omitempty"`
+
+	CreatedAt time.Time `gorm:"type:datetime;not null;default:CURRENT_TIMESTAMP;comment:记录创建时间" json:"created_at"`
+	UpdatedAt time.Time `gorm:"type:datetime;not null;default:CURRENT_TIMESTAMP;comment:最后更新时间" json:"updated_at"`
+}
+
+// TableName 指定表名
+func (FillingTask) TableName() string {
+	return "filling_task"
+}
+
+// FillingProgress 自动填报任务的进度日志
+type FillingProgress struct {
+	ID            uint64    `gorm:"primaryKey;autoIncrement;comment:主键" json:"id"`
+	FillingTaskID uint64    `gorm:"not null;index;comment:任务记录ID" json:"filling_task_id"`
+	TaskID        string    `gorm:"size:100;not null;comment:任务ID" json:"task_id"`
+	Seq           int       `gorm:"not null;comment:进度序号" json:"seq"`
+	Message       string    `gorm:"type:text;comment:进度内容" json:"message"`
+	CreatedAt     time.Time `gorm:"type:datetime(3);not null;comment:记录时间" json:"created_at"`
+}
+
+// TableName 指定表名
+func (FillingProgress) TableName() string {
+	return "filling_progress"
+}
+
+// ArtifactKind 任务文件类型
+type ArtifactKind string
+
+const (
+	ArtifactScreenshot ArtifactKind = "screenshot"
+	ArtifactHTML       ArtifactKind = "html"
+	ArtifactTrace      ArtifactKind = "trace"
+	ArtifactOther      ArtifactKind = "other"
+)
+
+// TaskArtifact 填报任务保存的截图、页面快照或追踪文件
+type TaskArtifact struct {
+	Name      string       `json:"name"`
+	Kind      ArtifactKind `json:"kind"`
+	Size      int64        `json:"size"`
+	CreatedAt time.Time    `json:"created_at"`
+}
+
+// ArtifactKindOf 按扩展名判断文件类型
+func ArtifactKindOf(name string) ArtifactKind {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".png", ".jpg", ".jpeg":
+		return ArtifactScreenshot
+	case ".html":
+		return ArtifactHTML
+	case ".zip":
+		return ArtifactTrace
+	default:
+		return ArtifactOther
+	}
+}
@@ -1,7 +1,11 @@
 package models
 
 import (
+	"database/sql/driver"
+	"encoding/json"
 	"fmt"
+	"sort"
+	"strings"
 	"time"
 )
 
@@ -20,8 +24,22 @@ const (
 	ExpenseCategoryTransport     ExpenseCategory = "市内交通费"
 	ExpenseCategoryEntertainment ExpenseCategory = "业务招待费"
 	ExpenseCategoryTravel        ExpenseCategory = "差旅费"
+	ExpenseCategoryOther         ExpenseCategory = "其他"
 )
 
+// LocalFileIDPrefix 本地解析（未上传到大模型）的文件ID前缀
+const LocalFileIDPrefix = "local-"
+
+// NewLocalFileID 生成本地解析文件的唯一ID
+func NewLocalFileID() string {
+	return fmt.Sprintf("%s%d", LocalFileIDPrefix, time.Now().UnixNano())
+}
+
+// IsLocalFileID 文件是否为本地解析，本地文件不存在于大模型文件服务中
+func IsLocalFileID(fileId string) bool {
+	return strings.HasPrefix(fileId, LocalFileIDPrefix)
+}
+
 // 数据结构定义
 type CostItem struct {
 	Category   string        `json:"category"`    // 费用类别名称
@@ -52,10 +70,11 @@ type AutoFillingRequest struct {
 	BasicInfo    BasicItem   `json:"basic_info"`
 	PayInfo      PayItem     `json:"pay_info"`
 	CostItems    *[]CostItem `json:"cost_items"`
-	Username     string      `json:"username"`
-	Password     string      `json:"password"`
+	Username     string      `json:"-"` // OA账号，从账号库读取，不接受外部传入
+	Password     string      `json:"-"`
 	InvoiceFiles []string    `json:"invoice_files"`
 	OtherFiles   []string    `json:"other_files"`
+	DryRun       bool        `json:"-"` // 预览模式，执行到保存前停止并生成填报计划
 }
 
 // ExpenseCategoryStats 费用类别统计结果
@@ -66,14 +85,19 @@ type ExpenseCategoryStats struct {
 	Invoices     []InvoiceFile `json:"invoices"`      // 该类别下的所有票据
 }
 
-// 整理发票和非发票文件
+// 整理发票和非发票文件，已关联发票的行程单紧跟在发票后一起上传
 func CollateFile(files []InvoiceFile, autoFillingRequest *AutoFillingRequest) error {
 	invoiceFiles := make([]string, 0)
 	otherFiles := make([]string, 0)
 	for _, invoice := range files {
 		if invoice.ServiceType == ServiceTypeInvoice {
 			invoiceFiles = append(invoiceFiles, invoice.FilePath)
-		} else {
+			for _, child := range files {
+				if child.ParentID == invoice.ID {
+					invoiceFiles = append(invoiceFiles, child.FilePath)
+				}
+			}
+		} else if !invoice.IsAttachmentOf(files) {
 			otherFiles = append(otherFiles, invoice.FilePath)
 		}
 	}
@@ -88,10 +112,19 @@ func CollateFile(files []InvoiceFile, autoFillingRequest *AutoFillingRequest) er
 func StatByExpenseCategory(invoices []InvoiceFile) *[]CostItem {
 	var result []CostItem
 	stats := make(map[string]*ExpenseCategoryStats)
+	categories := make(map[uint64]ExpenseCategory, len(invoices))
+	for _, invoice := range invoices {
+		categories[invoice.ID] = invoice.ExpenseCategory
+	}
 
 	// 遍历所有发票文件
 	for _, invoice := range invoices {
 		category := string(invoice.ExpenseCategory)
+		// 关联的行程单随发票计入同一费用类别，不单独产生明细
+		attachment := invoice.IsAttachmentOf(invoices)
+		if attachment {
+			category = string(categories[invoice.ParentID])
+		}
 
 		// 如果该类别还没有统计信息，创建新的
 		if _, exists := stats[category]; !exists {
@@ -103,8 +136,10 @@ func StatByExpenseCategory(invoices []InvoiceFile) *[]CostItem {
 			}
 		}
 
-		// 累计票据数
-		stats[category].TicketCount++
+		// 累计票据数，发票和关联的行程单算一张
+		if !attachment {
+			stats[category].TicketCount++
+		}
 
 		// 如果是发票类型（service_type为1），累计金额
 		if invoice.ServiceType == ServiceTypeInvoice {
@@ -126,6 +161,10 @@ func StatByExpenseCategory(invoices []InvoiceFile) *[]CostItem {
 		}
 		result = append(result, costItem)
 	}
+	// 按费用类别排序，预览和正式填报的明细顺序一致
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Category < result[j].Category
+	})
 
 	return &result
 }
@@ -133,25 +172,87 @@ func StatByExpenseCategory(invoices []InvoiceFile) *[]CostItem {
 type InvoiceFile struct {
 	ID              uint64          `gorm:"primaryKey;autoIncrement;comment:主键" json:"id"`
 	SessionId       string          `gorm:"size:100;default:null;comment:报销单据编号" json:"session_id"`
-	InvoiceType     string          `gorm:"size:100;default:null;comment:票据类型" json:"invoice_type"`
-	InvoiceCode     string          `gorm:"size:100;default:null;comment:发票号码" json:"invoice_code"`
-	IssueDate       string          `gorm:"size:20;default:null;comment:开票日期" json:"issue_date"`
-	ServiceType     ServiceType     `gorm:"not null;comment:服务类型：1=发票类，2=非发票类" json:"service_type"`
-	Amount          float64         `gorm:"type:decimal(10,2);default:null;comment:金额（不含税）" json:"amount"`
-	TaxAmount       float64         `gorm:"type:decimal(10,2);default:null;comment:税额" json:"tax_amount"`
-	TotalAmount     float64         `gorm:"type:decimal(10,2);not null;comment:合计金额" json:"total_amount"`
-	BuyerName       string          `gorm:"size:100;default:null;comment:购买方名称" json:"buyer_name"`
-	BuyerID         string          `gorm:"size:100;default:null;comment:购买方识别号" json:"buyer_id"`
-	SellerName      string          `gorm:"size:100;default:null;comment:销售方名称" json:"seller_name"`
-	SellerID        string          `gorm:"size:100;default:null;comment:销售方识别号" json:"seller_id"`
-	ItemName        string          `gorm:"size:100;default:null;comment:项目名称" json:"item_name"`
-	ExpenseCategory ExpenseCategory `gorm:"size:100;default:null;comment:费用类别" json:"expense_category"`
-	FileName        string          `gorm:"size:500;not null;comment:原始文件名" json:"file_name"`
+	InvoiceType     string          `gorm:"size:100;default:null;comment:票据类型" json:"invoice_type" schema:"required"`
+	InvoiceCode     string          `gorm:"size:100;default:null;comment:发票号码" json:"invoice_code" schema:"required"`
+	IssueDate       string          `gorm:"size:20;default:null;comment:开票日期" json:"issue_date" schema:"required"`
+	ServiceType     ServiceType     `gorm:"not null;comment:服务类型：1=发票类，2=非发票类" json:"service_type" schema:"required,enum=1|2"`
+	Amount          float64         `gorm:"type:decimal(10,2);default:null;comment:金额（不含税）" json:"amount" schema:"required"`
+	TaxAmount       float64         `gorm:"type:decimal(10,2);default:null;comment:税额" json:"tax_amount" schema:"required"`
+	TotalAmount     float64         `gorm:"type:decimal(10,2);not null;index;comment:合计金额" json:"total_amount" schema:"required"`
+	BuyerName       string          `gorm:"size:100;default:null;comment:购买方名称" json:"buyer_name" schema:"required"`
+	BuyerID         string          `gorm:"size:100;default:null;comment:购买方识别号" json:"buyer_id" schema:"required"`
+	SellerName      string          `gorm:"size:100;default:null;comment:销售方名称" json:"seller_name" schema:"required"`
+	SellerID        string          `gorm:"size:100;default:null;comment:销售方识别号" json:"seller_id" schema:"required"`
+	ItemName        string          `gorm:"size:100;default:null;comment:项目名称" json:"item_name" schema:"required"`
+	ExpenseCategory ExpenseCategory `gorm:"size:100;default:null;comment:费用类别" json:"expense_category" schema:"required,enum=市内交通费|业务招待费|差旅费|其他"`
+	FileName        string          `gorm:"size:500;not null;comment:原始文件名" json:"file_name" schema:"required,minLength=1"`
 	FilePath        string          `gorm:"size:1000;default:null;comment:文件路径" json:"file_path"` // 记录文件路径
-	FileID          string          `gorm:"size:100;not null;uniqueIndex;comment:文件唯一ID" json:"file_id"`
+	FileID          string          `gorm:"size:100;not null;uniqueIndex;comment:文件唯一ID" json:"file_id" schema:"required,minLength=1"`
 	MD5             string          `gorm:"size:32;default:null;comment:文件MD5值" json:"md5"` // 新增MD5字段
+	SHA256          string          `gorm:"size:64;default:null;index;comment:文件SHA-256值" json:"sha256"`
+	QRCode          string          `gorm:"size:255;default:null;comment:发票二维码内容" json:"qr_code"`
+	QRMismatch      string          `gorm:"size:1000;default:null;comment:二维码与识别结果不一致的字段" json:"qr_mismatch"`
+	FieldMeta       FieldMetas      `gorm:"type:text;comment:字段置信度与来源" json:"field_meta,omitempty"`
+	ReviewStatus    ReviewStatus    `gorm:"size:20;default:null;index;comment:审核状态：auto/pending/approved" json:"review_status"`
 	CreatedAt       time.Time       `gorm:"type:datetime;not null;default:CURRENT_TIMESTAMP;comment:记录创建时间" json:"created_at"`
 	UpdatedAt       time.Time       `gorm:"type:datetime;not null;default:CURRENT_TIMESTAMP;comment:最后更新时间" json:"updated_at"`
+
+	// 重复报销检测
+	IdentityKey       string `gorm:"size:200;default:null;index;comment:票据标识：发票号码|开票日期|销售方识别号|合计金额" json:"identity_key,omitempty"`
+	ImageHash         string `gorm:"size:16;default:null;comment:图片感知哈希" json:"image_hash,omitempty"`
+	DuplicateOf       string `gorm:"size:100;default:null;comment:疑似重复的票据文件ID" json:"duplicate_of,omitempty"`
+	DuplicateReason   string `gorm:"size:500;default:null;comment:疑似重复的原因" json:"duplicate_reason,omitempty"`
+	DuplicateOverride bool   `gorm:"not null;default:false;comment:已确认不是重复报销" json:"duplicate_override"`
+
+	// 业务规则校验
+	Violations RuleViolations `gorm:"type:text;comment:业务规则校验结果" json:"violations,omitempty"`
+
+	// 行程单等附件关联到对应的发票，按一项费用计数和上传
+	ParentID uint64 `gorm:"not null;default:0;index;comment:所属发票的ID，0表示没有关联" json:"parent_id,omitempty"`
+
+	Items           InvoiceItems       `gorm:"type:text;comment:发票明细" json:"items,omitempty"` // 发票明细，仅本地解析时有值
+	FieldConfidence map[string]float64 `gorm:"-" json:"field_confidence,omitempty"`           // 大模型给出的字段置信度
+}
+
+// InvoiceItem 发票项目明细
+type InvoiceItem struct {
+	Name      string  `json:"name"`
+	Unit      string  `json:"unit,omitempty"`     // 计量单位，如住宿的“晚”
+	Quantity  float64 `json:"quantity,omitempty"` // 数量
+	Amount    float64 `json:"amount"`
+	TaxRate   string  `json:"tax_rate"`
+	TaxAmount float64 `json:"tax_amount"`
+}
+
+// InvoiceItems 发票项目明细，以JSON存储
+type InvoiceItems []InvoiceItem
+
+func (v InvoiceItems) Value() (driver.Value, error) {
+	if len(v) == 0 {
+		return nil, nil
+	}
+	data, err := json.Marshal(v)
+	return string(data), err
+}
+
+func (v *InvoiceItems) Scan(value interface{}) error {
+	var data []byte
+	switch val := value.(type) {
+	case nil:
+		*v = nil
+		return nil
+	case []byte:
+		data = val
+	case string:
+		data = []byte(val)
+	default:
+		return fmt.Errorf("不支持的发票明细类型: %T", value)
+	}
+	if len(data) == 0 {
+		*v = nil
+		return nil
+	}
+	return json.Unmarshal(data, v)
 }
 
 // TableName 指定表名
@@ -184,3 +285,19 @@ func (i *InvoiceFile) Validate() error {
 	}
 	return nil
 }
+
+// issueDateLayouts 识别结果和本地解析中出现过的开票日期格式
+var issueDateLayouts = []string{
+	"2006年01月02日", "2006年1月2日", "2006-01-02", "2006/01/02", "20060102", "2006-01-02 15:04:05",
+}
+
+// ParseIssueDate 解析开票日期，按本地时区
+func ParseIssueDate(value string) (time.Time, bool) {
+	value = strings.TrimSpace(value)
+	for _, layout := range issueDateLayouts {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
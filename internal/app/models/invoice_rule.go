@@ -0,0 +1,70 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+)
+
+// RuleSeverity 业务规则校验结果的严重程度
+type RuleSeverity string
+
+const (
+	RuleSeverityError   RuleSeverity = "error"   // 票据信息有误，需要修正
+	RuleSeverityWarning RuleSeverity = "warning" // 可能有误，建议人工确认
+)
+
+// RuleViolation 一条不符合业务规则的结果
+type RuleViolation struct {
+	Rule     string       `json:"rule"`
+	Field    string       `json:"field"`
+	Severity RuleSeverity `json:"severity"`
+	Message  string       `json:"message"`
+}
+
+// RuleViolations 票据的业务规则校验结果，以JSON存储
+type RuleViolations []RuleViolation
+
+func (v RuleViolations) Value() (driver.Value, error) {
+	if len(v) == 0 {
+		return nil, nil
+	}
+	data, err := json.Marshal(v)
+	return string(data), err
+}
+
+func (v *RuleViolations) Scan(value interface{}) error {
+	var data []byte
+	switch val := value.(type) {
+	case nil:
+		*v = nil
+		return nil
+	case []byte:
+		data = val
+	case string:
+		data = []byte(val)
+	default:
+		return fmt.Errorf("不支持的规则校验结果类型: %T", value)
+	}
+	if len(data) == 0 {
+		*v = nil
+		return nil
+	}
+	return json.Unmarshal(data, v)
+}
+
+// BySeverity 指定严重程度的校验结果
+func (v RuleViolations) BySeverity(severity RuleSeverity) RuleViolations {
+	result := make(RuleViolations, 0)
+	for _, violation := range v {
+		if violation.Severity == severity {
+			result = append(result, violation)
+		}
+	}
+	return result
+}
+
+// HasErrors 是否有需要修正的错误
+func (v RuleViolations) HasErrors() bool {
+	return len(v.BySeverity(RuleSeverityError)) > 0
+}
@@ -0,0 +1,28 @@
+package models
+
+import "time"
+
+// OACredential 员工的OA登录账号，密码使用主密钥加密保存
+type OACredential struct {
+	ID             uint64     `gorm:"primaryKey;autoIncrement;comment:主键" json:"id"`
+	UserId         string     `gorm:"size:100;not null;uniqueIndex;comment:用户ID" json:"user_id"`
+	Username       string     `gorm:"size:100;not null;comment:OA账号" json:"username"`
+	PasswordCipher string     `gorm:"type:text;not null;comment:加密后的OA密码" json:"-"`
+	RotatedAt      *time.Time `gorm:"type:datetime;default:null;comment:最近一次更换密码时间" json:"rotated_at,omitempty"`
+	TestedAt       *time.Time `gorm:"type:datetime;default:null;comment:最近一次登录测试时间" json:"tested_at,omitempty"`
+	TestError      string     `gorm:"size:1000;default:null;comment:最近一次登录测试失败原因" json:"test_error,omitempty"`
+	CreatedAt      time.Time  `gorm:"type:datetime;not null;default:CURRENT_TIMESTAMP;comment:记录创建时间" json:"created_at"`
+	UpdatedAt      time.Time  `gorm:"type:datetime;not null;default:CURRENT_TIMESTAMP;comment:最后更新时间" json:"updated_at"`
+}
+
+// TableName 指定表名
+func (OACredential) TableName() string {
+	return "oa_credential"
+}
+
+// CredentialRequest 设置/更换/测试OA账号的请求
+type CredentialRequest struct {
+	UserId   string `json:"user_id" binding:"required"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
@@ -0,0 +1,108 @@
+package models
+
+import (
+	"math"
+	"sort"
+	"strings"
+)
+
+// 配对时允许的金额误差和开票日期与行程日期的最大间隔
+const (
+	pairAmountTolerance = 0.01
+	pairMaxDays         = 30
+)
+
+// PairItineraries 把非发票类的行程单与金额相同的发票配对，返回 行程单ID -> 发票ID。
+// 金额必须一致，日期越近、销售方越相似越优先，每张发票只关联一张行程单
+func PairItineraries(files []InvoiceFile) map[uint64]uint64 {
+	type candidate struct {
+		child, parent uint64
+		score         float64
+	}
+	candidates := make([]candidate, 0)
+	for _, child := range files {
+		if child.ServiceType != ServiceTypeNonInvoice || child.TotalAmount <= 0 {
+			continue
+		}
+		for _, parent := range files {
+			if parent.ServiceType != ServiceTypeInvoice || parent.ID == child.ID {
+				continue
+			}
+			if score, ok := pairScore(&parent, &child); ok {
+				candidates = append(candidates, candidate{child: child.ID, parent: parent.ID, score: score})
+			}
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].score != candidates[j].score {
+			return candidates[i].score > candidates[j].score
+		}
+		if candidates[i].child != candidates[j].child {
+			return candidates[i].child < candidates[j].child
+		}
+		return candidates[i].parent < candidates[j].parent
+	})
+
+	pairs := make(map[uint64]uint64)
+	paired := make(map[uint64]bool)
+	for _, c := range candidates {
+		if _, exists := pairs[c.child]; exists || paired[c.parent] {
+			continue
+		}
+		pairs[c.child] = c.parent
+		paired[c.parent] = true
+	}
+	return pairs
+}
+
+// pairScore 行程单与发票的匹配程度，金额不一致或日期相差太远时不能配对
+func pairScore(invoice, itinerary *InvoiceFile) (float64, bool) {
+	if math.Abs(invoice.TotalAmount-itinerary.TotalAmount) > pairAmountTolerance {
+		return 0, false
+	}
+	score := 1.0
+	invoiceDate, ok1 := ParseIssueDate(invoice.IssueDate)
+	itineraryDate, ok2 := ParseIssueDate(itinerary.IssueDate)
+	if ok1 && ok2 {
+		days := math.Abs(invoiceDate.Sub(itineraryDate).Hours() / 24)
+		if days > pairMaxDays {
+			return 0, false
+		}
+		score += 1 - days/pairMaxDays
+	}
+	if similarSeller(invoice.SellerName, itinerary.SellerName) {
+		score++
+	}
+	return score, true
+}
+
+// similarSeller 销售方是否为同一家，行程单上通常是平台简称，如“滴滴出行”与“北京滴滴出行科技有限公司”
+func similarSeller(a, b string) bool {
+	a, b = sellerCore(a), sellerCore(b)
+	if a == "" || b == "" {
+		return false
+	}
+	return strings.Contains(a, b) || strings.Contains(b, a)
+}
+
+// sellerCore 去掉销售方名称中的公司后缀和括号
+func sellerCore(name string) string {
+	name = strings.NewReplacer("（", "", "）", "", "(", "", ")", "", " ", "").Replace(name)
+	for _, suffix := range []string{"有限责任公司", "股份有限公司", "有限公司", "公司"} {
+		name = strings.TrimSuffix(name, suffix)
+	}
+	return name
+}
+
+// IsAttachmentOf 是否为列表中某张发票的附件，发票不在列表中时单独计算
+func (i *InvoiceFile) IsAttachmentOf(files []InvoiceFile) bool {
+	if i.ParentID == 0 {
+		return false
+	}
+	for _, f := range files {
+		if f.ID == i.ParentID {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,43 @@
+package models
+
+import "testing"
+
+func TestPairItineraries(t *testing.T) {
+	files := []InvoiceFile{
+		{ID: 1, ServiceType: ServiceTypeInvoice, TotalAmount: 50, IssueDate: "2025年03月01日", SellerName: "北京滴滴出行科技有限公司"},
+		{ID: 2, ServiceType: ServiceTypeInvoice, TotalAmount: 50, IssueDate: "2025年03月20日", SellerName: "北京首汽约车有限公司"},
+		{ID: 3, ServiceType: ServiceTypeNonInvoice, TotalAmount: 50, IssueDate: "2025年03月02日", SellerName: "滴滴出行"},
+		{ID: 4, ServiceType: ServiceTypeNonInvoice, TotalAmount: 80, IssueDate: "2025年03月02日", SellerName: "滴滴出行"},
+	}
+	pairs := PairItineraries(files)
+	if len(pairs) != 1 || pairs[3] != 1 {
+		t.Errorf("行程单3应与日期和销售方都接近的发票1配对，金额不同的行程单4不配对: %v", pairs)
+	}
+}
+
+func TestStatByExpenseCategoryFoldsAttachments(t *testing.T) {
+	files := []InvoiceFile{
+		{ID: 1, ServiceType: ServiceTypeInvoice, TotalAmount: 50, ExpenseCategory: ExpenseCategoryTransport},
+		// 行程单识别为差旅费，但已关联到市内交通费的发票
+		{ID: 2, ServiceType: ServiceTypeNonInvoice, TotalAmount: 50, ExpenseCategory: ExpenseCategoryTravel, ParentID: 1},
+		{ID: 3, ServiceType: ServiceTypeInvoice, TotalAmount: 300, ExpenseCategory: ExpenseCategoryEntertainment},
+	}
+	items := *StatByExpenseCategory(files)
+	if len(items) != 2 {
+		t.Fatalf("关联的行程单不应单独产生明细: %+v", items)
+	}
+	for _, item := range items {
+		if item.Category != string(ExpenseCategoryTransport) {
+			continue
+		}
+		if item.Cost != "50.00" || item.BillNumber != "1" || len(item.Invoices) != 2 {
+			t.Errorf("市内交通费 %s元 %s张 %d个文件，期望 50.00元 1张 2个文件", item.Cost, item.BillNumber, len(item.Invoices))
+		}
+	}
+
+	// 发票不在本次报销中时，行程单单独计算
+	items = *StatByExpenseCategory(files[1:])
+	if len(items) != 2 {
+		t.Fatalf("发票不在列表中时行程单应按自己的类别统计: %+v", items)
+	}
+}
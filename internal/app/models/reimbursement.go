@@ -0,0 +1,127 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// ReimbursementStatus 报销单状态
+type ReimbursementStatus string
+
+const (
+	ReimbursementStatusDraft      ReimbursementStatus = "draft"      // 草稿，刚创建
+	ReimbursementStatusCollecting ReimbursementStatus = "collecting" // 收集票据中
+	ReimbursementStatusParsed     ReimbursementStatus = "parsed"     // 票据已识别
+	ReimbursementStatusConfirmed  ReimbursementStatus = "confirmed"  // 报销信息已确认
+	ReimbursementStatusSubmitting ReimbursementStatus = "submitting" // 正在填报OA
+	ReimbursementStatusSubmitted  ReimbursementStatus = "submitted"  // 已填报到OA
+	ReimbursementStatusFailed     ReimbursementStatus = "failed"     // 填报失败
+)
+
+// reimbursementTransitions 允许的状态流转，未列出的流转一律拒绝
+var reimbursementTransitions = map[ReimbursementStatus][]ReimbursementStatus{
+	ReimbursementStatusDraft:      {ReimbursementStatusCollecting},
+	ReimbursementStatusCollecting: {ReimbursementStatusParsed},
+	// 识别后仍可补充票据、修改报销信息
+	ReimbursementStatusParsed:     {ReimbursementStatusCollecting, ReimbursementStatusConfirmed},
+	ReimbursementStatusConfirmed:  {ReimbursementStatusCollecting, ReimbursementStatusParsed, ReimbursementStatusSubmitting},
+	ReimbursementStatusSubmitting: {ReimbursementStatusSubmitted, ReimbursementStatusFailed},
+	ReimbursementStatusSubmitted:  {},
+	// 失败后可修改后重新确认，或直接重新提交
+	ReimbursementStatusFailed: {ReimbursementStatusCollecting, ReimbursementStatusConfirmed, ReimbursementStatusSubmitting},
+}
+
+// IsValid 是否为已定义的状态
+func (s ReimbursementStatus) IsValid() bool {
+	_, ok := reimbursementTransitions[s]
+	return ok
+}
+
+// CanTransition 是否允许从 from 流转到 to
+func CanTransition(from, to ReimbursementStatus) bool {
+	for _, next := range reimbursementTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// TransitionPath 从 from 到 to 经过的最少的状态，不含 from，无法到达时返回nil
+func TransitionPath(from, to ReimbursementStatus) []ReimbursementStatus {
+	if from == to {
+		return []ReimbursementStatus{}
+	}
+	previous := map[ReimbursementStatus]ReimbursementStatus{from: from}
+	queue := []ReimbursementStatus{from}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		for _, next := range reimbursementTransitions[current] {
+			if _, visited := previous[next]; visited {
+				continue
+			}
+			previous[next] = current
+			if next == to {
+				path := []ReimbursementStatus{to}
+				for status := current; status != from; status = previous[status] {
+					path = append([]ReimbursementStatus{status}, path...)
+				}
+				return path
+			}
+			queue = append(queue, next)
+		}
+	}
+	return nil
+}
+
+// Reimbursement 报销单，票据通过 SessionId 关联
+type Reimbursement struct {
+	ID          uint64              `gorm:"primaryKey;autoIncrement;comment:主键" json:"id"`
+	SessionId   string              `gorm:"size:100;not null;uniqueIndex;comment:报销单据编号" json:"session_id"`
+	Title       string              `gorm:"size:200;default:null;comment:报销主题" json:"title"`
+	Status      ReimbursementStatus `gorm:"size:20;not null;index;comment:状态：draft/collecting/parsed/confirmed/submitting/submitted/failed" json:"status"`
+	BasicInfo   BasicItem           `gorm:"type:text;serializer:json;comment:基本信息" json:"basic_info"`
+	PayInfo     PayItem             `gorm:"type:text;serializer:json;comment:支付信息" json:"pay_info"`
+	CostItems   []CostItem          `gorm:"type:mediumtext;serializer:json;comment:费用明细" json:"cost_items"`
+	Error       string              `gorm:"size:1000;default:null;comment:最近一次失败原因" json:"error,omitempty"`
+	SubmittedAt *time.Time          `gorm:"type:datetime;default:null;comment:填报完成时间" json:"submitted_at,omitempty"`
+	CreatedAt   time.Time           `gorm:"type:datetime;not null;default:CURRENT_TIMESTAMP;comment:记录创建时间" json:"created_at"`
+	UpdatedAt   time.Time           `gorm:"type:datetime;not null;default:CURRENT_TIMESTAMP;comment:最后更新时间" json:"updated_at"`
+
+	InvoiceFiles []InvoiceFile `gorm:"-" json:"invoice_files,omitempty"` // 关联的票据
+}
+
+// TableName 指定表名
+func (Reimbursement) TableName() string {
+	return "reimbursement"
+}
+
+// NewReimbursementSessionID 未指定编号时生成报销单据编号
+func NewReimbursementSessionID() string {
+	return fmt.Sprintf("rb-%d", time.Now().UnixNano())
+}
+
+// Transition 校验并切换状态
+func (r *Reimbursement) Transition(to ReimbursementStatus) error {
+	if !to.IsValid() {
+		return fmt.Errorf("未知的报销单状态: %s", to)
+	}
+	if !CanTransition(r.Status, to) {
+		return fmt.Errorf("报销单状态不能从 %s 变更为 %s", r.Status, to)
+	}
+	r.Status = to
+	return nil
+}
+
+// ApplyFillingRequest 记录确认后的报销信息
+func (r *Reimbursement) ApplyFillingRequest(req *AutoFillingRequest) {
+	r.BasicInfo = req.BasicInfo
+	r.PayInfo = req.PayInfo
+	if req.CostItems != nil {
+		r.CostItems = *req.CostItems
+	}
+	if req.BasicInfo.Title != "" {
+		r.Title = req.BasicInfo.Title
+	}
+}
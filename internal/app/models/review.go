@@ -0,0 +1,137 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+)
+
+// FieldSource 字段值的来源
+type FieldSource string
+
+const (
+	FieldSourceLLM    FieldSource = "llm"    // 大模型识别
+	FieldSourceQR     FieldSource = "qr"     // 发票二维码
+	FieldSourceOFD    FieldSource = "ofd"    // OFD/XML结构化数据
+	FieldSourceManual FieldSource = "manual" // 人工修正
+)
+
+// ReviewStatus 人工审核状态
+type ReviewStatus string
+
+const (
+	ReviewStatusAuto     ReviewStatus = "auto"     // 置信度达标，无需审核
+	ReviewStatusPending  ReviewStatus = "pending"  // 待人工审核
+	ReviewStatusApproved ReviewStatus = "approved" // 已人工审核通过
+)
+
+// ReviewFields 需要记录置信度的识别字段
+var ReviewFields = []string{
+	"invoice_type", "invoice_code", "issue_date", "service_type",
+	"amount", "tax_amount", "total_amount",
+	"buyer_name", "buyer_id", "seller_name", "seller_id",
+	"item_name", "expense_category",
+}
+
+// FieldMeta 单个字段的置信度与来源
+type FieldMeta struct {
+	Confidence float64     `json:"confidence"`
+	Source     FieldSource `json:"source"`
+}
+
+// FieldMetas 字段名(json) -> FieldMeta，以JSON存储
+type FieldMetas map[string]FieldMeta
+
+func (m FieldMetas) Value() (driver.Value, error) {
+	if m == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(m)
+	return string(data), err
+}
+
+func (m *FieldMetas) Scan(value interface{}) error {
+	var data []byte
+	switch v := value.(type) {
+	case nil:
+		*m = nil
+		return nil
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return fmt.Errorf("不支持的字段置信度类型: %T", value)
+	}
+	if len(data) == 0 {
+		*m = nil
+		return nil
+	}
+	return json.Unmarshal(data, m)
+}
+
+// SetFieldSource 设置字段的来源与置信度
+func (i *InvoiceFile) SetFieldSource(source FieldSource, confidence float64, fields ...string) {
+	if i.FieldMeta == nil {
+		i.FieldMeta = make(FieldMetas)
+	}
+	for _, field := range fields {
+		i.FieldMeta[field] = FieldMeta{Confidence: confidence, Source: source}
+	}
+}
+
+// ApplyLLMConfidence 为没有来源信息的字段补充大模型给出的置信度，
+// 模型未给出置信度的字段无法确认识别结果，按置信度0计，票据进入人工审核
+func (i *InvoiceFile) ApplyLLMConfidence() {
+	for _, field := range ReviewFields {
+		if _, exists := i.FieldMeta[field]; exists {
+			continue
+		}
+		i.SetFieldSource(FieldSourceLLM, i.FieldConfidence[field], field)
+	}
+}
+
+// MinConfidence 识别字段中最低的置信度，没有记录时视为完全可信
+func (i *InvoiceFile) MinConfidence() float64 {
+	min := 1.0
+	for _, field := range ReviewFields {
+		if meta, exists := i.FieldMeta[field]; exists && meta.Confidence < min {
+			min = meta.Confidence
+		}
+	}
+	return min
+}
+
+// UpdateReviewStatus 根据阈值判断是否需要人工审核
+func (i *InvoiceFile) UpdateReviewStatus(threshold float64) {
+	if i.MinConfidence() < threshold {
+		i.ReviewStatus = ReviewStatusPending
+	} else {
+		i.ReviewStatus = ReviewStatusAuto
+	}
+}
+
+// LowConfidenceFields 置信度低于阈值的字段
+func (i *InvoiceFile) LowConfidenceFields(threshold float64) []string {
+	fields := make([]string, 0)
+	for _, field := range ReviewFields {
+		if meta, exists := i.FieldMeta[field]; exists && meta.Confidence < threshold {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+// SplitByReview 拆分可计入统计的票据和待审核的票据
+func SplitByReview(files []InvoiceFile) ([]InvoiceFile, []InvoiceFile) {
+	counted := make([]InvoiceFile, 0, len(files))
+	pending := make([]InvoiceFile, 0)
+	for _, file := range files {
+		if file.ReviewStatus == ReviewStatusPending {
+			pending = append(pending, file)
+		} else {
+			counted = append(counted, file)
+		}
+	}
+	return counted, pending
+}
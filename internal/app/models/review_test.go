@@ -0,0 +1,38 @@
+package models
+
+import "testing"
+
+func TestApplyLLMConfidence(t *testing.T) {
+	confident := make(map[string]float64, len(ReviewFields))
+	for _, field := range ReviewFields {
+		confident[field] = 0.95
+	}
+	file := InvoiceFile{FieldConfidence: confident}
+	file.ApplyLLMConfidence()
+	file.UpdateReviewStatus(0.8)
+	if file.ReviewStatus != ReviewStatusAuto {
+		t.Errorf("全部字段置信度高于阈值时不需要审核: %s", file.ReviewStatus)
+	}
+
+	// 模型漏给的字段无法确认，进入人工审核
+	missing := make(map[string]float64, len(confident))
+	for field, confidence := range confident {
+		missing[field] = confidence
+	}
+	delete(missing, "tax_amount")
+	file = InvoiceFile{FieldConfidence: missing}
+	file.ApplyLLMConfidence()
+	file.UpdateReviewStatus(0.8)
+	if file.ReviewStatus != ReviewStatusPending {
+		t.Errorf("缺少置信度的字段应进入人工审核: %s", file.ReviewStatus)
+	}
+	if fields := file.LowConfidenceFields(0.8); len(fields) != 1 || fields[0] != "tax_amount" {
+		t.Errorf("低置信度字段为 %v，期望 [tax_amount]", fields)
+	}
+
+	// 阈值为0时不审核
+	file.UpdateReviewStatus(0)
+	if file.ReviewStatus != ReviewStatusAuto {
+		t.Errorf("审核阈值为0时不应进入人工审核: %s", file.ReviewStatus)
+	}
+}
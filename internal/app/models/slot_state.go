@@ -0,0 +1,79 @@
+package models
+
+import "time"
+
+// SlotState 对话中收集的报销信息，按报销单据编号保存，每轮对话只更新提到的字段
+type SlotState struct {
+	ID        uint64    `gorm:"primaryKey;autoIncrement;comment:主键" json:"id"`
+	SessionId string    `gorm:"size:100;not null;uniqueIndex;comment:报销单据编号" json:"session_id"`
+	BasicInfo BasicItem `gorm:"type:text;serializer:json;comment:基本信息" json:"basic_info"`
+	PayInfo   PayItem   `gorm:"type:text;serializer:json;comment:支付信息" json:"pay_info"`
+	Turns     int       `gorm:"not null;default:0;comment:对话轮数" json:"turns"`
+	CreatedAt time.Time `gorm:"type:datetime;not null;default:CURRENT_TIMESTAMP;comment:记录创建时间" json:"created_at"`
+	UpdatedAt time.Time `gorm:"type:datetime;not null;default:CURRENT_TIMESTAMP;comment:最后更新时间" json:"updated_at"`
+}
+
+// TableName 指定表名
+func (SlotState) TableName() string {
+	return "slot_state"
+}
+
+// Get 按字段名获取报销信息，字段名与 BasicItem/PayItem 一致
+func (s *SlotState) Get(key string) string {
+	switch key {
+	case "Category":
+		return s.BasicInfo.Category
+	case "Title":
+		return s.BasicInfo.Title
+	case "UrgentType":
+		return s.BasicInfo.UrgentType
+	case "Comment":
+		return s.BasicInfo.Comment
+	case "BusinessDept":
+		return s.PayInfo.BusinessDept
+	case "BudgetDept":
+		return s.PayInfo.BudgetDept
+	case "PayDept":
+		return s.PayInfo.PayDept
+	case "ProjectType":
+		return s.PayInfo.ProjectType
+	case "Project":
+		return s.PayInfo.Project
+	}
+	return ""
+}
+
+// Set 按字段名设置报销信息，未知字段返回false
+func (s *SlotState) Set(key, value string) bool {
+	switch key {
+	case "Category":
+		s.BasicInfo.Category = value
+	case "Title":
+		s.BasicInfo.Title = value
+	case "UrgentType":
+		s.BasicInfo.UrgentType = value
+	case "Comment":
+		s.BasicInfo.Comment = value
+	case "BusinessDept":
+		s.PayInfo.BusinessDept = value
+	case "BudgetDept":
+		s.PayInfo.BudgetDept = value
+	case "PayDept":
+		s.PayInfo.PayDept = value
+	case "ProjectType":
+		s.PayInfo.ProjectType = value
+	case "Project":
+		s.PayInfo.Project = value
+	default:
+		return false
+	}
+	return true
+}
+
+// SlotItem 缺少或不合法的报销信息字段
+type SlotItem struct {
+	Key     string   `json:"key"`
+	Label   string   `json:"label"`
+	Value   string   `json:"value,omitempty"`   // 不合法时为用户给出的值
+	Options []string `json:"options,omitempty"` // 可选值，为空时可自由填写
+}
@@ -49,3 +49,17 @@ type FileMeta struct {
 	Type string `json:"type"`
 	URL  string `json:"url"`
 }
+
+// ParseErrorEvent 票据识别失败，Detail 为按文件列出的错误
+type ParseErrorEvent struct {
+	Message string      `json:"message"`
+	Detail  interface{} `json:"detail"`
+}
+
+// MissingSlotsEvent 报销信息收集状态，Complete 为 true 时可以开始填报
+type MissingSlotsEvent struct {
+	Complete bool       `json:"complete"`
+	Updated  []string   `json:"updated"` // 本轮更新的字段
+	Missing  []SlotItem `json:"missing"`
+	Invalid  []SlotItem `json:"invalid"`
+}
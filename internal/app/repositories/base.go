@@ -0,0 +1,21 @@
+package repositories
+
+import (
+	"invoice-agent/internal/app/models"
+	"invoice-agent/internal/pkg/storage"
+)
+
+// AutoMigrate 同步表结构，模型新增字段时自动补充数据库列
+// 只会新增表、列和索引，不会删除旧列；数据库账号需要有 CREATE/ALTER 权限，
+// 同步失败时服务启动会直接退出，见 services.Init
+func AutoMigrate() error {
+	return storage.DB.AutoMigrate(
+		&models.InvoiceFile{},
+		&models.Reimbursement{},
+		&models.FillingTask{},
+		&models.FillingProgress{},
+		&models.OACredential{},
+		&models.SlotState{},
+		&models.ChatMessage{},
+	)
+}
@@ -0,0 +1,46 @@
+package repositories
+
+import (
+	"invoice-agent/internal/app/models"
+	"invoice-agent/internal/pkg/storage"
+)
+
+type ChatMessageRepository struct{}
+
+func NewChatMessageRepository() *ChatMessageRepository {
+	return &ChatMessageRepository{}
+}
+
+// Create 保存一条对话消息
+func (r *ChatMessageRepository) Create(message *models.ChatMessage) error {
+	return storage.DB.Create(message).Error
+}
+
+// ListBySessionID 按时间顺序获取会话最近的 limit 条消息，limit 小于等于0时获取全部
+func (r *ChatMessageRepository) ListBySessionID(sessionId string, limit int) ([]models.ChatMessage, error) {
+	var messages []models.ChatMessage
+	db := storage.DB.Where("session_id = ?", sessionId).Order("id desc")
+	if limit > 0 {
+		db = db.Limit(limit)
+	}
+	if err := db.Find(&messages).Error; err != nil {
+		return nil, err
+	}
+	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+		messages[i], messages[j] = messages[j], messages[i]
+	}
+	return messages, nil
+}
+
+// ListSessions 按最近消息时间倒序获取会话列表，userId 为空时不过滤
+func (r *ChatMessageRepository) ListSessions(userId string, limit, offset int) ([]models.ChatSession, error) {
+	var sessions []models.ChatSession
+	db := storage.DB.Model(&models.ChatMessage{}).
+		Select("session_id, MAX(user_id) AS user_id, COUNT(*) AS messages, SUM(total_tokens) AS total_tokens, " +
+			"MIN(created_at) AS started_at, MAX(created_at) AS last_message_at")
+	if userId != "" {
+		db = db.Where("user_id = ?", userId)
+	}
+	err := db.Group("session_id").Order("last_message_at desc").Limit(limit).Offset(offset).Scan(&sessions).Error
+	return sessions, err
+}
@@ -0,0 +1,68 @@
+package repositories
+
+import (
+	"time"
+
+	"invoice-agent/internal/app/models"
+	"invoice-agent/internal/pkg/storage"
+)
+
+type FillingTaskRepository struct{}
+
+func NewFillingTaskRepository() *FillingTaskRepository {
+	return &FillingTaskRepository{}
+}
+
+// Create 创建任务记录
+func (r *FillingTaskRepository) Create(task *models.FillingTask) error {
+	return storage.DB.Create(task).Error
+}
+
+// Update 更新任务状态、最新进度等字段
+func (r *FillingTaskRepository) Update(id uint64, updates map[string]interface{}) error {
+	return storage.DB.Model(&models.FillingTask{}).Where("id = ?", id).Updates(updates).Error
+}
+
+// AppendProgress 追加一条进度日志
+func (r *FillingTaskRepository) AppendProgress(progress *models.FillingProgress) error {
+	return storage.DB.Create(progress).Error
+}
+
+// GetLatestByTaskID 获取任务ID最近一次执行的记录
+func (r *FillingTaskRepository) GetLatestByTaskID(taskID string) (*models.FillingTask, error) {
+	var task models.FillingTask
+	err := storage.DB.Where("task_id = ?", taskID).Order("id desc").First(&task).Error
+	if err != nil {
+		return nil, err
+	}
+	return &task, nil
+}
+
+// GetLatestPreview 获取报销单最近一次的预览任务记录
+func (r *FillingTaskRepository) GetLatestPreview(sessionId string) (*models.FillingTask, error) {
+	var task models.FillingTask
+	err := storage.DB.Where("session_id = ? AND dry_run = ?", sessionId, true).Order("id desc").First(&task).Error
+	if err != nil {
+		return nil, err
+	}
+	return &task, nil
+}
+
+// ListProgress 按顺序获取任务记录的全部进度日志
+func (r *FillingTaskRepository) ListProgress(fillingTaskID uint64) ([]models.FillingProgress, error) {
+	var progress []models.FillingProgress
+	err := storage.DB.Where("filling_task_id = ?", fillingTaskID).Order("seq asc").Find(&progress).Error
+	return progress, err
+}
+
+// MarkUnfinished 将仍处于指定状态的任务置为终态，用于服务重启后清理中断的任务
+func (r *FillingTaskRepository) MarkUnfinished(statuses []string, status, reason string) (int64, error) {
+	result := storage.DB.Model(&models.FillingTask{}).
+		Where("status IN ?", statuses).
+		Updates(map[string]interface{}{
+			"status":   status,
+			"error":    reason,
+			"ended_at": time.Now(),
+		})
+	return result.RowsAffected, result.Error
+}
@@ -60,9 +60,15 @@ func (r *InvoiceFileRepository) Update(id uint64, invoiceFile *models.InvoiceFil
 	if invoiceFile.BuyerName != "" {
 		updates["buyer_name"] = invoiceFile.BuyerName
 	}
+	if invoiceFile.BuyerID != "" {
+		updates["buyer_id"] = invoiceFile.BuyerID
+	}
 	if invoiceFile.SellerName != "" {
 		updates["seller_name"] = invoiceFile.SellerName
 	}
+	if invoiceFile.SellerID != "" {
+		updates["seller_id"] = invoiceFile.SellerID
+	}
 	if invoiceFile.ItemName != "" {
 		updates["item_name"] = invoiceFile.ItemName
 	}
@@ -86,6 +92,24 @@ func (r *InvoiceFileRepository) Update(id uint64, invoiceFile *models.InvoiceFil
 		updates["service_type"] = invoiceFile.ServiceType
 	}
 
+	// 有二维码时以本次比对结果为准，比对一致则清空差异
+	if invoiceFile.QRCode != "" {
+		updates["qr_code"] = invoiceFile.QRCode
+		updates["qr_mismatch"] = invoiceFile.QRMismatch
+	}
+
+	if len(invoiceFile.Items) > 0 {
+		updates["items"] = invoiceFile.Items
+	}
+
+	// 置信度与审核状态
+	if invoiceFile.FieldMeta != nil {
+		updates["field_meta"] = invoiceFile.FieldMeta
+	}
+	if invoiceFile.ReviewStatus != "" {
+		updates["review_status"] = invoiceFile.ReviewStatus
+	}
+
 	// 执行更新
 	return storage.DB.Model(&models.InvoiceFile{}).Where("id = ?", id).Updates(updates).Error
 }
@@ -113,9 +137,15 @@ func (r *InvoiceFileRepository) UpdateByFileId(fileId string, invoiceFile *model
 	if invoiceFile.BuyerName != "" {
 		updates["buyer_name"] = invoiceFile.BuyerName
 	}
+	if invoiceFile.BuyerID != "" {
+		updates["buyer_id"] = invoiceFile.BuyerID
+	}
 	if invoiceFile.SellerName != "" {
 		updates["seller_name"] = invoiceFile.SellerName
 	}
+	if invoiceFile.SellerID != "" {
+		updates["seller_id"] = invoiceFile.SellerID
+	}
 	if invoiceFile.ItemName != "" {
 		updates["item_name"] = invoiceFile.ItemName
 	}
@@ -139,10 +169,81 @@ func (r *InvoiceFileRepository) UpdateByFileId(fileId string, invoiceFile *model
 		updates["service_type"] = invoiceFile.ServiceType
 	}
 
+	// 有二维码时以本次比对结果为准，比对一致则清空差异
+	if invoiceFile.QRCode != "" {
+		updates["qr_code"] = invoiceFile.QRCode
+		updates["qr_mismatch"] = invoiceFile.QRMismatch
+	}
+
+	if len(invoiceFile.Items) > 0 {
+		updates["items"] = invoiceFile.Items
+	}
+
+	// 置信度与审核状态
+	if invoiceFile.FieldMeta != nil {
+		updates["field_meta"] = invoiceFile.FieldMeta
+	}
+	if invoiceFile.ReviewStatus != "" {
+		updates["review_status"] = invoiceFile.ReviewStatus
+	}
+
 	// 执行更新
 	return storage.DB.Model(&models.InvoiceFile{}).Where("file_id = ?", fileId).Updates(updates).Error
 }
 
+// UpdateDuplicate 更新重复报销检测结果，空值同样写入以清除之前的结果
+func (r *InvoiceFileRepository) UpdateDuplicate(id uint64, updates map[string]interface{}) error {
+	return storage.DB.Model(&models.InvoiceFile{}).Where("id = ?", id).Updates(updates).Error
+}
+
+// UpdateViolations 更新业务规则校验结果，没有不符合的规则时清空
+func (r *InvoiceFileRepository) UpdateViolations(id uint64, violations models.RuleViolations) error {
+	return storage.DB.Model(&models.InvoiceFile{}).Where("id = ?", id).Update("violations", violations).Error
+}
+
+// ClearAmounts 把指定的金额字段更新为0，Update 会忽略零值，如免税发票的税额需要单独更新
+func (r *InvoiceFileRepository) ClearAmounts(id uint64, fields []string) error {
+	updates := make(map[string]interface{}, len(fields))
+	for _, field := range fields {
+		updates[field] = 0
+	}
+	return storage.DB.Model(&models.InvoiceFile{}).Where("id = ?", id).Updates(updates).Error
+}
+
+// UpdateParentID 更新行程单关联的发票，0表示取消关联
+func (r *InvoiceFileRepository) UpdateParentID(id uint64, parentID uint64) error {
+	return storage.DB.Model(&models.InvoiceFile{}).Where("id = ?", id).Update("parent_id", parentID).Error
+}
+
+// FindByIdentityKey 获取比 beforeID 更早上传、票据标识相同的第一张票据
+func (r *InvoiceFileRepository) FindByIdentityKey(identityKey string, beforeID uint64) (*models.InvoiceFile, error) {
+	var invoiceFile models.InvoiceFile
+	err := storage.DB.Where("identity_key = ? AND id < ?", identityKey, beforeID).Order("id asc").First(&invoiceFile).Error
+	if err != nil {
+		return nil, err
+	}
+	return &invoiceFile, nil
+}
+
+// FindBySHA256 查找比 beforeID 更早上传的同一文件
+func (r *InvoiceFileRepository) FindBySHA256(sha256 string, beforeID uint64) (*models.InvoiceFile, error) {
+	var invoiceFile models.InvoiceFile
+	err := storage.DB.Where("sha256 = ? AND id < ?", sha256, beforeID).Order("id asc").First(&invoiceFile).Error
+	if err != nil {
+		return nil, err
+	}
+	return &invoiceFile, nil
+}
+
+// ListImageHashes 获取比 beforeID 更早上传、合计金额相同且有图片哈希的票据，按金额索引查询，只取比对需要的字段
+func (r *InvoiceFileRepository) ListImageHashes(totalAmount float64, beforeID uint64) ([]models.InvoiceFile, error) {
+	var invoiceFiles []models.InvoiceFile
+	err := storage.DB.Select("id", "session_id", "file_name", "file_id", "image_hash", "issue_date", "seller_id", "seller_name").
+		Where("total_amount = ? AND image_hash IS NOT NULL AND image_hash <> '' AND id < ?", totalAmount, beforeID).
+		Order("id asc").Find(&invoiceFiles).Error
+	return invoiceFiles, err
+}
+
 // GetByID 根据ID获取发票文件记录
 func (r *InvoiceFileRepository) GetByID(id uint64) (*models.InvoiceFile, error) {
 	var invoiceFile models.InvoiceFile
@@ -214,6 +315,12 @@ func (r *InvoiceFileRepository) ListByCont(invoice models.InvoiceFile, limit, of
 	if invoice.MD5 != "" {
 		db = db.Where("md5 = ?", invoice.MD5)
 	}
+	if invoice.SHA256 != "" {
+		db = db.Where("sha256 = ?", invoice.SHA256)
+	}
+	if invoice.ReviewStatus != "" {
+		db = db.Where("review_status = ?", invoice.ReviewStatus)
+	}
 
 	err := db.Limit(limit).Offset(offset).Find(&invoiceFiles).Error
 	return invoiceFiles, err
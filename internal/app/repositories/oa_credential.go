@@ -0,0 +1,32 @@
+package repositories
+
+import (
+	"invoice-agent/internal/app/models"
+	"invoice-agent/internal/pkg/storage"
+)
+
+type OACredentialRepository struct{}
+
+func NewOACredentialRepository() *OACredentialRepository {
+	return &OACredentialRepository{}
+}
+
+// Save 保存账号，新记录插入，已有记录更新全部字段
+func (r *OACredentialRepository) Save(credential *models.OACredential) error {
+	return storage.DB.Save(credential).Error
+}
+
+// UpdateTestResult 记录登录测试结果
+func (r *OACredentialRepository) UpdateTestResult(id uint64, updates map[string]interface{}) error {
+	return storage.DB.Model(&models.OACredential{}).Where("id = ?", id).Updates(updates).Error
+}
+
+// GetByUserID 根据用户ID获取账号
+func (r *OACredentialRepository) GetByUserID(userId string) (*models.OACredential, error) {
+	var credential models.OACredential
+	err := storage.DB.Where("user_id = ?", userId).First(&credential).Error
+	if err != nil {
+		return nil, err
+	}
+	return &credential, nil
+}
@@ -0,0 +1,72 @@
+package repositories
+
+import (
+	"invoice-agent/internal/app/models"
+	"invoice-agent/internal/pkg/storage"
+)
+
+type ReimbursementRepository struct{}
+
+func NewReimbursementRepository() *ReimbursementRepository {
+	return &ReimbursementRepository{}
+}
+
+// Create 创建报销单
+func (r *ReimbursementRepository) Create(reimbursement *models.Reimbursement) error {
+	return storage.DB.Create(reimbursement).Error
+}
+
+// SaveInfo 只保存报销信息，状态只能通过 UpdateStatus 变更，避免用旧的状态覆盖
+func (r *ReimbursementRepository) SaveInfo(reimbursement *models.Reimbursement) error {
+	return storage.DB.Model(&models.Reimbursement{ID: reimbursement.ID}).
+		Select("title", "basic_info", "pay_info", "cost_items").
+		Updates(reimbursement).Error
+}
+
+// UpdateStatus 仅当当前状态为 from 时更新状态，避免并发流转互相覆盖
+func (r *ReimbursementRepository) UpdateStatus(id uint64, from, to models.ReimbursementStatus, updates map[string]interface{}) (bool, error) {
+	if updates == nil {
+		updates = make(map[string]interface{})
+	}
+	updates["status"] = to
+	result := storage.DB.Model(&models.Reimbursement{}).
+		Where("id = ? AND status = ?", id, from).
+		Updates(updates)
+	return result.RowsAffected > 0, result.Error
+}
+
+// GetByID 根据ID获取报销单
+func (r *ReimbursementRepository) GetByID(id uint64) (*models.Reimbursement, error) {
+	var reimbursement models.Reimbursement
+	err := storage.DB.Where("id = ?", id).First(&reimbursement).Error
+	if err != nil {
+		return nil, err
+	}
+	return &reimbursement, nil
+}
+
+// GetBySessionID 根据报销单据编号获取报销单
+func (r *ReimbursementRepository) GetBySessionID(sessionId string) (*models.Reimbursement, error) {
+	var reimbursement models.Reimbursement
+	err := storage.DB.Where("session_id = ?", sessionId).First(&reimbursement).Error
+	if err != nil {
+		return nil, err
+	}
+	return &reimbursement, nil
+}
+
+// List 获取报销单列表，status 为空时不过滤
+func (r *ReimbursementRepository) List(status models.ReimbursementStatus, limit, offset int) ([]models.Reimbursement, error) {
+	var reimbursements []models.Reimbursement
+	db := storage.DB
+	if status != "" {
+		db = db.Where("status = ?", status)
+	}
+	err := db.Order("id desc").Limit(limit).Offset(offset).Find(&reimbursements).Error
+	return reimbursements, err
+}
+
+// Delete 删除报销单，关联的票据保留
+func (r *ReimbursementRepository) Delete(id uint64) error {
+	return storage.DB.Where("id = ?", id).Delete(&models.Reimbursement{}).Error
+}
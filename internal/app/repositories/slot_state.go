@@ -0,0 +1,32 @@
+package repositories
+
+import (
+	"invoice-agent/internal/app/models"
+	"invoice-agent/internal/pkg/storage"
+)
+
+type SlotStateRepository struct{}
+
+func NewSlotStateRepository() *SlotStateRepository {
+	return &SlotStateRepository{}
+}
+
+// Save 保存报销信息收集状态
+func (r *SlotStateRepository) Save(state *models.SlotState) error {
+	return storage.DB.Save(state).Error
+}
+
+// GetBySessionID 根据报销单据编号获取报销信息收集状态
+func (r *SlotStateRepository) GetBySessionID(sessionId string) (*models.SlotState, error) {
+	var state models.SlotState
+	err := storage.DB.Where("session_id = ?", sessionId).First(&state).Error
+	if err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+// DeleteBySessionID 清空报销单的报销信息收集状态
+func (r *SlotStateRepository) DeleteBySessionID(sessionId string) error {
+	return storage.DB.Where("session_id = ?", sessionId).Delete(&models.SlotState{}).Error
+}
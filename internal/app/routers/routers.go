@@ -22,12 +22,24 @@ func SetUp() *gin.Engine {
 
 		mainGroup := g.Group("/invoice/")
 		mainGroup.GET("/health", controllers.Health)
+		mainGroup.GET("/stream/:kind/:id", controllers.ReplaySSE)
 
 		chatGroup := mainGroup.Group("/chat")
 		{
 			controller := v1.NewInvoiceChatController(services.ChatClient)
 			chatGroup.POST("", controller.Chat)
 			chatGroup.POST("filling", controller.StartFilling)
+			chatGroup.GET("filling/:task_id", controller.GetFillingTask)
+			chatGroup.GET("filling/:task_id/progress", controller.GetFillingProgress)
+			chatGroup.POST("filling/:task_id/confirm", controller.ConfirmFillingPlan)
+			chatGroup.POST("filling/:task_id/cancel", controller.CancelFillingTask)
+			chatGroup.GET("filling/:task_id/artifacts", controller.ListFillingArtifacts)
+			chatGroup.GET("filling/:task_id/artifacts/:name", controller.GetFillingArtifact)
+			chatGroup.GET("slots/:session_id", controller.GetSlots)
+			chatGroup.PUT("slots/:session_id", controller.UpdateSlots)
+			chatGroup.DELETE("slots/:session_id", controller.ResetSlots)
+			chatGroup.GET("sessions", controller.ListChatSessions)
+			chatGroup.GET("sessions/:session_id/messages", controller.GetChatHistory)
 		}
 
 		invoiceFileGroup := mainGroup.Group("/files")
@@ -43,6 +55,30 @@ func SetUp() *gin.Engine {
 			invoiceFileGroup.POST("/upload", controller.UploadInvoiceFile)
 			invoiceFileGroup.GET("/expensive", controller.GetInvoiceFileInExpensive)
 			invoiceFileGroup.POST("/parse", controller.FileParseChat)
+			invoiceFileGroup.GET("/review", controller.ListReviewInvoiceFiles)
+			invoiceFileGroup.PUT("/review/:id", controller.CorrectInvoiceFile)
+			invoiceFileGroup.POST("/review/:id/approve", controller.ApproveInvoiceFile)
+			invoiceFileGroup.POST("/duplicate/:id/override", controller.OverrideDuplicate)
+		}
+
+		reimbursementGroup := mainGroup.Group("/reimbursements")
+		{
+			controller := v1.NewReimbursementController(services.Reimbursement)
+			reimbursementGroup.POST("", controller.CreateReimbursement)
+			reimbursementGroup.GET("/list", controller.ListReimbursements)
+			reimbursementGroup.GET("/:id", controller.GetReimbursement)
+			reimbursementGroup.PUT("/:id", controller.UpdateReimbursement)
+			reimbursementGroup.DELETE("/:id", controller.DeleteReimbursement)
+			reimbursementGroup.POST("/:id/transition", controller.TransitionReimbursement)
+		}
+
+		credentialGroup := mainGroup.Group("/credentials")
+		{
+			controller := v1.NewCredentialController(services.Credential)
+			credentialGroup.PUT("", controller.SetCredential)
+			credentialGroup.POST("/rotate", controller.RotateCredential)
+			credentialGroup.POST("/test", controller.TestCredential)
+			credentialGroup.GET("/:user_id", controller.GetCredential)
 		}
 	})
 
@@ -1,10 +1,12 @@
 package services
 
 import (
+	"context"
 	"fmt"
 	log "github.com/sirupsen/logrus"
 	"invoice-agent/internal/app/models"
-	"path/filepath"
+	"invoice-agent/internal/app/repositories"
+	"invoice-agent/pkg/config"
 	"strings"
 	"sync"
 	"time"
@@ -12,13 +14,6 @@ import (
 	"github.com/playwright-community/playwright-go"
 )
 
-// 常量定义
-const (
-	DelayShort  = 1 * time.Second
-	DelayNormal = 10 * time.Second
-	DelayLong   = 15 * time.Second
-)
-
 type TaskStatus string
 
 const (
@@ -29,21 +24,47 @@ const (
 	TaskStatusCancelled TaskStatus = "cancelled"
 )
 
-// 任务信息
-type TaskInfo struct {
+// TaskSnapshot 任务状态的副本，供 worker 以外的 goroutine 读取
+type TaskSnapshot struct {
 	ID        string     `json:"id"`
 	Status    TaskStatus `json:"status"`
 	Progress  string     `json:"progress"`
 	Error     string     `json:"error,omitempty"`
 	StartedAt time.Time  `json:"started_at"`
 	EndedAt   *time.Time `json:"ended_at,omitempty"`
+	// 排队位置，从1开始，开始执行后不再更新
+	QueuePosition int `json:"queue_position,omitempty"`
+}
 
-	// 进度通道
+// 任务信息，状态字段由 worker、排队通知和取消请求在不同 goroutine 中读写，都通过 mutex 访问
+type TaskInfo struct {
+	ID        string
+	StartedAt time.Time
+
+	mutex         sync.RWMutex
+	status        TaskStatus
+	progress      string
+	errMsg        string
+	endedAt       *time.Time
+	queuePosition int
+	// 已完成的步骤，取消时用于输出部分进度报告
+	doneSteps []string
+	submitted bool
+
+	// 数据库中的任务记录ID和进度序号，进度序号与进度日志一起持久化，都通过 seqLock 访问
+	recordID uint64
+	seq      int
+	seqLock  sync.Mutex
+	// 预览模式生成的填报计划，正式填报时为空
+	plan *models.FillingPlan
+
+	// 取消任务，执行中的步骤通过 context 感知
+	cancel context.CancelFunc
+	// 进度通道和完成信号只由 executeTask 关闭，closed 后不再发送进度
 	progressChan chan string
-	// 取消信号
-	cancelChan chan struct{}
-	// 完成信号
-	doneChan chan struct{}
+	doneChan     chan struct{}
+	chanMutex    sync.Mutex
+	closed       bool
 }
 
 // 自动化填报实例
@@ -51,19 +72,39 @@ type AutoFillingInstance struct {
 	taskID  string
 	request *models.AutoFillingRequest
 	//progress chan string
-	cancel  chan struct{}
+	ctx     context.Context
 	status  TaskStatus
-	pw      *playwright.Playwright
-	browser playwright.Browser
 	context playwright.BrowserContext
 	page    playwright.Page
+	script  config.FormScript
 	mutex   sync.RWMutex
+
+	// 截图、页面快照和追踪文件的保存目录，为空时不保存
+	artifactDir string
+	captureSeq  int
+	tracing     bool
+
+	// 任务截止时间，启动浏览器时开始计算
+	deadline time.Time
 }
 
 // 自动化填报服务（多实例管理器）
 type AutoFillingService struct {
 	tasks     sync.Map // taskID -> *TaskInfo
 	instances sync.Map // taskID -> *AutoFillingInstance
+	repo      *repositories.FillingTaskRepository
+
+	// 任务队列，固定数量的 worker 依次执行
+	queue      chan *fillingJob
+	queueSize  int
+	waiting    []string // 排队中的任务ID，按入队顺序
+	queueMutex sync.Mutex
+	slots      chan struct{} // 浏览器名额，容量为 worker 数
+
+	// 所有任务共享的浏览器，每个任务使用独立的 BrowserContext
+	pw           *playwright.Playwright
+	browser      playwright.Browser
+	browserMutex sync.Mutex
 
 	// Playwright 安装状态
 	playwrightInstalled bool
@@ -72,106 +113,351 @@ type AutoFillingService struct {
 
 // 创建新的服务实例
 func NewAutoFillingService() *AutoFillingService {
-	return &AutoFillingService{
+	s := &AutoFillingService{
 		tasks:     sync.Map{},
 		instances: sync.Map{},
+		repo:      repositories.NewFillingTaskRepository(),
+	}
+	s.markInterruptedTasks()
+	s.startWorkers(config.GetAppConf())
+	return s
+}
+
+// markInterruptedTasks 服务重启后，上次未结束的任务已无法继续，标记为失败
+func (s *AutoFillingService) markInterruptedTasks() {
+	statuses := []string{string(TaskStatusPending), string(TaskStatusRunning)}
+	count, err := s.repo.MarkUnfinished(statuses, string(TaskStatusFailed), "服务重启，任务中断")
+	if err != nil {
+		log.Errorf("标记中断的填报任务失败: %v", err)
+		return
+	}
+	if count > 0 {
+		log.Warnf("服务重启，%d个未完成的填报任务已标记为失败", count)
 	}
 }
 
 // 发送进度信息
 func (s *AutoFillingService) sendProgress(taskInfo *TaskInfo, message string) {
-	taskInfo.Progress = message
-	s.tasks.Store(taskInfo.ID, taskInfo)
-
-	select {
-	case taskInfo.progressChan <- "\n" + message:
-		// 进度信息已发送
-	default:
-		// 通道已满，跳过
+	taskInfo.mutex.Lock()
+	taskInfo.progress = message
+	taskInfo.mutex.Unlock()
+	s.saveProgress(taskInfo, message)
+
+	taskInfo.chanMutex.Lock()
+	if !taskInfo.closed {
+		select {
+		case taskInfo.progressChan <- "\n" + message:
+			// 进度信息已发送
+		default:
+			// 通道已满，跳过；完整进度可通过进度日志查询
+		}
 	}
+	taskInfo.chanMutex.Unlock()
 	log.Infof("[Task %s] %s", taskInfo.ID, message)
 }
 
-// 创建新的自动化填报实例
-func (s *AutoFillingService) NewAutoFillingInstance(taskID string, req *models.AutoFillingRequest) *AutoFillingInstance {
+// saveProgress 持久化进度日志，失败只记录日志，不影响任务执行
+func (s *AutoFillingService) saveProgress(taskInfo *TaskInfo, message string) {
+	taskInfo.seqLock.Lock()
+	recordID := taskInfo.recordID
+	if recordID == 0 {
+		taskInfo.seqLock.Unlock()
+		return
+	}
+	taskInfo.seq++
+	progress := &models.FillingProgress{
+		FillingTaskID: recordID,
+		TaskID:        taskInfo.ID,
+		Seq:           taskInfo.seq,
+		Message:       message,
+		CreatedAt:     time.Now(),
+	}
+	taskInfo.seqLock.Unlock()
+
+	if err := s.repo.AppendProgress(progress); err != nil {
+		log.Errorf("[Task %s] 保存进度失败: %v", taskInfo.ID, err)
+	}
+	if err := s.repo.Update(recordID, map[string]interface{}{"progress": truncateRunes(message, 1000)}); err != nil {
+		log.Errorf("[Task %s] 更新最新进度失败: %v", taskInfo.ID, err)
+	}
+}
+
+// saveTask 保存任务状态到内存和数据库
+func (s *AutoFillingService) saveTask(taskInfo *TaskInfo) {
+	snapshot := taskInfo.Snapshot()
+	updates := map[string]interface{}{
+		"status":   string(snapshot.Status),
+		"progress": truncateRunes(snapshot.Progress, 1000),
+		"error":    snapshot.Error,
+	}
+	if snapshot.EndedAt != nil {
+		updates["ended_at"] = *snapshot.EndedAt
+	}
+	if taskInfo.plan != nil {
+		updates["plan"] = taskInfo.plan
+	}
+	taskInfo.seqLock.Lock()
+	recordID := taskInfo.recordID
+	taskInfo.seqLock.Unlock()
+	if err := s.repo.Update(recordID, updates); err != nil {
+		log.Errorf("[Task %s] 保存任务状态失败: %v", taskInfo.ID, err)
+	}
+}
+
+func truncateRunes(text string, max int) string {
+	runes := []rune(text)
+	if len(runes) <= max {
+		return text
+	}
+	return string(runes[:max])
+}
+
+// Snapshot 返回任务状态的副本
+func (taskInfo *TaskInfo) Snapshot() TaskSnapshot {
+	taskInfo.mutex.RLock()
+	defer taskInfo.mutex.RUnlock()
+	return TaskSnapshot{
+		ID:            taskInfo.ID,
+		Status:        taskInfo.status,
+		Progress:      taskInfo.progress,
+		Error:         taskInfo.errMsg,
+		StartedAt:     taskInfo.StartedAt,
+		EndedAt:       taskInfo.endedAt,
+		QueuePosition: taskInfo.queuePosition,
+	}
+}
+
+// isActive 任务排队中或执行中
+func (taskInfo *TaskInfo) isActive() bool {
+	taskInfo.mutex.RLock()
+	defer taskInfo.mutex.RUnlock()
+	return taskInfo.status == TaskStatusPending || taskInfo.status == TaskStatusRunning
+}
+
+// markRunning 任务开始执行，不再更新排队位置
+func (taskInfo *TaskInfo) markRunning() {
+	taskInfo.mutex.Lock()
+	defer taskInfo.mutex.Unlock()
+	taskInfo.status = TaskStatusRunning
+	taskInfo.queuePosition = 0
+	taskInfo.progress = "开始执行自动化填报..."
+}
+
+// setQueuePosition 更新排队中任务的位置，位置未变化或已开始执行时返回 false
+func (taskInfo *TaskInfo) setQueuePosition(position int) bool {
+	taskInfo.mutex.Lock()
+	defer taskInfo.mutex.Unlock()
+	if taskInfo.status != TaskStatusPending || taskInfo.queuePosition == position {
+		return false
+	}
+	taskInfo.queuePosition = position
+	return true
+}
+
+// stepDone 记录已完成的步骤
+func (taskInfo *TaskInfo) stepDone(name string, submit bool) {
+	taskInfo.mutex.Lock()
+	defer taskInfo.mutex.Unlock()
+	taskInfo.doneSteps = append(taskInfo.doneSteps, name)
+	taskInfo.submitted = taskInfo.submitted || submit
+}
+
+// closeChannels 关闭进度通道和完成信号，只由 executeTask 调用
+func (taskInfo *TaskInfo) closeChannels() {
+	taskInfo.chanMutex.Lock()
+	defer taskInfo.chanMutex.Unlock()
+	if taskInfo.closed {
+		return
+	}
+	taskInfo.closed = true
+	close(taskInfo.progressChan)
+	close(taskInfo.doneChan)
+}
+
+// 创建新的自动化填报实例，ctx 取消后各步骤尽快停止
+func (s *AutoFillingService) NewAutoFillingInstance(ctx context.Context, taskID string, req *models.AutoFillingRequest) *AutoFillingInstance {
 	return &AutoFillingInstance{
 		taskID:  taskID,
 		request: req,
-		cancel:  make(chan struct{}),
+		ctx:     ctx,
 		status:  TaskStatusPending,
+		script:  config.GetFormScript(),
 	}
 }
 
 // 开始自动化填报任务
 func (s *AutoFillingService) StartAutoFilling(taskID string, req *models.AutoFillingRequest) error {
-	// 检查任务是否已存在
-	if _, exists := s.tasks.Load(taskID); exists {
-		return fmt.Errorf("任务ID已存在: %s", taskID)
-	}
-
 	// 创建任务信息
+	ctx, cancel := context.WithCancel(context.Background())
 	taskInfo := &TaskInfo{
 		ID:           taskID,
-		Status:       TaskStatusPending,
-		Progress:     "任务初始化中...",
+		status:       TaskStatusPending,
+		progress:     "任务初始化中...",
 		StartedAt:    time.Now(),
+		cancel:       cancel,
 		progressChan: make(chan string, 10),
-		cancelChan:   make(chan struct{}),
 		doneChan:     make(chan struct{}),
 	}
-	s.tasks.Store(taskID, taskInfo)
+	// 检查任务是否正在执行并登记新任务，同一报销单并发提交时只有一个成功，已结束的任务允许重新提交
+	for {
+		existing, loaded := s.tasks.LoadOrStore(taskID, taskInfo)
+		if !loaded {
+			break
+		}
+		if existing.(*TaskInfo).isActive() {
+			cancel()
+			return fmt.Errorf("任务正在执行中: %s", taskID)
+		}
+		if s.tasks.CompareAndSwap(taskID, existing, taskInfo) {
+			break
+		}
+	}
+	// 登记后的检查失败时撤销登记
+	abort := func(err error) error {
+		cancel()
+		s.tasks.CompareAndDelete(taskID, taskInfo)
+		return err
+	}
+	if !req.DryRun && config.GetFormScript().RequirePreview {
+		if err := s.checkPreview(req); err != nil {
+			return abort(err)
+		}
+	}
+	if err := s.reserve(taskID); err != nil {
+		return abort(err)
+	}
+	record := &models.FillingTask{
+		TaskID:    taskID,
+		SessionId: req.SessionId,
+		Status:    string(TaskStatusPending),
+		Progress:  "任务初始化中...",
+		StartedAt: taskInfo.StartedAt,
+		DryRun:    req.DryRun,
+		Digest:    req.Digest(),
+	}
+	if err := s.repo.Create(record); err != nil {
+		s.dequeue(taskID)
+		return abort(fmt.Errorf("保存任务记录失败: %w", err))
+	}
+	// 登记后排队通知可能已在其他 goroutine 中保存进度
+	taskInfo.seqLock.Lock()
+	taskInfo.recordID = record.ID
+	taskInfo.seqLock.Unlock()
 
 	// 创建实例
-	instance := s.NewAutoFillingInstance(taskID, req)
+	instance := s.NewAutoFillingInstance(ctx, taskID, req)
+	instance.artifactDir = artifactPath(taskID, record.ID)
 	s.instances.Store(taskID, instance)
 
-	// 异步执行任务
-	go s.executeTask(taskID, instance, taskInfo)
+	// 放入队列，由 worker 异步执行
+	s.enqueue(&fillingJob{instance: instance, taskInfo: taskInfo})
 
 	return nil
 }
 
-// 执行任务
+// 执行任务，任务的最终状态和通道关闭都在这里完成
 func (s *AutoFillingService) executeTask(taskID string, instance *AutoFillingInstance, taskInfo *TaskInfo) {
-	// 确保在函数退出时关闭进度通道
 	defer func() {
-		// 先关闭进度通道，让外部监听循环能够退出
-		close(taskInfo.progressChan)
-		close(taskInfo.doneChan)
-
 		if r := recover(); r != nil {
-			taskInfo.Status = TaskStatusFailed
-			taskInfo.Error = fmt.Sprintf("任务执行异常: %v", r)
-			now := time.Now()
-			taskInfo.EndedAt = &now
-			s.tasks.Store(taskID, taskInfo)
+			s.finishTask(instance, taskInfo, fmt.Errorf("任务执行异常: %v", r))
 		}
 
 		// 清理实例资源
 		log.Infoln("任务完成，清理实例资源...")
 		s.cleanupInstance(instance)
+		taskInfo.cancel()
+		// 最后关闭进度通道，让外部监听循环能够退出
+		taskInfo.closeChannels()
 	}()
 
+	// 排队期间已取消
+	if err := instance.ctx.Err(); err != nil {
+		s.finishTask(instance, taskInfo, err)
+		return
+	}
+
 	// 更新任务状态
-	taskInfo.Status = TaskStatusRunning
-	taskInfo.Progress = "开始执行自动化填报..."
-	s.tasks.Store(taskID, taskInfo)
+	taskInfo.markRunning()
+	s.saveTask(taskInfo)
+
+	// 取消时关闭页面，中断正在执行的页面操作
+	stop := context.AfterFunc(instance.ctx, instance.interrupt)
+	defer stop()
 
 	// 执行填报流程
-	log.Infoln("12---: ")
 	err := s.runAutoFilling(instance, taskInfo)
-	if err != nil {
-		log.Infoln("13---: ", err.Error())
-		taskInfo.Status = TaskStatusFailed
-		taskInfo.Error = err.Error()
+	s.finishTask(instance, taskInfo, err)
+}
+
+// finishTask 根据执行结果保存任务的最终状态，并同步报销单状态
+func (s *AutoFillingService) finishTask(instance *AutoFillingInstance, taskInfo *TaskInfo, err error) {
+	cancelled := err != nil && instance.ctx.Err() != nil
+	if err != nil && !cancelled {
+		log.Warnf("[Task %s] 自动填报失败: %v", taskInfo.ID, err)
+	}
+	taskInfo.mutex.Lock()
+	switch {
+	case cancelled:
+		taskInfo.status = TaskStatusCancelled
+		taskInfo.errMsg = "任务已被取消"
+	case err != nil:
+		taskInfo.status = TaskStatusFailed
+		taskInfo.errMsg = err.Error()
+	default:
+		taskInfo.status = TaskStatusCompleted
+		taskInfo.progress = "自动化填报完成"
+		if instance.request.DryRun {
+			taskInfo.progress = "预览完成，等待确认"
+		}
+	}
+	now := time.Now()
+	taskInfo.endedAt = &now
+	taskInfo.mutex.Unlock()
+	if cancelled {
+		s.sendProgress(taskInfo, cancelReport(taskInfo))
+	}
+	s.saveTask(taskInfo)
+	snapshot := taskInfo.Snapshot()
+
+	// 预览不改变报销单状态
+	if instance.request.DryRun {
+		return
+	}
+	if snapshot.Status == TaskStatusCompleted {
+		Reimbursement.Advance(instance.request.SessionId, models.ReimbursementStatusSubmitted, "")
 	} else {
-		taskInfo.Status = TaskStatusCompleted
-		taskInfo.Progress = "自动化填报完成"
+		Reimbursement.Advance(instance.request.SessionId, models.ReimbursementStatusFailed, snapshot.Error)
 	}
+}
 
-	now := time.Now()
-	taskInfo.EndedAt = &now
-	s.tasks.Store(taskID, taskInfo)
+// cancelReport 取消时的部分进度报告
+func cancelReport(taskInfo *TaskInfo) string {
+	taskInfo.mutex.RLock()
+	defer taskInfo.mutex.RUnlock()
+	var b strings.Builder
+	b.WriteString("## ⏹ 任务已取消\n")
+	if len(taskInfo.doneSteps) == 0 {
+		b.WriteString("- 尚未完成任何步骤")
+	} else {
+		b.WriteString(fmt.Sprintf("- 已完成 %d 个步骤，最后完成: %s", len(taskInfo.doneSteps), taskInfo.doneSteps[len(taskInfo.doneSteps)-1]))
+	}
+	if taskInfo.submitted {
+		b.WriteString("\n- ⚠️ 保存步骤已执行，请到OA中检查并处理已保存的报销单")
+	} else {
+		b.WriteString("\n- 报销单未保存到OA")
+	}
+	return b.String()
+}
+
+// interrupt 取消时停止追踪并关闭页面，正在等待的页面操作会立即返回错误
+func (instance *AutoFillingInstance) interrupt() {
+	instance.mutex.Lock()
+	defer instance.mutex.Unlock()
+
+	instance.stopTrace()
+	if instance.page != nil {
+		instance.page.Close()
+	}
 }
 
 // 清理实例资源
@@ -183,18 +469,14 @@ func (s *AutoFillingService) cleanupInstance(instance *AutoFillingInstance) {
 	instance.mutex.Lock()
 	defer instance.mutex.Unlock()
 
+	instance.stopTrace()
 	if instance.page != nil {
 		instance.page.Close()
 	}
+	// 浏览器由所有任务共享，只关闭任务自己的上下文
 	if instance.context != nil {
 		instance.context.Close()
 	}
-	if instance.browser != nil {
-		instance.browser.Close()
-	}
-	if instance.pw != nil {
-		instance.pw.Stop()
-	}
 
 	//close(instance.progress)
 }
@@ -244,27 +526,27 @@ func (s *AutoFillingService) runAutoFilling(instance *AutoFillingInstance, taskI
 	s.sendProgress(taskInfo, "---")
 	s.sendProgress(taskInfo, "## ▶ 启动报销任务（任务ID："+taskInfo.ID+"）")
 
-	// 启动 Playwright
-	pw, err := playwright.Run()
-	if err != nil {
-		return fmt.Errorf("启动报销任务失败: %w", err)
-	}
-	instance.pw = pw
-
 	s.sendProgress(taskInfo, "- 🔄 信息初始化中...")
 	log.Infoln("信息初始化中...")
+	instance.startDeadline()
+	if err := s.openBrowser(instance); err != nil {
+		return err
+	}
 
-	// 启动浏览器
-	browser, err := pw.Chromium.Launch(playwright.BrowserTypeLaunchOptions{
-		Headless: playwright.Bool(true),
-	})
+	s.sendProgress(taskInfo, "- ✅ 报销服务启动")
+
+	// 执行主要流程
+	return s.executeFillingProcess(instance, taskInfo)
+}
+
+// openBrowser 在共享浏览器中为实例创建独立的上下文和页面
+func (s *AutoFillingService) openBrowser(instance *AutoFillingInstance) error {
+	browser, err := s.sharedBrowser()
 	if err != nil {
-		return fmt.Errorf("启动浏览器失败: %w", err)
+		return err
 	}
-	instance.browser = browser
 
-	log.Infoln("浏览器启动成功")
-	// 创建浏览器上下文
+	// 创建浏览器上下文，任务之间的登录状态互不影响
 	context, err := browser.NewContext()
 	if err != nil {
 		return fmt.Errorf("创建浏览器上下文失败: %w", err)
@@ -279,112 +561,48 @@ func (s *AutoFillingService) runAutoFilling(instance *AutoFillingInstance, taskI
 		return fmt.Errorf("创建页面失败: %w", err)
 	}
 	instance.page = page
-
-	s.sendProgress(taskInfo, "- ✅ 报销服务启动")
-
-	// 执行主要流程
-	return s.executeFillingProcess(instance, taskInfo)
+	return nil
 }
 
-// 执行填报流程
-func (s *AutoFillingService) executeFillingProcess(instance *AutoFillingInstance, taskInfo *TaskInfo) error {
-	// 导航到目标URL
-	s.sendProgress(taskInfo, "---")
-	s.sendProgress(taskInfo, "## 🔧 正在进入报销系统...")
-	if _, err := instance.page.Goto("http://open.sky-dome.com.cn:9086/"); err != nil {
-		return fmt.Errorf("导航失败: %w", err)
-	}
-
-	// 检查是否被取消
-	if s.isTaskCancelled(instance) {
-		s.sendProgress(taskInfo, "自动填报被取消")
-		return fmt.Errorf("任务已被取消")
-	}
-
-	// 执行登录操作
-	s.sendProgress(taskInfo, "- ✅ 登录系统")
-	if err := s.handleLogin(instance, taskInfo); err != nil {
-		s.sendProgress(taskInfo, fmt.Sprintf("登录失败: %v", err))
-		return fmt.Errorf("登录失败: %w", err)
-	}
-
-	// 后续流程与之前类似，但需要传递 instance 和 taskInfo
-	// 打开新增对话框
-	s.sendProgress(taskInfo, "- ✅ 新增报销")
-	if err := s.handleAddDialog(instance, taskInfo); err != nil {
-		s.sendProgress(taskInfo, fmt.Sprintf("无法打开发票报销页面: %v", err))
-		return fmt.Errorf("打开新增对话框失败: %w", err)
-	}
-
-	// 填写基础信息
-	s.sendProgress(taskInfo, "## 🔧 开始基础信息设置")
-	if err := s.handleReimburseBasic(instance, taskInfo); err != nil {
-		s.sendProgress(taskInfo, fmt.Sprintf("填写基础信息出错: %v", err))
-		//return fmt.Errorf("填写基础信息失败: %w", err)
-	}
-
-	if err := s.handleWheelDown(instance, 0, 500); err != nil {
-		//return fmt.Errorf("滚动失败: %w", err)
-	}
-
-	// 填写支付信息
-	s.sendProgress(taskInfo, "## 💳 开始支付信息设置")
-	if err := s.handleReimbursePayInfo(instance, taskInfo); err != nil {
-		s.sendProgress(taskInfo, fmt.Sprintf("填写支付信息出错: %v", err))
-		return fmt.Errorf("填写支付信息失败: %w", err)
-	}
-
-	// 填写报销明细
-	s.sendProgress(taskInfo, "## 📄 开始报销细节记录设置")
-	for i := 0; i < len(*instance.request.CostItems); i++ {
-		if err := s.handleAddDetail(instance, taskInfo); err != nil {
-			s.sendProgress(taskInfo, fmt.Sprintf("添加明细项出错: %v", err))
-		}
-	}
-
-	for i, item := range *instance.request.CostItems {
-		if err := s.handleReimburseDetail(instance, taskInfo, item, i+1); err != nil {
-			s.sendProgress(taskInfo, fmt.Sprintf("填写报销明细出错: %v", err))
-		}
+// TestLogin 执行表单脚本中的登录步骤，验证OA账号能否登录，没有空闲的浏览器名额时等待
+func (s *AutoFillingService) TestLogin(username, password string) error {
+	if err := s.ensurePlaywrightInstalled(); err != nil {
+		return fmt.Errorf("Playwright 初始化失败: %w", err)
 	}
-
-	s.sendProgress(taskInfo, "---")
-
-	// 增值税发票批量上传
-	if err := s.handleWheelDown(instance, 0, 500); err != nil {
-		//return fmt.Errorf("滚动失败: %w", err)
+	// 与填报任务共用浏览器名额，避免测试账号时打开过多的浏览器上下文
+	if !s.acquireSlot(loginSlotTimeout) {
+		return fmt.Errorf("当前报销任务较多，请稍后再测试账号")
 	}
+	defer s.releaseSlot()
 
-	s.sendProgress(taskInfo, "## 📎 上传发票中...")
-	for _, filePath := range instance.request.InvoiceFiles {
-		if err := s.handleVatInvoiceUpload(instance, taskInfo, filePath); err != nil {
-			s.sendProgress(taskInfo, fmt.Sprintf("上传发票出错: %v", err))
-			//return fmt.Errorf("上传发票失败: %w", err)
-		}
-	}
-	s.sendProgress(taskInfo, "> 完成发票上传")
-	s.sendProgress(taskInfo, "---")
+	instance := s.NewAutoFillingInstance(context.Background(), "login-test", &models.AutoFillingRequest{
+		Username: username,
+		Password: password,
+	})
+	defer s.cleanupInstance(instance)
 
-	if err := s.handleWheelDown(instance, 0, -500); err != nil {
-		//return fmt.Errorf("滚动失败: %w", err)
+	instance.startDeadline()
+	if err := s.openBrowser(instance); err != nil {
+		return err
 	}
+	// 测试任务不保存进度
+	taskInfo := &TaskInfo{ID: instance.taskID}
+	vars := newFormVars(instance.script, instance.request)
+	return s.runFormSteps(instance, taskInfo, instance.script.Login, nil, vars)
+}
 
-	if err := s.handleSaveInfo(instance, taskInfo); err != nil {
-		return fmt.Errorf("保存信息失败: %w", err)
+// 执行填报流程，页面操作由表单脚本描述
+func (s *AutoFillingService) executeFillingProcess(instance *AutoFillingInstance, taskInfo *TaskInfo) error {
+	if len(instance.script.Steps) == 0 {
+		return fmt.Errorf("未配置OA表单脚本")
 	}
-	//s.sendProgress(taskInfo, "> 报销任务完成")
-
-	return nil
+	log.Infof("[Task %s] 执行表单脚本: %s", taskInfo.ID, instance.script.Name)
+	return s.runFormScript(instance, taskInfo)
 }
 
 // 检查任务是否被取消
 func (s *AutoFillingService) isTaskCancelled(instance *AutoFillingInstance) bool {
-	select {
-	case <-instance.cancel:
-		return true
-	default:
-		return false
-	}
+	return instance.ctx.Err() != nil
 }
 
 // 确保 Playwright 已安装
@@ -401,13 +619,74 @@ func (s *AutoFillingService) ensurePlaywrightInstalled() error {
 	return nil
 }
 
-// 获取任务状态
-func (s *AutoFillingService) GetTaskStatus(taskID string) (*TaskInfo, bool) {
-	status, exists := s.tasks.Load(taskID)
+// 获取任务状态，返回的是当前状态的副本
+func (s *AutoFillingService) GetTaskStatus(taskID string) (*TaskSnapshot, bool) {
+	taskInfo, exists := s.loadTask(taskID)
+	if !exists {
+		return nil, false
+	}
+	snapshot := taskInfo.Snapshot()
+	return &snapshot, true
+}
+
+func (s *AutoFillingService) loadTask(taskID string) (*TaskInfo, bool) {
+	taskInfo, exists := s.tasks.Load(taskID)
 	if !exists {
 		return nil, false
 	}
-	return status.(*TaskInfo), true
+	return taskInfo.(*TaskInfo), true
+}
+
+// GetTaskRecord 获取任务ID最近一次执行的持久化记录
+func (s *AutoFillingService) GetTaskRecord(taskID string) (*models.FillingTask, error) {
+	return s.repo.GetLatestByTaskID(taskID)
+}
+
+// checkPreview 正式填报前检查：最近一次预览已完成、已确认，且填报内容与预览时一致
+func (s *AutoFillingService) checkPreview(req *models.AutoFillingRequest) error {
+	preview, err := s.repo.GetLatestPreview(req.SessionId)
+	if err != nil {
+		return fmt.Errorf("请先预览填报计划并确认后再正式填报")
+	}
+	if preview.Status != string(TaskStatusCompleted) {
+		return fmt.Errorf("最近一次预览未完成，请重新预览")
+	}
+	if preview.ConfirmedAt == nil {
+		return fmt.Errorf("填报计划尚未确认，请确认后再正式填报")
+	}
+	if preview.Digest != req.Digest() {
+		return fmt.Errorf("填报内容与确认的计划不一致，请重新预览")
+	}
+	return nil
+}
+
+// ConfirmPreview 确认任务最近一次预览生成的填报计划
+func (s *AutoFillingService) ConfirmPreview(taskID string) (*models.FillingTask, error) {
+	task, err := s.repo.GetLatestByTaskID(taskID)
+	if err != nil {
+		return nil, err
+	}
+	if !task.DryRun {
+		return nil, fmt.Errorf("最近一次任务不是预览，无需确认")
+	}
+	if task.Status != string(TaskStatusCompleted) {
+		return nil, fmt.Errorf("预览未完成，不能确认")
+	}
+	now := time.Now()
+	if err := s.repo.Update(task.ID, map[string]interface{}{"confirmed_at": now}); err != nil {
+		return nil, err
+	}
+	task.ConfirmedAt = &now
+	return task, nil
+}
+
+// GetTaskProgressLog 获取任务ID最近一次执行的完整进度日志
+func (s *AutoFillingService) GetTaskProgressLog(taskID string) ([]models.FillingProgress, error) {
+	task, err := s.repo.GetLatestByTaskID(taskID)
+	if err != nil {
+		return nil, err
+	}
+	return s.repo.ListProgress(task.ID)
 }
 
 // 获取任务进度通道
@@ -419,30 +698,29 @@ func (s *AutoFillingService) GetTaskProgressChan(taskID string) (chan string, bo
 	return taskInfo.(*TaskInfo).progressChan, true
 }
 
-// 取消任务
+// CancelTask 请求取消排队中或执行中的任务，当前步骤中断后由 executeTask 保存 cancelled 状态
 func (s *AutoFillingService) CancelTask(taskID string) bool {
-	taskInfo, exists := s.tasks.Load(taskID)
-	if !exists {
+	info, exists := s.loadTask(taskID)
+	if !exists || !info.isActive() {
 		return false
 	}
+	s.sendProgress(info, "> ⏹ 收到取消请求，正在停止...")
+	info.cancel()
+	return true
+}
 
-	info := taskInfo.(*TaskInfo)
-	if info.Status == TaskStatusRunning {
-		info.Status = TaskStatusCancelled
-		s.tasks.Store(taskID, info)
-
-		// 发送取消信号到实例
-		if instance, exists := s.instances.Load(taskID); exists {
-			close(instance.(*AutoFillingInstance).cancel)
-		}
-		// 发送取消进度信息
-		s.sendProgress(info, "任务已被取消")
-
-		// 关闭进度通道
-		close(info.progressChan)
+// WaitTask 等待任务结束，超时返回 false
+func (s *AutoFillingService) WaitTask(taskID string, timeout time.Duration) bool {
+	info, exists := s.loadTask(taskID)
+	if !exists {
+		return false
+	}
+	select {
+	case <-info.doneChan:
 		return true
+	case <-time.After(timeout):
+		return false
 	}
-	return false
 }
 
 // 清理已完成的任务
@@ -450,8 +728,8 @@ func (s *AutoFillingService) CleanupCompletedTasks(maxAge time.Duration) {
 	cutoff := time.Now().Add(-maxAge)
 
 	s.tasks.Range(func(key, value interface{}) bool {
-		taskInfo := value.(*TaskInfo)
-		if taskInfo.EndedAt != nil && taskInfo.EndedAt.Before(cutoff) {
+		endedAt := value.(*TaskInfo).Snapshot().EndedAt
+		if endedAt != nil && endedAt.Before(cutoff) {
 			s.tasks.Delete(key)
 			s.instances.Delete(key)
 		}
@@ -468,210 +746,19 @@ var AutoFillingClient *AutoFillingService
 //	return AutoFillingClient
 //}
 
-func (s *AutoFillingService) handleLogin(instance *AutoFillingInstance, taskInfo *TaskInfo) error {
-	s.sendProgress(taskInfo, "> 开始登录...")
-
-	// 等待用户名输入框
-	//s.sendProgress(taskInfo, "等待输入用户名和密码...")
-	log.Infoln("等待输入用户名和密码...")
-	if err := instance.page.Locator("[placeholder=\"请输入账号\"]").WaitFor(playwright.LocatorWaitForOptions{
-		State: playwright.WaitForSelectorStateVisible,
-	}); err != nil {
-		s.sendProgress(taskInfo, fmt.Sprintf("等待用户名输入框失败:  %v", err))
-		return fmt.Errorf("等待用户名输入框失败: %w", err)
-	}
-
-	// 填写用户名
-	if err := instance.page.Locator("[placeholder=\"请输入账号\"]").Fill("tyzq-wangmeng5"); err != nil {
-		s.sendProgress(taskInfo, fmt.Sprintf("填写用户名失败:  %v", err))
-		return fmt.Errorf("填写用户名失败: %w", err)
-	}
-
-	time.Sleep(DelayShort)
-
-	// 填写密码
-	if err := instance.page.Locator("[placeholder=\"请输入密码\"]").Fill("tyzq123456"); err != nil {
-		s.sendProgress(taskInfo, fmt.Sprintf("填写密码失败:  %v", err))
-		return fmt.Errorf("填写密码失败: %w", err)
-	}
-
-	time.Sleep(DelayShort)
-
-	// 点击登录按钮
-	//s.sendProgress(taskInfo, "登录系统...")
-	log.Infoln("登录系统...")
-	if err := instance.page.GetByRole("button", playwright.PageGetByRoleOptions{Name: "登录"}).Click(); err != nil {
-		s.sendProgress(taskInfo, fmt.Sprintf("点击登录按钮失败:  %v", err))
-		return fmt.Errorf("点击登录按钮失败: %w", err)
-	}
-
-	// 等待并重新加载
-	time.Sleep(DelayLong)
-	s.sendProgress(taskInfo, "> 打开报销页...")
-	log.Infoln("> 打开报销页...")
-	if _, err := instance.page.Goto("http://open.sky-dome.com.cn:9086/#/reimbursement/employee"); err != nil {
-		s.sendProgress(taskInfo, fmt.Sprintf("导航到报销页面失败:  %v", err))
-		return fmt.Errorf("导航到报销页面失败: %w", err)
-	}
-
-	time.Sleep(DelayNormal)
-	//s.sendProgress(taskInfo, "进入到报销页面...")
-	log.Infoln("进入到报销页面...")
-	return nil
-}
-
-func (s *AutoFillingService) handleAddDialog(instance *AutoFillingInstance, taskInfo *TaskInfo) error {
-	//s.sendProgress(taskInfo, "打开新增报销记录对话框...")
-	log.Infoln("打开新增报销记录对话框...")
-	if err := instance.page.GetByRole("button", playwright.PageGetByRoleOptions{Name: "新增"}).Click(); err != nil {
-		s.sendProgress(taskInfo, fmt.Sprintf("点击新增按钮失败:  %v", err))
-		return fmt.Errorf("点击新增按钮失败: %w", err)
-	}
-
-	time.Sleep(DelayShort)
-	//s.sendProgress(taskInfo, "打开新增报销记录对话框完成")
-	log.Infoln("打开新增报销记录对话框完成")
-	return nil
-}
-
-func (s *AutoFillingService) handleReimburseBasic(instance *AutoFillingInstance, taskInfo *TaskInfo) error {
-	// 设置报销类型
-	s.sendProgress(taskInfo, "- ✅ 设置报销类型")
-	if err := s.handleReimburseType(instance, taskInfo); err != nil {
-		s.sendProgress(taskInfo, fmt.Sprintf("设置报销类型失败:  %v", err))
-		return fmt.Errorf("设置报销类型失败: %w", err)
-	}
-
-	// 设置紧急类型
-	s.sendProgress(taskInfo, "- ✅ 设置紧急类型")
-	if err := s.handleUrgentType(instance, taskInfo); err != nil {
-		s.sendProgress(taskInfo, fmt.Sprintf("设置紧急类型失败: %v", err))
-		return fmt.Errorf("设置紧急类型失败: %w", err)
-	}
-
-	// 填写报销说明
-	s.sendProgress(taskInfo, "- ✅ 设置报销说明")
-	if err := s.handleReimburseComment(instance, taskInfo); err != nil {
-		s.sendProgress(taskInfo, fmt.Sprintf("填写报销说明失败: %v", err))
-		return fmt.Errorf("填写报销说明失败: %w", err)
-	}
-
-	time.Sleep(DelayShort)
-	s.sendProgress(taskInfo, "- 🟢 基础信息设置完成")
-	s.sendProgress(taskInfo, "---")
-	return nil
-}
-
-func (s *AutoFillingService) handleReimburseType(instance *AutoFillingInstance, taskInfo *TaskInfo) error {
-	s.sendProgress(taskInfo, "> 填写报销类型...")
-	dialog := instance.page.GetByRole("dialog", playwright.PageGetByRoleOptions{Name: "dialog"})
-	if err := dialog.Locator("[placeholder=\"请选择报销类型\"]").Click(); err != nil {
-		s.sendProgress(taskInfo, fmt.Sprintf("点击报销类型下拉框失败: %v", err))
-		return fmt.Errorf("点击报销类型下拉框失败: %w", err)
-	}
-
-	time.Sleep(DelayShort)
-
-	// 选择报销类型
-	if err := instance.page.Locator(fmt.Sprintf("li.el-select-dropdown__item:has-text(\"%s\")", instance.request.BasicInfo.Category)).Last().Click(); err != nil {
-		s.sendProgress(taskInfo, fmt.Sprintf("选择报销类型失败: %v", err))
-		return fmt.Errorf("选择报销类型失败: %w", err)
-	}
-
-	time.Sleep(DelayShort)
-	s.sendProgress(taskInfo, "> 设置报销类型完成")
-	return nil
-}
-
-func (s *AutoFillingService) handleUrgentType(instance *AutoFillingInstance, taskInfo *TaskInfo) error {
-	s.sendProgress(taskInfo, "> 开始设置紧急类型...")
-	dialog := instance.page.GetByRole("dialog", playwright.PageGetByRoleOptions{Name: "dialog"})
-	if err := dialog.Locator("[placeholder=\"请选择紧急类型\"]").Click(); err != nil {
-		s.sendProgress(taskInfo, fmt.Sprintf("点击紧急类型下拉框失败: %v", err))
-		return fmt.Errorf("点击紧急类型下拉框失败: %w", err)
-	}
-
-	time.Sleep(DelayShort)
-
-	// 选择紧急类型
-	if err := instance.page.GetByText(instance.request.BasicInfo.UrgentType, playwright.PageGetByTextOptions{Exact: playwright.Bool(true)}).Click(); err != nil {
-		s.sendProgress(taskInfo, fmt.Sprintf("选择紧急类型失败: %v", err))
-		return fmt.Errorf("选择紧急类型失败: %w", err)
-	}
-
-	time.Sleep(DelayShort)
-	s.sendProgress(taskInfo, "> 设置紧急类型完成")
-	return nil
-}
-
-func (s *AutoFillingService) handleReimburseComment(instance *AutoFillingInstance, taskInfo *TaskInfo) error {
-	s.sendProgress(taskInfo, "> 填写报销说明:"+instance.request.BasicInfo.Comment)
-	if err := instance.page.Locator("[placeholder=\"请输入报销说明\"]").Fill(instance.request.BasicInfo.Comment); err != nil {
-		s.sendProgress(taskInfo, fmt.Sprintf("填写报销说明失败: %v", err))
-		return fmt.Errorf("填写报销说明失败: %w", err)
-	}
-
-	time.Sleep(DelayShort)
-	s.sendProgress(taskInfo, "> 设置报销说明完成")
-	return nil
-}
-
-func (s *AutoFillingService) handleWheelDown(instance *AutoFillingInstance, x float64, y float64) error {
-	if err := instance.page.Mouse().Wheel(x, y); err != nil {
-		return fmt.Errorf("滚动失败: %w", err)
-	}
-
-	time.Sleep(5 * DelayShort)
-	return nil
-}
-
-func (s *AutoFillingService) handleReimbursePayInfo(instance *AutoFillingInstance, taskInfo *TaskInfo) error {
-	// 设置业务发生部门
-	s.sendProgress(taskInfo, "- ✅ 设置业务发生部门: "+instance.request.PayInfo.BusinessDept)
-	if err := s.handleBusinessDept(instance, taskInfo); err != nil {
-		s.sendProgress(taskInfo, fmt.Sprintf("设置业务发生部门失败: %v", err))
-	}
-
-	// 设置预算承担部门
-	s.sendProgress(taskInfo, "- ✅ 设置预算承担部门: "+instance.request.PayInfo.BudgetDept)
-	if err := s.handleBudgetDept(instance, taskInfo); err != nil {
-		s.sendProgress(taskInfo, fmt.Sprintf("设置预算承担部门失败: %v", err))
-	}
-
-	// 设置费用归集项目
-	s.sendProgress(taskInfo, "- ✅ 设置费用归集项目: "+instance.request.PayInfo.ProjectType)
-	if err := s.handleProjectType(instance, taskInfo); err != nil {
-		s.sendProgress(taskInfo, fmt.Sprintf("设置项目类型失败: %v", err))
-	}
-	//设置项目
-	if err := s.handleProject(instance, taskInfo); err != nil {
-		s.sendProgress(taskInfo, fmt.Sprintf("设置项目: %v", err))
-	}
-
-	// 设置付款公司
-	s.sendProgress(taskInfo, "- ✅ 设置付款公司: "+instance.request.PayInfo.PayDept)
-	if err := s.handlePayDept(instance, taskInfo); err != nil {
-		s.sendProgress(taskInfo, fmt.Sprintf("设置付款部门失败: %v", err))
-	}
-
-	time.Sleep(DelayShort)
-	s.sendProgress(taskInfo, "- 🟢 支付信息设置完成")
-	s.sendProgress(taskInfo, "---")
-	return nil
-}
-
-func (s *AutoFillingService) selectDropdownItem(instance *AutoFillingInstance, taskInfo *TaskInfo, targetItem string, desc string) error {
-	allLiElements := instance.page.Locator(".el-select-dropdown__item")
+// selectDropdownItem 按 精确匹配 → 模糊匹配 → 第一个选项 选择下拉项，返回选中的文本和匹配方式
+func (s *AutoFillingService) selectDropdownItem(instance *AutoFillingInstance, taskInfo *TaskInfo, targetItem string, desc string) (string, models.PlanMatch, error) {
+	allLiElements := instance.page.Locator(instance.dropdownOption())
 	count, err := allLiElements.Count()
 	if err != nil {
 		s.sendProgress(taskInfo, fmt.Sprintf("> %v获取下拉选项数量失败", desc))
-		return fmt.Errorf("获取下拉选项数量失败: %w", err)
+		return "", "", fmt.Errorf("获取下拉选项数量失败: %w", err)
 	}
 
 	// 如果没有任何选项，直接返回
 	if count == 0 {
 		s.sendProgress(taskInfo, fmt.Sprintf("> %v下拉框无选项，跳过选择", desc))
-		return nil
+		return "", models.PlanMatchNone, nil
 	}
 
 	var exactMatchLocator, fuzzyMatchLocator playwright.Locator
@@ -704,14 +791,17 @@ func (s *AutoFillingService) selectDropdownItem(instance *AutoFillingInstance, t
 
 	var selectedLocator playwright.Locator
 	var selectionType string
+	match := models.PlanMatchNone
 
 	// 选择策略：精确匹配 → 模糊匹配 → 第一个选项
 	if exactMatchLocator != nil {
 		selectedLocator = exactMatchLocator
 		selectionType = "精确匹配"
+		match = models.PlanMatchExact
 	} else if fuzzyMatchLocator != nil {
 		selectedLocator = fuzzyMatchLocator
 		selectionType = "模糊匹配"
+		match = models.PlanMatchFuzzy
 	} else {
 		// 选择第一个可见的选项
 		for i := 0; i < count; i++ {
@@ -719,283 +809,23 @@ func (s *AutoFillingService) selectDropdownItem(instance *AutoFillingInstance, t
 			if visible, _ := liElement.IsVisible(); visible {
 				selectedLocator = liElement
 				selectionType = "第一个选项"
+				match = models.PlanMatchFirstOption
 				break
 			}
 		}
 	}
 
+	var selectedText string
 	if selectedLocator != nil {
 		// 获取选中选项的文本用于日志
-		selectedText, _ := selectedLocator.TextContent()
+		selectedText, _ = selectedLocator.TextContent()
+		selectedText = strings.TrimSpace(selectedText)
 		if err := selectedLocator.Click(); err != nil {
-			return fmt.Errorf("选择%v失败: %w", desc, err)
+			return "", "", fmt.Errorf("选择%v失败: %w", desc, err)
 		}
-		s.sendProgress(taskInfo, fmt.Sprintf("> 设置%v完成（%s: %s）", desc, selectionType, strings.TrimSpace(selectedText)))
+		s.sendProgress(taskInfo, fmt.Sprintf("> 设置%v完成（%s: %s）", desc, selectionType, selectedText))
 	} else {
 		s.sendProgress(taskInfo, fmt.Sprintf("> **未找到可选的%v选项为：%v，跳过选择**", desc, selectionType))
 	}
-
-	time.Sleep(DelayShort)
-	return nil
-}
-
-func (s *AutoFillingService) handleBusinessDept(instance *AutoFillingInstance, taskInfo *TaskInfo) error {
-	s.sendProgress(taskInfo, "> 设置业务发生部门...")
-	businessDept := instance.page.Locator("div.el-form-item.is-required.custom-form-render-item.custom-form-render-item-twoline")
-	if err := businessDept.Locator("[placeholder='请选择']").Click(); err != nil {
-		return fmt.Errorf("点击业务发生部门下拉框失败: %w", err)
-	}
-
-	time.Sleep(DelayShort)
-	_ = s.selectDropdownItem(instance, taskInfo, instance.request.PayInfo.BusinessDept, "业务发生部门")
-	return nil
-}
-
-func (s *AutoFillingService) handleBudgetDept(instance *AutoFillingInstance, taskInfo *TaskInfo) error {
-	s.sendProgress(taskInfo, "> 设置预算承担部门...")
-	budgetLocator := instance.page.Locator("span:has-text(\"预算承担部门\")").Locator("..").Locator("..").Locator(".el-input__inner")
-	if err := budgetLocator.Click(); err != nil {
-		return fmt.Errorf("点击预算承担部门下拉框失败: %w", err)
-	}
-
-	time.Sleep(DelayShort)
-	_ = s.selectDropdownItem(instance, taskInfo, instance.request.PayInfo.BudgetDept, "预算承担部门")
-
-	return nil
-}
-
-func (s *AutoFillingService) handleProjectType(instance *AutoFillingInstance, taskInfo *TaskInfo) error {
-	s.sendProgress(taskInfo, "> 设置项目类型...")
-	dialog := instance.page.GetByRole("dialog", playwright.PageGetByRoleOptions{Name: "dialog"})
-	if err := dialog.Locator("[placeholder=\"项目类型\"]").Click(); err != nil {
-		return fmt.Errorf("点击项目类型下拉框失败: %w", err)
-	}
-
-	time.Sleep(DelayShort)
-	_ = s.selectDropdownItem(instance, taskInfo, instance.request.PayInfo.ProjectType, "项目类型")
-
-	return nil
-}
-
-func (s *AutoFillingService) handleProject(instance *AutoFillingInstance, taskInfo *TaskInfo) error {
-	s.sendProgress(taskInfo, "> 设置项目...")
-	dialog := instance.page.GetByRole("dialog", playwright.PageGetByRoleOptions{Name: "dialog"})
-	if err := dialog.Locator("[placeholder=\"请选择项目/成本中心\"]").Click(); err != nil {
-		s.sendProgress(taskInfo, fmt.Sprintf("点击项目下拉框失败: %v", err))
-		return fmt.Errorf("点击项目下拉框失败: %w", err)
-	}
-
-	time.Sleep(DelayShort)
-	_ = s.selectDropdownItem(instance, taskInfo, instance.request.PayInfo.Project, "项目")
-
-	return nil
-}
-
-func (s *AutoFillingService) handlePayDept(instance *AutoFillingInstance, taskInfo *TaskInfo) error {
-	s.sendProgress(taskInfo, "> 设置付款公司...")
-	payLocator := instance.page.Locator("span:has-text(\"付款公司\")").Locator("..").Locator("..").Locator(".el-input__inner")
-	if err := payLocator.Click(); err != nil {
-		s.sendProgress(taskInfo, fmt.Sprintf("点击付款公司下拉框失败: %v", err))
-		return fmt.Errorf("点击付款公司下拉框失败: %w", err)
-	}
-
-	time.Sleep(DelayShort)
-	_ = s.selectDropdownItem(instance, taskInfo, instance.request.PayInfo.PayDept, "付款公司")
-
-	return nil
-}
-
-func (s *AutoFillingService) handleAddDetail(instance *AutoFillingInstance, taskInfo *TaskInfo) error {
-	//s.sendProgress(taskInfo, "新增报销明细...")
-	log.Infoln("点击新增报销明细按钮...")
-	addButton := instance.page.Locator("button:has-text(\"导出\") + button")
-	if err := addButton.Click(); err != nil {
-		s.sendProgress(taskInfo, fmt.Sprintf("点击新增明细按钮失败: %v", err))
-		return fmt.Errorf("点击新增明细按钮失败: %w", err)
-	}
-
-	time.Sleep(DelayShort)
-	//s.sendProgress(taskInfo, "新增一条报销细节记录完成")
-	log.Infoln("新增一条报销细节记录完成")
-	return nil
-}
-
-func (s *AutoFillingService) handleReimburseDetail(instance *AutoFillingInstance, taskInfo *TaskInfo, item models.CostItem, trIndex int) error {
-	s.sendProgress(taskInfo, fmt.Sprintf("##### ➕ 新增一条报销细节记录"))
-	log.Infoln("填写报销明细第 %d 行...", trIndex)
-	divElements := instance.page.Locator("div.el-table__header-wrapper")
-	count, err := divElements.Count()
-	if err != nil {
-		s.sendProgress(taskInfo, fmt.Sprintf("获取表格头数量失败: %v", err))
-		return fmt.Errorf("获取表格头数量失败: %w", err)
-	}
-
-	for i := 0; i < count; i++ {
-		divElement := divElements.Nth(i)
-		if textCount, _ := divElement.GetByText("费用名称").Count(); textCount > 0 {
-			trElements := divElement.Locator("+ div").Locator("tr")
-			trCount, err := trElements.Count()
-			if err != nil {
-				s.sendProgress(taskInfo, fmt.Sprintf("获取表格行数量失败: %v", err))
-				return fmt.Errorf("获取表格行数量失败: %w", err)
-			}
-
-			for j := 0; j < trCount; j++ {
-				if j+1 == trIndex {
-					tdElements := trElements.Nth(j).Locator("td")
-					tdCount, err := tdElements.Count()
-					if err != nil {
-						s.sendProgress(taskInfo, fmt.Sprintf("获取表格列数量失败: %v", err))
-						return fmt.Errorf("获取表格列数量失败: %w", err)
-					}
-
-					for k := 0; k < tdCount; k++ {
-						tdElement := tdElements.Nth(k)
-						switch k {
-						case 1: // 费用类别
-							if err := s.handleCostCategoryInDetail(instance, taskInfo, tdElement, item.Category); err != nil {
-								s.sendProgress(taskInfo, fmt.Sprintf("设置费用类别失败: %v", err))
-								return fmt.Errorf("设置费用类别失败: %w", err)
-							}
-						case 2: // 费用名称
-							if err := s.handleCostNameInDetail(instance, taskInfo, tdElement, item.Name); err != nil {
-								s.sendProgress(taskInfo, fmt.Sprintf("设置费用名称失败: %v", err))
-								return fmt.Errorf("设置费用名称失败: %w", err)
-							}
-						case 3: // 费用说明
-							if err := s.handleCostCommentInDetail(instance, taskInfo, tdElement, item.Comment); err != nil {
-								s.sendProgress(taskInfo, fmt.Sprintf("设置费用说明失败: %v", err))
-								return fmt.Errorf("设置费用说明失败: %w", err)
-							}
-						case 4: // 报销金额
-							if err := s.handleCostInDetail(instance, taskInfo, tdElement, item.Cost); err != nil {
-								s.sendProgress(taskInfo, fmt.Sprintf("设置报销金额失败: %v", err))
-								return fmt.Errorf("设置报销金额失败: %w", err)
-							}
-						case 5: // 发票张数
-							if err := s.handleBillNumberInDetail(instance, taskInfo, tdElement, item.BillNumber); err != nil {
-								s.sendProgress(taskInfo, fmt.Sprintf("设置发票张数失败: %v", err))
-								return fmt.Errorf("设置发票张数失败: %w", err)
-							}
-						}
-					}
-					break
-				}
-			}
-			break
-		}
-	}
-
-	time.Sleep(DelayShort)
-	s.sendProgress(taskInfo, fmt.Sprintf("- ✅ 报销明细第 %d 行填写完成", trIndex))
-	return nil
-}
-
-func (s *AutoFillingService) handleCostCategoryInDetail(instance *AutoFillingInstance, taskInfo *TaskInfo, tdElement playwright.Locator, costCategory string) error {
-	s.sendProgress(taskInfo, "- ✅ 设置费用类别: "+costCategory)
-	if err := tdElement.Locator("input.el-input__inner").Click(); err != nil {
-		s.sendProgress(taskInfo, fmt.Sprintf("点击费用类别输入框失败: %v", err))
-		return fmt.Errorf("点击费用类别输入框失败: %w", err)
-	}
-
-	time.Sleep(DelayShort)
-
-	allCategoryItems := instance.page.GetByText(costCategory)
-	count, err := allCategoryItems.Count()
-	if err != nil {
-		s.sendProgress(taskInfo, fmt.Sprintf("获取费用类别选项数量失败: %v", err))
-		return fmt.Errorf("获取费用类别选项数量失败: %w", err)
-	}
-
-	for i := 0; i < count; i++ {
-		categoryItem := allCategoryItems.Nth(i)
-		visible, err := categoryItem.IsVisible()
-		if err != nil {
-			continue
-		}
-		if visible {
-			if err := categoryItem.Click(); err != nil {
-				s.sendProgress(taskInfo, fmt.Sprintf("选择费用类别失败: %v", err))
-				return fmt.Errorf("选择费用类别失败: %w", err)
-			}
-			break
-		}
-	}
-
-	time.Sleep(DelayShort)
-	//s.sendProgress(taskInfo, "- 🟢 费用类别设置完成")
-	return nil
-}
-
-func (s *AutoFillingService) handleCostNameInDetail(instance *AutoFillingInstance, taskInfo *TaskInfo, tdElement playwright.Locator, costName string) error {
-	s.sendProgress(taskInfo, "- ✅ 设置费用名称: "+costName)
-	if err := tdElement.Locator("input.el-input__inner").Click(); err != nil {
-		s.sendProgress(taskInfo, fmt.Sprintf("点击费用名称输入框失败: %v", err))
-		return fmt.Errorf("点击费用名称输入框失败: %w", err)
-	}
-
-	time.Sleep(DelayShort)
-	_ = s.selectDropdownItem(instance, taskInfo, costName, "费用名称")
-
-	return nil
-}
-
-func (s *AutoFillingService) handleCostCommentInDetail(instance *AutoFillingInstance, taskInfo *TaskInfo, tdElement playwright.Locator, costComment string) error {
-	s.sendProgress(taskInfo, "- ✅ 填写费用说明: "+costComment)
-	if err := tdElement.Locator("input.el-input__inner").Fill(costComment); err != nil {
-		s.sendProgress(taskInfo, fmt.Sprintf("填写费用说明失败: %v", err))
-		return fmt.Errorf("填写费用说明失败: %w", err)
-	}
-
-	time.Sleep(DelayShort)
-	//s.sendProgress(taskInfo, "- 费用说明填写完成")
-	return nil
-}
-
-func (s *AutoFillingService) handleCostInDetail(instance *AutoFillingInstance, taskInfo *TaskInfo, tdElement playwright.Locator, cost string) error {
-	s.sendProgress(taskInfo, "- 💰 填写报销金额: "+cost)
-	if err := tdElement.Locator("input.el-input__inner").Fill(cost); err != nil {
-		s.sendProgress(taskInfo, fmt.Sprintf("填写报销金额失败: %v", err))
-		return fmt.Errorf("填写报销金额失败: %w", err)
-	}
-
-	time.Sleep(DelayShort)
-	//s.sendProgress(taskInfo, "- 报销金额填写完成")
-	return nil
-}
-
-func (s *AutoFillingService) handleBillNumberInDetail(instance *AutoFillingInstance, taskInfo *TaskInfo, tdElement playwright.Locator, billNumber string) error {
-	s.sendProgress(taskInfo, "- 📎 填写发票张数: "+billNumber)
-	if err := tdElement.Locator("input.el-input__inner").Fill(billNumber); err != nil {
-		s.sendProgress(taskInfo, fmt.Sprintf("填写发票张数失败: %v", err))
-		return fmt.Errorf("填写发票张数失败: %w", err)
-	}
-
-	time.Sleep(DelayShort)
-	//s.sendProgress(taskInfo, "- 发票张数填写完成")
-	return nil
-}
-
-func (s *AutoFillingService) handleVatInvoiceUpload(instance *AutoFillingInstance, taskInfo *TaskInfo, fileName string) error {
-	s.sendProgress(taskInfo, "- ✅ 上传发票文件: "+filepath.Base(fileName))
-	if err := instance.page.Locator("input.el-upload__input").SetInputFiles([]string{fileName}); err != nil {
-		s.sendProgress(taskInfo, fmt.Sprintf("上传发票文件失败: %v", err))
-		return fmt.Errorf("上传发票文件失败: %w", err)
-	}
-
-	time.Sleep(5 * DelayShort)
-	s.sendProgress(taskInfo, "- 🟢 上传文件完成，发票文件为: "+filepath.Base(fileName))
-	return nil
-}
-
-func (s *AutoFillingService) handleSaveInfo(instance *AutoFillingInstance, taskInfo *TaskInfo) error {
-	s.sendProgress(taskInfo, "## 💾 保存信息...")
-	if err := instance.page.GetByRole("button", playwright.PageGetByRoleOptions{Name: "保存"}).Click(); err != nil {
-		s.sendProgress(taskInfo, fmt.Sprintf("点击保存按钮失败: %v", err))
-		return fmt.Errorf("点击保存按钮失败: %w", err)
-	}
-
-	time.Sleep(DelayNormal)
-	s.sendProgress(taskInfo, "- 🟢 信息保存完成")
-	return nil
+	return selectedText, match, nil
 }
@@ -0,0 +1,108 @@
+package services
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"invoice-agent/internal/app/models"
+	"invoice-agent/internal/pkg/mockoa"
+	"invoice-agent/pkg/config"
+)
+
+// TestAutoFillingAgainstMockOA 用 dev 的表单脚本对模拟OA执行完整填报，检查保存的报销单与请求一致。
+// 需要 Playwright 和 Chromium，无法安装时跳过
+func TestAutoFillingAgainstMockOA(t *testing.T) {
+	if testing.Short() {
+		t.Skip("端到端测试需要浏览器，-short 时跳过")
+	}
+	loadDevConfig(t)
+
+	s := &AutoFillingService{}
+	if err := s.ensurePlaywrightInstalled(); err != nil {
+		t.Skipf("Playwright 不可用: %v", err)
+	}
+	defer func() {
+		if s.browser != nil {
+			s.browser.Close()
+		}
+		if s.pw != nil {
+			s.pw.Stop()
+		}
+	}()
+
+	options := mockoa.DefaultOptions()
+	server := mockoa.NewServer(options)
+	defer server.Close()
+
+	dir := t.TempDir()
+	invoiceFiles := make([]string, 0, 2)
+	for _, name := range []string{"taxi.pdf", "hotel.pdf"} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte("%PDF-1.4\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		invoiceFiles = append(invoiceFiles, path)
+	}
+	req := &models.AutoFillingRequest{
+		SessionId: "e2e-session",
+		BasicInfo: models.BasicItem{
+			Category:   "差旅费报销",
+			Title:      "北京出差报销",
+			UrgentType: "一般",
+			Comment:    "北京客户现场支持",
+		},
+		PayInfo: models.PayItem{
+			BusinessDept: "技术研发部",
+			BudgetDept:   "技术研发部",
+			PayDept:      "天宇正清科技有限公司",
+			ProjectType:  "研发项目",
+			Project:      "发票智能体",
+		},
+		CostItems: &[]models.CostItem{
+			{Category: "交通费", Name: "出租车费", Comment: "机场往返", Cost: "86.50", BillNumber: "1"},
+			{Category: "住宿费", Name: "酒店住宿费", Comment: "两晚住宿", Cost: "760.00", BillNumber: "1"},
+		},
+		Username:     options.Username,
+		Password:     options.Password,
+		InvoiceFiles: invoiceFiles,
+	}
+
+	instance := s.NewAutoFillingInstance(context.Background(), "e2e-task", req)
+	instance.script.BaseURL = server.URL
+	taskInfo := &TaskInfo{
+		ID:           instance.taskID,
+		progressChan: make(chan string, 1000),
+		doneChan:     make(chan struct{}),
+	}
+	defer s.cleanupInstance(instance)
+
+	if err := s.runAutoFilling(instance, taskInfo); err != nil {
+		t.Fatalf("填报失败: %v", err)
+	}
+	submission, ok := server.LastSubmission()
+	if !ok {
+		t.Fatal("模拟OA没有收到报销单")
+	}
+	if diffs := submission.Diff(req); len(diffs) > 0 {
+		t.Errorf("保存的报销单与请求不一致:\n%v", diffs)
+	}
+	if logins := server.Logins(); len(logins) != 1 || logins[0] != options.Username {
+		t.Errorf("登录账号 %v，期望 %s", logins, options.Username)
+	}
+}
+
+// loadDevConfig 在仓库根目录加载 dev 配置，测试结束后恢复工作目录
+func loadDevConfig(t *testing.T) {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(filepath.Join(wd, "..", "..", "..")); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.Chdir(wd) })
+	config.Init("dev")
+}
@@ -0,0 +1,95 @@
+package services
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"invoice-agent/internal/app/models"
+	"invoice-agent/internal/app/repositories"
+	"invoice-agent/internal/pkg/storage"
+)
+
+// dryRunDB 只生成SQL不执行，任务记录的读写不需要数据库
+func dryRunDB(t *testing.T) {
+	t.Helper()
+	db, err := gorm.Open(mysql.New(mysql.Config{DSN: "user:pass@tcp(127.0.0.1:3306)/test", SkipInitializeWithVersion: true}),
+		&gorm.Config{DryRun: true, SkipDefaultTransaction: true, DisableAutomaticPing: true, Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := storage.DB
+	storage.DB = db
+	t.Cleanup(func() { storage.DB = old })
+}
+
+// 排队通知、取消请求和状态查询与 worker 同时读写任务状态，用 go test -race 检查
+func TestTaskStateConcurrentAccess(t *testing.T) {
+	dryRunDB(t)
+	s := &AutoFillingService{repo: repositories.NewFillingTaskRepository(), queueSize: 100, queue: make(chan *fillingJob, 100)}
+
+	// 不启动浏览器的 worker：取消的任务按取消结束，其余直接完成
+	var workers sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for job := range s.queue {
+				s.dequeue(job.taskInfo.ID)
+				job.taskInfo.markRunning()
+				s.saveTask(job.taskInfo)
+				job.taskInfo.stepDone("登录", false)
+				s.finishTask(job.instance, job.taskInfo, job.instance.ctx.Err())
+				job.taskInfo.cancel()
+				job.taskInfo.closeChannels()
+			}
+		}()
+	}
+
+	const tasks = 20
+	var clients sync.WaitGroup
+	for i := 0; i < tasks; i++ {
+		taskID := fmt.Sprintf("task-%d", i%5)
+		clients.Add(3)
+		go func() {
+			defer clients.Done()
+			_ = s.StartAutoFilling(taskID, &models.AutoFillingRequest{SessionId: taskID, DryRun: true})
+		}()
+		go func() {
+			defer clients.Done()
+			s.CancelTask(taskID)
+		}()
+		go func() {
+			defer clients.Done()
+			if task, ok := s.GetTaskStatus(taskID); ok && task.ID != taskID {
+				t.Errorf("任务ID %s，期望 %s", task.ID, taskID)
+			}
+		}()
+	}
+	clients.Wait()
+
+	started := 0
+	for i := 0; i < 5; i++ {
+		taskID := fmt.Sprintf("task-%d", i)
+		if _, ok := s.GetTaskStatus(taskID); !ok {
+			continue
+		}
+		started++
+		if !s.WaitTask(taskID, 5*time.Second) {
+			t.Errorf("任务 %s 没有结束", taskID)
+		}
+		if task, ok := s.GetTaskStatus(taskID); ok && (task.Status == TaskStatusPending || task.Status == TaskStatusRunning) {
+			t.Errorf("任务 %s 结束后状态为 %s", taskID, task.Status)
+		}
+	}
+	if started == 0 {
+		t.Fatal("没有任务开始执行")
+	}
+	close(s.queue)
+	workers.Wait()
+}
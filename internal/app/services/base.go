@@ -4,23 +4,39 @@ import (
 	"invoice-agent/pkg/config"
 	"sync"
 
+	log "github.com/sirupsen/logrus"
+
 	"invoice-agent/internal/app/models"
+	"invoice-agent/internal/app/repositories"
 	"invoice-agent/internal/pkg/code"
 )
 
 var initOnce sync.Once
 
 var (
-	InvoiceFile IInvoiceFile
-	AutoFilling *AutoFillingService
+	InvoiceFile   IInvoiceFile
+	Reimbursement IReimbursement
+	Credential    ICredential
+	SlotFilling   ISlotFilling
+	ChatHistory   IChatHistory
+	AutoFilling   *AutoFillingService
 )
 
 func Init() {
 	initOnce.Do(func() {
-		NewOpenAIClient(config.GetOpenaiConf().ApiKey)
-		NewChatClient(config.GetOpenaiConf().ApiKey)
+		// 表结构与模型不一致时无法正常读写，同步失败直接退出启动
+		if err := repositories.AutoMigrate(); err != nil {
+			log.Errorf("同步数据库表结构失败: %v", err)
+			panic(err)
+		}
+		FileClient = NewFileClient(config.GetOpenaiConf())
+		ChatClient = NewChatProvider(config.GetOpenaiConf())
 		//fmt.Println("=========prompt: ", config.GetOpenaiConf().Prompt)
 		InvoiceFile = NewInvoiceFileService()
+		Reimbursement = NewReimbursementService()
+		Credential = NewCredentialService(config.GetAppConf())
+		SlotFilling = NewSlotFillingService()
+		ChatHistory = NewChatHistoryService()
 		AutoFilling = NewAutoFillingService()
 	})
 }
@@ -0,0 +1,55 @@
+package services
+
+import (
+	"invoice-agent/internal/app/models"
+	"invoice-agent/internal/app/repositories"
+	"invoice-agent/pkg/config"
+)
+
+// DefaultHistoryMessages 未配置时请求模型携带的最近消息条数
+const DefaultHistoryMessages = 20
+
+type IChatHistory interface {
+	AddMessage(sessionId, userId string, role models.ChatRole, content string, usage *models.TokenUsage) error
+	History(sessionId string, limit int) ([]models.ChatMessage, error)
+	ListSessions(userId string, limit, offset int) ([]models.ChatSession, error)
+}
+
+// ChatHistoryService 在服务端保存每个会话的对话消息
+type ChatHistoryService struct {
+	repo *repositories.ChatMessageRepository
+}
+
+func NewChatHistoryService() IChatHistory {
+	return &ChatHistoryService{repo: repositories.NewChatMessageRepository()}
+}
+
+// AddMessage 保存一条对话消息，usage 为生成该消息的token用量
+func (s *ChatHistoryService) AddMessage(sessionId, userId string, role models.ChatRole, content string, usage *models.TokenUsage) error {
+	message := &models.ChatMessage{
+		SessionId: sessionId,
+		UserId:    userId,
+		Role:      role,
+		Content:   content,
+	}
+	message.SetUsage(usage)
+	return s.repo.Create(message)
+}
+
+// History 按时间顺序获取会话最近的 limit 条消息，limit 小于等于0时获取全部
+func (s *ChatHistoryService) History(sessionId string, limit int) ([]models.ChatMessage, error) {
+	return s.repo.ListBySessionID(sessionId, limit)
+}
+
+// ListSessions 获取会话列表，最近有消息的在前
+func (s *ChatHistoryService) ListSessions(userId string, limit, offset int) ([]models.ChatSession, error) {
+	return s.repo.ListSessions(userId, limit, offset)
+}
+
+// HistoryMessages 请求模型时携带的最近消息条数
+func HistoryMessages() int {
+	if n := config.GetOpenaiConf().HistoryMessages; n > 0 {
+		return n
+	}
+	return DefaultHistoryMessages
+}
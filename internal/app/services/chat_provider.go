@@ -0,0 +1,90 @@
+package services
+
+import (
+	"context"
+
+	log "github.com/sirupsen/logrus"
+
+	"invoice-agent/internal/app/models"
+	"invoice-agent/pkg/config"
+)
+
+// 可选的模型服务，通过 openai.yaml 的 provider 配置
+const (
+	ProviderDashScope = "dashscope" // 阿里云DashScope qwen-long
+	ProviderOpenAI    = "openai"    // 任意OpenAI兼容接口
+	ProviderLocal     = "local"     // 本地规则识别，不调用模型
+	ProviderFake      = "fake"      // 脚本化回复，用于测试
+)
+
+const DashScopeBaseURL = "https://dashscope.aliyuncs.com/compatible-mode/v1"
+
+// ChatProvider 对话与票据识别能力，controller只依赖该接口
+type ChatProvider interface {
+	Chat(ctx context.Context, req models.ChatRequest) (*string, error)
+	ChatStream(ctx context.Context, req models.ChatRequest) (<-chan string, <-chan error)
+	FileParseStream(ctx context.Context, req models.ChatRequest) (<-chan string, <-chan error)
+}
+
+// ToolCaller 支持工具调用的模型服务，notify 在每次调用工具前通知调用方
+type ToolCaller interface {
+	ChatWithTools(ctx context.Context, req models.ChatRequest, session *ToolSession, notify func(tool string)) (string, error)
+}
+
+var ChatClient ChatProvider
+
+// NewChatProvider 根据配置创建模型服务
+func NewChatProvider(conf config.Openai) ChatProvider {
+	switch conf.Provider {
+	case ProviderOpenAI:
+		return NewOpenAICompatClient(conf)
+	case ProviderLocal:
+		return NewLocalExtractor()
+	case ProviderFake:
+		return NewScriptedProvider(conf.FakeScript)
+	case "", ProviderDashScope:
+		return NewQwenLongClient(conf)
+	default:
+		log.Warnf("未知的模型服务: %s，使用 %s", conf.Provider, ProviderDashScope)
+		return NewQwenLongClient(conf)
+	}
+}
+
+// IsOfflineProvider 本地/脚本模式下文件不上传到模型服务
+func IsOfflineProvider(provider string) bool {
+	return provider == ProviderLocal || provider == ProviderFake
+}
+
+// 本地生成内容时每次推送的字符数，模拟模型的流式输出
+const streamChunkSize = 16
+
+// streamText 把完整文本按流式接口返回
+func streamText(ctx context.Context, text string, err error) (<-chan string, <-chan error) {
+	contentChan := make(chan string)
+	errorChan := make(chan error, 1)
+
+	go func() {
+		defer close(contentChan)
+		defer close(errorChan)
+
+		if err != nil {
+			errorChan <- err
+			return
+		}
+		runes := []rune(text)
+		for start := 0; start < len(runes); start += streamChunkSize {
+			end := start + streamChunkSize
+			if end > len(runes) {
+				end = len(runes)
+			}
+			select {
+			case contentChan <- string(runes[start:end]):
+			case <-ctx.Done():
+				errorChan <- ctx.Err()
+				return
+			}
+		}
+	}()
+
+	return contentChan, errorChan
+}
@@ -0,0 +1,337 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"invoice-agent/internal/app/models"
+)
+
+// ToolSession 工具调用所在的会话，start_filling 只做检查并记录，由调用方在回复后开始填报
+type ToolSession struct {
+	SessionId string
+	UserId    string
+
+	StartFilling bool
+	DryRun       bool
+}
+
+// ChatTool 可供模型调用的工具，Parameters 为参数的 JSON Schema
+type ChatTool struct {
+	Name        string
+	Label       string // 展示给用户的名称
+	Description string
+	Parameters  map[string]interface{}
+	run         func(session *ToolSession, args json.RawMessage) (interface{}, error)
+}
+
+// toolInvoice 返回给模型的票据概要
+type toolInvoice struct {
+	FileID          string                 `json:"file_id"`
+	FileName        string                 `json:"file_name"`
+	InvoiceType     string                 `json:"invoice_type"`
+	InvoiceCode     string                 `json:"invoice_code"`
+	IssueDate       string                 `json:"issue_date"`
+	ServiceType     models.ServiceType     `json:"service_type"`
+	TotalAmount     float64                `json:"total_amount"`
+	SellerName      string                 `json:"seller_name"`
+	ItemName        string                 `json:"item_name"`
+	ExpenseCategory models.ExpenseCategory `json:"expense_category"`
+	ReviewStatus    models.ReviewStatus    `json:"review_status"`
+}
+
+// toolEditableFields update_invoice_field 可修改的字段
+var toolEditableFields = []string{
+	"invoice_type", "invoice_code", "issue_date", "service_type",
+	"amount", "tax_amount", "total_amount",
+	"buyer_name", "seller_name", "item_name", "expense_category",
+}
+
+var expenseCategories = []string{
+	string(models.ExpenseCategoryTransport),
+	string(models.ExpenseCategoryEntertainment),
+	string(models.ExpenseCategoryTravel),
+	string(models.ExpenseCategoryOther),
+}
+
+var chatTools = []ChatTool{
+	{
+		Name:        "list_session_invoices",
+		Label:       "查询本次报销的票据",
+		Description: "列出当前报销单已上传并识别的全部票据，修改票据前先调用以确定 file_id",
+		Parameters:  objectSchema(nil),
+		run:         listSessionInvoices,
+	},
+	{
+		Name:        "get_category_totals",
+		Label:       "统计各费用类别金额",
+		Description: "按费用类别统计当前报销单的报销金额和票据张数，待人工审核的票据不计入",
+		Parameters:  objectSchema(nil),
+		run:         getCategoryTotals,
+	},
+	{
+		Name:        "update_invoice_field",
+		Label:       "修改票据信息",
+		Description: "修改当前报销单中一张票据的识别字段，修改后该字段记为人工修正",
+		Parameters: objectSchema(map[string]interface{}{
+			"file_id": map[string]interface{}{"type": "string", "description": "票据的 file_id"},
+			"field":   map[string]interface{}{"type": "string", "enum": toolEditableFields, "description": "要修改的字段"},
+			"value": map[string]interface{}{"type": "string",
+				"description": "新的值；金额为数字，service_type 为1(发票类)或2(非发票类)，expense_category 只能是" + strings.Join(expenseCategories, "/")},
+		}, "file_id", "field", "value"),
+		run: updateInvoiceField,
+	},
+	{
+		Name:        "start_filling",
+		Label:       "开始填报",
+		Description: "使用已收集的报销信息和本报销单的票据开始向OA填报，报销信息不完整时返回缺少的字段",
+		Parameters: objectSchema(map[string]interface{}{
+			"dry_run": map[string]interface{}{"type": "boolean", "description": "只预览填报计划，不保存到OA"},
+		}),
+		run: startFilling,
+	},
+	{
+		Name:        "get_task_status",
+		Label:       "查询填报进度",
+		Description: "查询当前报销单最近一次填报任务的状态和进度",
+		Parameters:  objectSchema(nil),
+		run:         getTaskStatus,
+	},
+}
+
+// ChatTools 对话中可供模型调用的工具
+func ChatTools() []ChatTool {
+	return chatTools
+}
+
+// ToolLabel 工具的展示名称
+func ToolLabel(name string) string {
+	for _, tool := range chatTools {
+		if tool.Name == name {
+			return tool.Label
+		}
+	}
+	return name
+}
+
+// CallTool 执行工具调用并返回JSON结果，执行失败时把错误原因返回给模型，由模型向用户说明
+func CallTool(session *ToolSession, name, arguments string) string {
+	var result interface{}
+	err := fmt.Errorf("未知的工具: %s", name)
+	for _, tool := range chatTools {
+		if tool.Name == name {
+			if arguments == "" {
+				arguments = "{}"
+			}
+			result, err = tool.run(session, json.RawMessage(arguments))
+			break
+		}
+	}
+	if err != nil {
+		log.Warnf("工具调用失败, session_id: %s, tool: %s, args: %s, err: %v", session.SessionId, name, arguments, err)
+		result = map[string]string{"error": err.Error()}
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		return fmt.Sprintf(`{"error":%q}`, err.Error())
+	}
+	return string(data)
+}
+
+func objectSchema(properties map[string]interface{}, required ...string) map[string]interface{} {
+	if properties == nil {
+		properties = map[string]interface{}{}
+	}
+	schema := map[string]interface{}{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+// sessionInvoices 当前报销单的全部票据
+func sessionInvoices(sessionId string) ([]models.InvoiceFile, error) {
+	return InvoiceFile.ListInvoiceFilesByCont(models.InvoiceFile{
+		SessionId:   sessionId,
+		ServiceType: models.ServiceType(3),
+	}, 100, 0)
+}
+
+func listSessionInvoices(session *ToolSession, _ json.RawMessage) (interface{}, error) {
+	files, err := sessionInvoices(session.SessionId)
+	if err != nil {
+		return nil, err
+	}
+	invoices := make([]toolInvoice, 0, len(files))
+	for _, f := range files {
+		invoices = append(invoices, toolInvoice{
+			FileID:          f.FileID,
+			FileName:        f.FileName,
+			InvoiceType:     f.InvoiceType,
+			InvoiceCode:     f.InvoiceCode,
+			IssueDate:       f.IssueDate,
+			ServiceType:     f.ServiceType,
+			TotalAmount:     f.TotalAmount,
+			SellerName:      f.SellerName,
+			ItemName:        f.ItemName,
+			ExpenseCategory: f.ExpenseCategory,
+			ReviewStatus:    f.ReviewStatus,
+		})
+	}
+	return invoices, nil
+}
+
+func getCategoryTotals(session *ToolSession, _ json.RawMessage) (interface{}, error) {
+	files, err := sessionInvoices(session.SessionId)
+	if err != nil {
+		return nil, err
+	}
+	counted, pending := models.SplitByReview(files)
+	totals := make([]map[string]string, 0)
+	for _, item := range *models.StatByExpenseCategory(counted) {
+		totals = append(totals, map[string]string{
+			"category":    item.Category,
+			"cost":        item.Cost,
+			"bill_number": item.BillNumber,
+		})
+	}
+	return map[string]interface{}{
+		"totals":         totals,
+		"pending_review": len(pending),
+	}, nil
+}
+
+func updateInvoiceField(session *ToolSession, args json.RawMessage) (interface{}, error) {
+	var params struct {
+		FileID string `json:"file_id"`
+		Field  string `json:"field"`
+		Value  string `json:"value"`
+	}
+	if err := json.Unmarshal(args, &params); err != nil {
+		return nil, fmt.Errorf("参数错误: %w", err)
+	}
+	invoiceFile, err := InvoiceFile.GetInvoiceFileByFileID(params.FileID)
+	if err != nil || invoiceFile.SessionId != session.SessionId {
+		return nil, fmt.Errorf("当前报销单中没有该票据: %s", params.FileID)
+	}
+	correction, err := invoiceCorrection(params.Field, strings.TrimSpace(params.Value))
+	if err != nil {
+		return nil, err
+	}
+	var zeroFields []string
+	if params.Field == "tax_amount" && correction.TaxAmount == 0 {
+		zeroFields = append(zeroFields, params.Field)
+	}
+	updated, err := InvoiceFile.CorrectInvoiceFile(invoiceFile.ID, correction, zeroFields...)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"updated": true, "invoice": updated}, nil
+}
+
+// invoiceCorrection 把单个字段的新值转换为票据修正内容
+func invoiceCorrection(field, value string) (*models.InvoiceFile, error) {
+	correction := &models.InvoiceFile{}
+	if value == "" {
+		return nil, fmt.Errorf("新的值不能为空")
+	}
+	switch field {
+	case "invoice_type":
+		correction.InvoiceType = value
+	case "invoice_code":
+		correction.InvoiceCode = value
+	case "issue_date":
+		correction.IssueDate = value
+	case "buyer_name":
+		correction.BuyerName = value
+	case "seller_name":
+		correction.SellerName = value
+	case "item_name":
+		correction.ItemName = value
+	case "expense_category":
+		if !containsValue(expenseCategories, value) {
+			return nil, fmt.Errorf("费用类别只能是：%s", strings.Join(expenseCategories, "、"))
+		}
+		correction.ExpenseCategory = models.ExpenseCategory(value)
+	case "service_type":
+		serviceType, err := strconv.Atoi(value)
+		if err != nil || (serviceType != int(models.ServiceTypeInvoice) && serviceType != int(models.ServiceTypeNonInvoice)) {
+			return nil, fmt.Errorf("service_type 只能是1或2")
+		}
+		correction.ServiceType = models.ServiceType(serviceType)
+	case "amount", "tax_amount", "total_amount":
+		amount, err := strconv.ParseFloat(value, 64)
+		if err != nil || amount < 0 {
+			return nil, fmt.Errorf("金额必须是不小于0的数字: %s", value)
+		}
+		// 免税发票的税额为0，其他金额必须大于0
+		if amount == 0 && field != "tax_amount" {
+			return nil, fmt.Errorf("金额必须是大于0的数字: %s", value)
+		}
+		switch field {
+		case "amount":
+			correction.Amount = amount
+		case "tax_amount":
+			correction.TaxAmount = amount
+		default:
+			correction.TotalAmount = amount
+		}
+	default:
+		return nil, fmt.Errorf("不能修改的字段: %s", field)
+	}
+	return correction, nil
+}
+
+func startFilling(session *ToolSession, args json.RawMessage) (interface{}, error) {
+	var params struct {
+		DryRun bool `json:"dry_run"`
+	}
+	if err := json.Unmarshal(args, &params); err != nil {
+		return nil, fmt.Errorf("参数错误: %w", err)
+	}
+	_, event, err := SlotFilling.FillingRequest(session.SessionId)
+	if errors.Is(err, ErrSlotsIncomplete) {
+		return map[string]interface{}{"accepted": false, "reason": err.Error(), "missing": event.Missing, "invalid": event.Invalid}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	check, err := CheckBeforeFilling(session.SessionId, session.UserId)
+	if err != nil {
+		return nil, err
+	}
+	if len(check.Duplicates) > 0 {
+		reasons := make([]string, 0, len(check.Duplicates))
+		for _, f := range check.Duplicates {
+			reasons = append(reasons, f.FileName+": "+f.DuplicateReason)
+		}
+		return map[string]interface{}{"accepted": false, "reason": "有票据疑似重复报销，需人工确认后才能填报", "duplicates": reasons}, nil
+	}
+	if check.Violations.HasErrors() {
+		return map[string]interface{}{"accepted": false, "reason": "报销单不符合公司报销政策", "violations": check.Violations}, nil
+	}
+	if task, ok := AutoFilling.GetTaskStatus(session.SessionId); ok &&
+		(task.Status == TaskStatusPending || task.Status == TaskStatusRunning) {
+		return nil, fmt.Errorf("填报任务正在执行中，当前状态: %s", task.Status)
+	}
+
+	session.StartFilling = true
+	session.DryRun = params.DryRun
+	return map[string]interface{}{"accepted": true, "dry_run": params.DryRun, "message": "填报任务将在本次回复后开始，进度会实时输出"}, nil
+}
+
+func getTaskStatus(session *ToolSession, _ json.RawMessage) (interface{}, error) {
+	if task, ok := AutoFilling.GetTaskStatus(session.SessionId); ok {
+		return task, nil
+	}
+	record, err := AutoFilling.GetTaskRecord(session.SessionId)
+	if err != nil {
+		return map[string]string{"status": "none", "message": "当前报销单还没有填报任务"}, nil
+	}
+	return record, nil
+}
@@ -0,0 +1,82 @@
+package services
+
+import (
+	"encoding/json"
+	"testing"
+
+	"invoice-agent/internal/app/models"
+)
+
+func TestInvoiceCorrectionAmounts(t *testing.T) {
+	correction, err := invoiceCorrection("tax_amount", "0")
+	if err != nil || correction.TaxAmount != 0 {
+		t.Errorf("免税发票的税额可以修正为0: %v", err)
+	}
+	if _, err := invoiceCorrection("total_amount", "0"); err == nil {
+		t.Error("价税合计不能修正为0")
+	}
+	if _, err := invoiceCorrection("tax_amount", "-1"); err == nil {
+		t.Error("税额不能为负数")
+	}
+	if correction, err := invoiceCorrection("amount", "86.5"); err != nil || correction.Amount != 86.5 {
+		t.Errorf("金额修正为 %+v, err: %v", correction, err)
+	}
+}
+
+// stubInvoiceFiles 固定的报销单票据
+type stubInvoiceFiles struct {
+	IInvoiceFile
+	files []models.InvoiceFile
+}
+
+func (s *stubInvoiceFiles) PairItineraries(sessionId string) ([]models.InvoiceFile, error) {
+	return s.files, nil
+}
+
+type stubCredential struct {
+	ICredential
+}
+
+func (s *stubCredential) GetCredential(userId string) (string, string, error) {
+	return "oa-user", "oa-password", nil
+}
+
+type stubSlotFilling struct {
+	ISlotFilling
+}
+
+func (s *stubSlotFilling) FillingRequest(sessionId string) (*models.AutoFillingRequest, models.MissingSlotsEvent, error) {
+	return &models.AutoFillingRequest{SessionId: sessionId}, models.MissingSlotsEvent{Complete: true}, nil
+}
+
+func TestStartFillingToolUsesPreFillingCheck(t *testing.T) {
+	loadDevConfig(t)
+	oldInvoiceFile, oldCredential, oldSlotFilling := InvoiceFile, Credential, SlotFilling
+	t.Cleanup(func() { InvoiceFile, Credential, SlotFilling = oldInvoiceFile, oldCredential, oldSlotFilling })
+	Credential, SlotFilling = &stubCredential{}, &stubSlotFilling{}
+
+	// 填报前重新配对行程单，重复报销和报销政策与对话中的“报销”指令一致
+	InvoiceFile = &stubInvoiceFiles{files: []models.InvoiceFile{{
+		ID: 1, FileName: "taxi.pdf", ServiceType: models.ServiceTypeInvoice, TotalAmount: 86.5,
+		ExpenseCategory: models.ExpenseCategoryTransport, DuplicateOf: "file-0", DuplicateReason: "发票号码相同",
+	}}}
+	result, err := startFilling(&ToolSession{SessionId: "s-1", UserId: "u-1"}, json.RawMessage(`{}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if accepted := result.(map[string]interface{})["accepted"]; accepted != false {
+		t.Errorf("疑似重复报销时不应开始填报: %v", result)
+	}
+
+	InvoiceFile = &stubInvoiceFiles{files: []models.InvoiceFile{{
+		ID: 1, FileName: "dinner.pdf", ServiceType: models.ServiceTypeInvoice, TotalAmount: 4200,
+		ItemName: "餐饮服务", ExpenseCategory: models.ExpenseCategoryEntertainment,
+	}}}
+	result, err = startFilling(&ToolSession{SessionId: "s-1", UserId: "u-1"}, json.RawMessage(`{}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := result.(map[string]interface{})["violations"]; !ok {
+		t.Errorf("不符合报销政策时应返回原因: %v", result)
+	}
+}
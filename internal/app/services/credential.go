@@ -0,0 +1,158 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+
+	"invoice-agent/internal/app/models"
+	"invoice-agent/internal/app/repositories"
+	"invoice-agent/internal/pkg/vault"
+	"invoice-agent/pkg/config"
+)
+
+// ErrCredentialNotFound 用户尚未设置OA账号
+var ErrCredentialNotFound = errors.New("未设置OA账号，请先设置OA账号和密码")
+
+type ICredential interface {
+	SetCredential(userId, username, password string) (*models.OACredential, error)
+	RotateCredential(userId, password string) (*models.OACredential, error)
+	GetCredentialInfo(userId string) (*models.OACredential, error)
+	GetCredential(userId string) (username, password string, err error)
+	TestCredential(userId string) (*models.OACredential, error)
+}
+
+type CredentialService struct {
+	repo  *repositories.OACredentialRepository
+	vault *vault.Vault
+	err   error // 主密钥不可用的原因
+}
+
+func NewCredentialService(conf config.App) ICredential {
+	v, err := vault.New(conf.CredentialKey)
+	if err != nil {
+		log.Warnf("OA账号加密不可用: %v", err)
+	}
+	return &CredentialService{
+		repo:  repositories.NewOACredentialRepository(),
+		vault: v,
+		err:   err,
+	}
+}
+
+// SetCredential 设置或覆盖用户的OA账号
+func (s *CredentialService) SetCredential(userId, username, password string) (*models.OACredential, error) {
+	if username == "" || password == "" {
+		return nil, fmt.Errorf("OA账号和密码不能为空")
+	}
+	cipher, err := s.encrypt(password)
+	if err != nil {
+		return nil, err
+	}
+
+	credential, err := s.repo.GetByUserID(userId)
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+		credential = &models.OACredential{UserId: userId}
+	}
+	credential.Username = username
+	credential.PasswordCipher = cipher
+	credential.TestedAt = nil
+	credential.TestError = ""
+	if err := s.repo.Save(credential); err != nil {
+		return nil, err
+	}
+	return credential, nil
+}
+
+// RotateCredential 更换OA密码，账号不变
+func (s *CredentialService) RotateCredential(userId, password string) (*models.OACredential, error) {
+	if password == "" {
+		return nil, fmt.Errorf("OA密码不能为空")
+	}
+	credential, err := s.GetCredentialInfo(userId)
+	if err != nil {
+		return nil, err
+	}
+	cipher, err := s.encrypt(password)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	credential.PasswordCipher = cipher
+	credential.RotatedAt = &now
+	credential.TestedAt = nil
+	credential.TestError = ""
+	if err := s.repo.Save(credential); err != nil {
+		return nil, err
+	}
+	return credential, nil
+}
+
+// GetCredentialInfo 获取账号信息，不含密码
+func (s *CredentialService) GetCredentialInfo(userId string) (*models.OACredential, error) {
+	credential, err := s.repo.GetByUserID(userId)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrCredentialNotFound
+	}
+	return credential, err
+}
+
+// GetCredential 获取解密后的OA账号和密码
+func (s *CredentialService) GetCredential(userId string) (string, string, error) {
+	if userId == "" {
+		return "", "", ErrCredentialNotFound
+	}
+	credential, err := s.GetCredentialInfo(userId)
+	if err != nil {
+		return "", "", err
+	}
+	if s.err != nil {
+		return "", "", s.err
+	}
+	password, err := s.vault.Decrypt(credential.PasswordCipher)
+	if err != nil {
+		return "", "", fmt.Errorf("OA密码解密失败，请重新设置: %w", err)
+	}
+	return credential.Username, password, nil
+}
+
+// TestCredential 使用保存的账号登录OA，并记录测试结果
+func (s *CredentialService) TestCredential(userId string) (*models.OACredential, error) {
+	username, password, err := s.GetCredential(userId)
+	if err != nil {
+		return nil, err
+	}
+	credential, err := s.GetCredentialInfo(userId)
+	if err != nil {
+		return nil, err
+	}
+
+	loginErr := AutoFilling.TestLogin(username, password)
+	now := time.Now()
+	credential.TestedAt = &now
+	credential.TestError = ""
+	if loginErr != nil {
+		credential.TestError = loginErr.Error()
+	}
+	if err := s.repo.UpdateTestResult(credential.ID, map[string]interface{}{
+		"tested_at":  now,
+		"test_error": credential.TestError,
+	}); err != nil {
+		return nil, err
+	}
+	return credential, loginErr
+}
+
+func (s *CredentialService) encrypt(password string) (string, error) {
+	if s.err != nil {
+		return "", s.err
+	}
+	return s.vault.Encrypt(password)
+}
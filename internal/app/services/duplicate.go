@@ -0,0 +1,107 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+
+	"invoice-agent/internal/app/models"
+	"invoice-agent/internal/pkg/imagehash"
+)
+
+// CheckDuplicate 在所有报销单中查找与该票据重复的更早的票据：先按服务端计算的文件SHA-256比对，
+// 再按票据标识比对，最后按图片感知哈希比对，结果写回票据记录，未发现重复时清除之前的结果。
+// 同一模板的不同发票整页图片也很相似，图片相似时还要求金额相同且开票日期或销售方相同
+func (s *InvoiceFileService) CheckDuplicate(fileId string) (*models.InvoiceFile, error) {
+	invoiceFile, err := s.repo.GetByFileID(fileId)
+	if err != nil {
+		return nil, err
+	}
+
+	identityKey := invoiceFile.ComputeIdentityKey()
+	duplicateOf, reason, err := findDuplicate(s.repo, invoiceFile, identityKey)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.repo.UpdateDuplicate(invoiceFile.ID, map[string]interface{}{
+		"identity_key":     identityKey,
+		"duplicate_of":     duplicateOf,
+		"duplicate_reason": reason,
+	})
+	if err != nil {
+		return nil, err
+	}
+	invoiceFile.IdentityKey = identityKey
+	invoiceFile.DuplicateOf = duplicateOf
+	invoiceFile.DuplicateReason = reason
+	return invoiceFile, nil
+}
+
+// duplicateFinder 查找更早的重复票据，由 InvoiceFileRepository 实现
+type duplicateFinder interface {
+	FindBySHA256(sha256 string, beforeID uint64) (*models.InvoiceFile, error)
+	FindByIdentityKey(identityKey string, beforeID uint64) (*models.InvoiceFile, error)
+	ListImageHashes(totalAmount float64, beforeID uint64) ([]models.InvoiceFile, error)
+}
+
+// findDuplicate 依次按文件SHA-256、票据标识和图片感知哈希查找重复的票据，返回重复票据的文件ID和原因
+func findDuplicate(finder duplicateFinder, invoiceFile *models.InvoiceFile, identityKey string) (string, string, error) {
+	if invoiceFile.SHA256 != "" {
+		other, err := finder.FindBySHA256(invoiceFile.SHA256, invoiceFile.ID)
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", "", err
+		}
+		if other != nil {
+			return other.FileID, fmt.Sprintf("与报销单 %s 中的 %s 是同一个文件", other.SessionId, other.FileName), nil
+		}
+	}
+	if identityKey != "" {
+		other, err := finder.FindByIdentityKey(identityKey, invoiceFile.ID)
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", "", err
+		}
+		if other != nil {
+			return other.FileID, fmt.Sprintf("与报销单 %s 中的 %s 发票号码、开票日期、销售方和金额相同", other.SessionId, other.FileName), nil
+		}
+	}
+	if invoiceFile.ImageHash != "" && invoiceFile.TotalAmount > 0 {
+		candidates, err := finder.ListImageHashes(invoiceFile.TotalAmount, invoiceFile.ID)
+		if err != nil {
+			return "", "", err
+		}
+		for _, other := range candidates {
+			if !sameIssueOrSeller(invoiceFile, &other) {
+				continue
+			}
+			if imagehash.Similar(invoiceFile.ImageHash, other.ImageHash, imagehash.DefaultThreshold) {
+				return other.FileID, fmt.Sprintf("与报销单 %s 中的 %s 图片相似且金额相同", other.SessionId, other.FileName), nil
+			}
+		}
+	}
+	return "", "", nil
+}
+
+// sameIssueOrSeller 开票日期或销售方是否相同，发票号码识别错误时仍能发现重复
+func sameIssueOrSeller(a, b *models.InvoiceFile) bool {
+	dateA, okA := models.ParseIssueDate(a.IssueDate)
+	dateB, okB := models.ParseIssueDate(b.IssueDate)
+	if okA && okB && dateA.Equal(dateB) {
+		return true
+	}
+	sellerA, sellerB := strings.ToUpper(strings.TrimSpace(a.SellerID)), strings.ToUpper(strings.TrimSpace(b.SellerID))
+	if sellerA != "" && sellerA == sellerB {
+		return true
+	}
+	return a.SellerName != "" && normalizeCompanyName(a.SellerName) == normalizeCompanyName(b.SellerName)
+}
+
+// OverrideDuplicate 人工确认不是重复报销，票据可以参与填报
+func (s *InvoiceFileService) OverrideDuplicate(id uint64) (*models.InvoiceFile, error) {
+	if err := s.repo.UpdateDuplicate(id, map[string]interface{}{"duplicate_override": true}); err != nil {
+		return nil, err
+	}
+	return s.repo.GetByID(id)
+}
@@ -0,0 +1,79 @@
+package services
+
+import (
+	"strings"
+	"testing"
+
+	"gorm.io/gorm"
+
+	"invoice-agent/internal/app/models"
+)
+
+// stubDuplicateFinder 按文件SHA-256、票据标识和合计金额在固定的票据中查找
+type stubDuplicateFinder struct {
+	files []models.InvoiceFile
+}
+
+func (s *stubDuplicateFinder) FindBySHA256(sha256 string, beforeID uint64) (*models.InvoiceFile, error) {
+	for i := range s.files {
+		if s.files[i].SHA256 == sha256 && s.files[i].ID < beforeID {
+			return &s.files[i], nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (s *stubDuplicateFinder) FindByIdentityKey(identityKey string, beforeID uint64) (*models.InvoiceFile, error) {
+	for i := range s.files {
+		if s.files[i].ComputeIdentityKey() == identityKey && s.files[i].ID < beforeID {
+			return &s.files[i], nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (s *stubDuplicateFinder) ListImageHashes(totalAmount float64, beforeID uint64) ([]models.InvoiceFile, error) {
+	candidates := make([]models.InvoiceFile, 0)
+	for _, file := range s.files {
+		if file.TotalAmount == totalAmount && file.ImageHash != "" && file.ID < beforeID {
+			candidates = append(candidates, file)
+		}
+	}
+	return candidates, nil
+}
+
+func TestFindDuplicateTiers(t *testing.T) {
+	earlier := models.InvoiceFile{
+		ID: 1, FileID: "file-1", FileName: "taxi.pdf", SessionId: "s-1", SHA256: "sha-1", ImageHash: "f0f0f0f0f0f0f0f0",
+		InvoiceCode: "25312000000087654321", IssueDate: "2025年03月01日", SellerID: "91110000MA01ABCD1X", SellerName: "北京滴滴出行科技有限公司", TotalAmount: 86.5,
+	}
+	finder := &stubDuplicateFinder{files: []models.InvoiceFile{earlier}}
+
+	cases := []struct {
+		name   string
+		file   models.InvoiceFile
+		reason string // 期望的重复原因，为空表示不重复
+	}{
+		{"同一个文件", models.InvoiceFile{ID: 2, SHA256: "sha-1"}, "是同一个文件"},
+		{"票据标识相同", models.InvoiceFile{ID: 2, SHA256: "sha-2", InvoiceCode: "25312000000087654321", IssueDate: "2025-03-01", SellerID: "91110000ma01abcd1x", TotalAmount: 86.5}, "发票号码、开票日期、销售方和金额相同"},
+		{"图片相似且开票日期相同", models.InvoiceFile{ID: 2, SHA256: "sha-2", ImageHash: "f0f0f0f0f0f0f0f1", InvoiceCode: "25312000000087654329", IssueDate: "2025年3月1日", TotalAmount: 86.5}, "图片相似且金额相同"},
+		{"图片相似但开票日期和销售方都不同", models.InvoiceFile{ID: 2, SHA256: "sha-2", ImageHash: "f0f0f0f0f0f0f0f1", InvoiceCode: "25312000000087654329", IssueDate: "2025年04月01日", SellerName: "北京首汽约车有限公司", TotalAmount: 86.5}, ""},
+		{"图片不相似", models.InvoiceFile{ID: 2, SHA256: "sha-2", ImageHash: "0f0f0f0f0f0f0f0f", IssueDate: "2025年03月01日", TotalAmount: 86.5}, ""},
+		{"更早上传的票据才算重复", models.InvoiceFile{ID: 1, SHA256: "sha-1"}, ""},
+	}
+	for _, c := range cases {
+		duplicateOf, reason, err := findDuplicate(finder, &c.file, c.file.ComputeIdentityKey())
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		if c.reason == "" {
+			if duplicateOf != "" {
+				t.Errorf("%s: 不应判为重复: %s", c.name, reason)
+			}
+			continue
+		}
+		if duplicateOf != "file-1" || !strings.Contains(reason, c.reason) {
+			t.Errorf("%s: 重复票据 %q，原因 %q，期望原因包含 %q", c.name, duplicateOf, reason, c.reason)
+		}
+	}
+}
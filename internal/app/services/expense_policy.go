@@ -0,0 +1,249 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"invoice-agent/internal/app/models"
+	"invoice-agent/pkg/config"
+)
+
+// EvaluateExpensePolicy 按公司报销政策检查报销单按费用类别统计后的票据，返回不符合政策的结果
+func EvaluateExpensePolicy(items []models.CostItem) models.RuleViolations {
+	policy := config.GetExpensePolicy()
+	violations := make(models.RuleViolations, 0)
+	if !policy.Enabled {
+		return violations
+	}
+	violations = append(violations, checkCategoryCaps(policy, items)...)
+	violations = append(violations, checkDailyLimits(policy, items)...)
+	violations = append(violations, checkDisallowed(policy, items)...)
+	violations = append(violations, checkAttachments(policy, items)...)
+	return violations
+}
+
+func checkCategoryCaps(policy config.ExpensePolicy, items []models.CostItem) []models.RuleViolation {
+	violations := make([]models.RuleViolation, 0)
+	for _, item := range items {
+		limit, ok := policy.CategoryCaps[item.Category]
+		if !ok || limit <= 0 {
+			continue
+		}
+		cost, _ := strconv.ParseFloat(item.Cost, 64)
+		if cost > limit {
+			violations = append(violations, models.RuleViolation{
+				Rule:     "category_cap",
+				Field:    "total_amount",
+				Severity: models.RuleSeverityError,
+				Message:  fmt.Sprintf("%s合计%.2f元，超过单次报销上限%.2f元", item.Category, cost, limit),
+			})
+		}
+	}
+	return violations
+}
+
+func checkDailyLimits(policy config.ExpensePolicy, items []models.CostItem) []models.RuleViolation {
+	violations := make([]models.RuleViolation, 0)
+	for _, limit := range policy.DailyLimits {
+		// 无法按明细折算天数的发票，同一开票日期、同一城市等级合计计算
+		type dayKey struct{ date, tier string }
+		totals := make(map[dayKey]float64)
+		keys := make([]dayKey, 0)
+		for _, invoice := range policyInvoices(items) {
+			amount, days, ok := dailyAmount(invoice, limit)
+			if !ok {
+				continue
+			}
+			tier := cityTier(policy, invoice.SellerName)
+			dailyMax, ok := limit.Limits[tier]
+			if !ok || dailyMax <= 0 {
+				continue
+			}
+			if days > 0 {
+				if amount/days > dailyMax {
+					violations = append(violations, models.RuleViolation{
+						Rule:     "daily_limit",
+						Field:    "total_amount",
+						Severity: models.RuleSeverityError,
+						Message: fmt.Sprintf("%s %s%.2f元共%g天，每天%.2f元，超过%s城市每日限额%.2f元",
+							invoice.FileName, limit.Name, amount, days, amount/days, tier, dailyMax),
+					})
+				}
+				continue
+			}
+			key := dayKey{date: invoice.IssueDate, tier: tier}
+			if _, exists := totals[key]; !exists {
+				keys = append(keys, key)
+			}
+			totals[key] += amount
+		}
+		for _, key := range keys {
+			dailyMax := limit.Limits[key.tier]
+			if totals[key] <= dailyMax {
+				continue
+			}
+			// 按天数计算的限额缺少明细时可能是多天的费用，只提示人工核对
+			if len(limit.Units) > 0 {
+				violations = append(violations, models.RuleViolation{
+					Rule:     "daily_limit",
+					Field:    "total_amount",
+					Severity: models.RuleSeverityWarning,
+					Message: fmt.Sprintf("%s %s合计%.2f元，发票没有明细无法确定天数，按1天计算超过%s城市每日限额%.2f元，请核对",
+						key.date, limit.Name, totals[key], key.tier, dailyMax),
+				})
+				continue
+			}
+			violations = append(violations, models.RuleViolation{
+				Rule:     "daily_limit",
+				Field:    "total_amount",
+				Severity: models.RuleSeverityError,
+				Message: fmt.Sprintf("%s %s合计%.2f元，超过%s城市每日限额%.2f元",
+					key.date, limit.Name, totals[key], key.tier, dailyMax),
+			})
+		}
+	}
+	return violations
+}
+
+// dailyAmount 发票中计入每日限额的金额和天数。有明细时只计算匹配的明细，
+// 计量单位为 Units 之一时数量即为天数；没有明细时按项目名称匹配整张发票，天数为0
+func dailyAmount(invoice models.InvoiceFile, limit config.PolicyDailyLimit) (float64, float64, bool) {
+	if len(invoice.Items) == 0 {
+		return invoice.TotalAmount, 0, containsAny(invoice.ItemName, limit.Keywords)
+	}
+	var amount, days float64
+	matched := false
+	for _, item := range invoice.Items {
+		if !containsAny(item.Name, limit.Keywords) {
+			continue
+		}
+		matched = true
+		amount += item.Amount + item.TaxAmount
+		if item.Quantity > 0 && containsAny(item.Unit, limit.Units) {
+			days += item.Quantity
+		}
+	}
+	return amount, days, matched
+}
+
+func checkDisallowed(policy config.ExpensePolicy, items []models.CostItem) []models.RuleViolation {
+	violations := make([]models.RuleViolation, 0)
+	for _, item := range items {
+		for _, invoice := range item.Invoices {
+			for _, rule := range policy.Disallowed {
+				if rule.Keyword == "" || !invoiceMentions(invoice, rule) {
+					continue
+				}
+				if len(rule.Categories) > 0 && !containsValue(rule.Categories, item.Category) {
+					continue
+				}
+				message := rule.Message
+				if message == "" {
+					message = fmt.Sprintf("包含不允许报销的项目：%s", rule.Keyword)
+				}
+				violations = append(violations, models.RuleViolation{
+					Rule:     "disallowed",
+					Field:    "item_name",
+					Severity: models.RuleSeverityError,
+					Message:  fmt.Sprintf("%s（%s %.2f元）：%s", invoice.FileName, invoice.ItemName, invoice.TotalAmount, message),
+				})
+				break
+			}
+		}
+	}
+	return violations
+}
+
+// invoiceMentions 发票的项目名称（有明细时逐条检查）去掉排除词后是否包含关键字
+func invoiceMentions(invoice models.InvoiceFile, rule config.PolicyKeyword) bool {
+	names := []string{invoice.ItemName}
+	if len(invoice.Items) > 0 {
+		names = names[:0]
+		for _, item := range invoice.Items {
+			names = append(names, item.Name)
+		}
+	}
+	for _, name := range names {
+		for _, exclude := range rule.Exclude {
+			if exclude != "" {
+				name = strings.ReplaceAll(name, exclude, "")
+			}
+		}
+		if strings.Contains(name, rule.Keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkAttachments 需要附件的发票都要有关联的附件，如每张出租车发票都要有一张配对的行程单
+func checkAttachments(policy config.ExpensePolicy, items []models.CostItem) []models.RuleViolation {
+	violations := make([]models.RuleViolation, 0)
+	for _, rule := range policy.Attachments {
+		attached := make(map[uint64]bool)
+		for _, item := range items {
+			for _, invoice := range item.Invoices {
+				if invoice.ServiceType == models.ServiceTypeNonInvoice && invoice.ParentID != 0 &&
+					containsAny(invoice.ItemName+" "+invoice.InvoiceType+" "+invoice.FileName, rule.Requires) {
+					attached[invoice.ParentID] = true
+				}
+			}
+		}
+		missing := make([]string, 0)
+		for _, invoice := range policyInvoices(items) {
+			if containsAny(invoice.ItemName+" "+invoice.InvoiceType, rule.Keywords) && !attached[invoice.ID] {
+				missing = append(missing, invoice.FileName)
+			}
+		}
+		if len(missing) > 0 {
+			sort.Strings(missing)
+			requires := strings.Join(rule.Requires, "/")
+			violations = append(violations, models.RuleViolation{
+				Rule:     "attachment",
+				Field:    "service_type",
+				Severity: models.RuleSeverityError,
+				Message:  fmt.Sprintf("%s需要附%s：%s 没有配对的%s", rule.Name, requires, strings.Join(missing, "、"), requires),
+			})
+		}
+	}
+	return violations
+}
+
+// policyInvoices 统计中的全部发票类票据
+func policyInvoices(items []models.CostItem) []models.InvoiceFile {
+	invoices := make([]models.InvoiceFile, 0)
+	for _, item := range items {
+		for _, invoice := range item.Invoices {
+			if invoice.ServiceType == models.ServiceTypeInvoice {
+				invoices = append(invoices, invoice)
+			}
+		}
+	}
+	return invoices
+}
+
+// cityTier 按销售方名称中出现的城市确定城市等级
+func cityTier(policy config.ExpensePolicy, sellerName string) string {
+	tiers := make([]string, 0, len(policy.CityTiers))
+	for tier := range policy.CityTiers {
+		tiers = append(tiers, tier)
+	}
+	sort.Strings(tiers)
+	for _, tier := range tiers {
+		if containsAny(sellerName, policy.CityTiers[tier]) {
+			return tier
+		}
+	}
+	return policy.DefaultTier
+}
+
+func containsAny(text string, keywords []string) bool {
+	for _, keyword := range keywords {
+		if keyword != "" && strings.Contains(text, keyword) {
+			return true
+		}
+	}
+	return false
+}
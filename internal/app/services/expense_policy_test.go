@@ -0,0 +1,88 @@
+package services
+
+import (
+	"strings"
+	"testing"
+
+	"invoice-agent/internal/app/models"
+)
+
+func policyRules(violations models.RuleViolations, rule string) models.RuleViolations {
+	result := make(models.RuleViolations, 0)
+	for _, v := range violations {
+		if v.Rule == rule {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+func hotelInvoice(id uint64, total, nights float64) models.InvoiceFile {
+	invoice := models.InvoiceFile{
+		ID: id, FileName: "hotel.ofd", ServiceType: models.ServiceTypeInvoice, IssueDate: "2025年03月12日",
+		SellerName: "上海浦东某某酒店管理有限公司", ItemName: "*住宿服务*住宿费", TotalAmount: total,
+	}
+	if nights > 0 {
+		invoice.Items = models.InvoiceItems{{Name: "*住宿服务*住宿费", Unit: "晚", Quantity: nights, Amount: total}}
+	}
+	return invoice
+}
+
+func TestExpensePolicyDailyLimitByNights(t *testing.T) {
+	loadDevConfig(t)
+
+	// 一线城市住宿每晚600元，1200元住3晚不超标
+	violations := EvaluateExpensePolicy([]models.CostItem{{Category: "差旅费", Cost: "1200.00", Invoices: []models.InvoiceFile{hotelInvoice(1, 1200, 3)}}})
+	if limits := policyRules(violations, "daily_limit"); len(limits) > 0 {
+		t.Errorf("1200元3晚不应超过每日限额: %v", limits)
+	}
+
+	violations = EvaluateExpensePolicy([]models.CostItem{{Category: "差旅费", Cost: "1500.00", Invoices: []models.InvoiceFile{hotelInvoice(1, 1500, 2)}}})
+	if limits := policyRules(violations, "daily_limit"); len(limits) != 1 || !strings.Contains(limits[0].Message, "每天750.00元") {
+		t.Errorf("1500元2晚应超过每日限额: %v", limits)
+	}
+
+	// 没有明细时无法确定晚数，只提示不拦截
+	violations = EvaluateExpensePolicy([]models.CostItem{{Category: "差旅费", Cost: "1200.00", Invoices: []models.InvoiceFile{hotelInvoice(1, 1200, 0)}}})
+	if limits := policyRules(violations, "daily_limit"); len(limits) != 1 || limits[0].Severity != models.RuleSeverityWarning {
+		t.Errorf("没有明细的住宿发票超额时应只提示: %v", limits)
+	}
+	if violations.HasErrors() {
+		t.Errorf("没有明细的住宿发票不应拦截填报: %v", violations)
+	}
+}
+
+func TestExpensePolicyDisallowedExcludesHotel(t *testing.T) {
+	loadDevConfig(t)
+
+	hotelDinner := models.InvoiceFile{ID: 1, FileName: "dinner.pdf", ServiceType: models.ServiceTypeInvoice, ItemName: "*餐饮服务*酒店餐饮", TotalAmount: 260}
+	violations := EvaluateExpensePolicy([]models.CostItem{{Category: "业务招待费", Cost: "260.00", Invoices: []models.InvoiceFile{hotelDinner}}})
+	if disallowed := policyRules(violations, "disallowed"); len(disallowed) > 0 {
+		t.Errorf("酒店餐饮不是酒类: %v", disallowed)
+	}
+
+	liquor := models.InvoiceFile{ID: 2, FileName: "liquor.pdf", ServiceType: models.ServiceTypeInvoice, ItemName: "*酒*白酒", TotalAmount: 260}
+	violations = EvaluateExpensePolicy([]models.CostItem{{Category: "业务招待费", Cost: "260.00", Invoices: []models.InvoiceFile{liquor}}})
+	if disallowed := policyRules(violations, "disallowed"); len(disallowed) != 1 {
+		t.Errorf("白酒应不允许报销: %v", disallowed)
+	}
+}
+
+func TestExpensePolicyAttachmentsPerInvoice(t *testing.T) {
+	loadDevConfig(t)
+
+	taxi := func(id uint64, name string) models.InvoiceFile {
+		return models.InvoiceFile{ID: id, FileName: name, ServiceType: models.ServiceTypeInvoice, ItemName: "*运输服务*客运服务费", TotalAmount: 50}
+	}
+	itinerary := func(id, parentID uint64) models.InvoiceFile {
+		return models.InvoiceFile{ID: id, FileName: "行程单.pdf", ServiceType: models.ServiceTypeNonInvoice, InvoiceType: "行程单", ParentID: parentID, TotalAmount: 50}
+	}
+	// 第二张行程单没有与发票配对，不能算作 taxi-2 的附件
+	items := []models.CostItem{{Category: "市内交通费", Cost: "100.00", Invoices: []models.InvoiceFile{
+		taxi(1, "taxi-1.pdf"), itinerary(2, 1), taxi(3, "taxi-2.pdf"), itinerary(4, 0),
+	}}}
+	attachments := policyRules(EvaluateExpensePolicy(items), "attachment")
+	if len(attachments) != 1 || strings.Contains(attachments[0].Message, "taxi-1.pdf") || !strings.Contains(attachments[0].Message, "taxi-2.pdf") {
+		t.Errorf("只有 taxi-2.pdf 缺少行程单: %v", attachments)
+	}
+}
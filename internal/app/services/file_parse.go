@@ -0,0 +1,141 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"invoice-agent/internal/app/models"
+	"invoice-agent/internal/pkg/schema"
+	"invoice-agent/pkg/config"
+)
+
+// 未配置时的最大重新识别次数
+const defaultParseMaxRetries = 2
+
+// 未配置时的人工审核置信度阈值
+const defaultReviewThreshold = 0.8
+
+// invoiceOutputSchema 票据识别结果的Schema，由 models.InvoiceFile 的 schema 标签生成
+var invoiceOutputSchema = schema.ArrayOf(schema.FromStruct(models.InvoiceFile{}))
+
+// FileParseFailure 单个文件的识别失败原因
+type FileParseFailure struct {
+	FileID   string   `json:"file_id"`
+	FileName string   `json:"file_name,omitempty"`
+	Errors   []string `json:"errors"`
+}
+
+// FileParseError 票据识别结果校验失败
+type FileParseError struct {
+	Message string             `json:"message"`
+	Files   []FileParseFailure `json:"files"`
+}
+
+func (e *FileParseError) Error() string {
+	return e.Message
+}
+
+// Feedback 生成重新识别时附加给模型的提示
+func (e *FileParseError) Feedback(output string) string {
+	var errs strings.Builder
+	for _, f := range e.Files {
+		for _, msg := range f.Errors {
+			errs.WriteString(fmt.Sprintf("- 文件%s: %s\n", f.FileID, msg))
+		}
+	}
+	prompt := config.GetOpenaiConf().RepairPrompt
+	prompt = strings.Replace(prompt, "{{last_output}}", output, 1)
+	return strings.Replace(prompt, "{{errors}}", errs.String(), 1)
+}
+
+// ParseMaxRetries 校验失败后重新识别的最大次数，配置为 0 时不重试
+func ParseMaxRetries() int {
+	if n := config.GetOpenaiConf().ParseMaxRetries; n != nil && *n >= 0 {
+		return *n
+	}
+	return defaultParseMaxRetries
+}
+
+// ReviewThreshold 字段置信度低于该值的票据进入人工审核，配置为 0 时不审核
+func ReviewThreshold() float64 {
+	if t := config.GetOpenaiConf().ReviewThreshold; t != nil && *t >= 0 {
+		return *t
+	}
+	return defaultReviewThreshold
+}
+
+// ValidateFileParseOutput 修复并校验票据识别结果，返回识别出的票据或按文件归类的错误
+func ValidateFileParseOutput(content string, fileIds []string) ([]models.InvoiceFile, *FileParseError) {
+	repaired := schema.Repair(content)
+
+	var raw []map[string]interface{}
+	violations, err := invoiceOutputSchema.ValidateJSON([]byte(repaired))
+	if err == nil {
+		err = json.Unmarshal([]byte(repaired), &raw)
+	}
+	if err != nil {
+		failures := make([]FileParseFailure, 0, len(fileIds))
+		for _, fileId := range fileIds {
+			failures = append(failures, FileParseFailure{FileID: fileId, Errors: []string{"输出不是合法的JSON数组: " + err.Error()}})
+		}
+		return nil, &FileParseError{Message: "JSON解析失败", Files: failures}
+	}
+
+	failures := make(map[string]*FileParseFailure)
+	order := make([]string, 0)
+	addFailure := func(fileId, fileName, msg string) {
+		if _, exists := failures[fileId]; !exists {
+			failures[fileId] = &FileParseFailure{FileID: fileId, FileName: fileName}
+			order = append(order, fileId)
+		}
+		failures[fileId].Errors = append(failures[fileId].Errors, msg)
+	}
+
+	for _, v := range violations {
+		fileId, fileName := elementFile(raw, v.Index, fileIds)
+		addFailure(fileId, fileName, v.String())
+	}
+
+	// 每个请求的文件都必须有识别结果
+	returned := make(map[string]bool, len(raw))
+	for _, item := range raw {
+		if fileId, ok := item["file_id"].(string); ok {
+			returned[strings.TrimSpace(fileId)] = true
+		}
+	}
+	for _, fileId := range fileIds {
+		if !returned[fileId] {
+			addFailure(fileId, "", "未返回该文件的识别结果")
+		}
+	}
+
+	if len(order) > 0 {
+		result := &FileParseError{Message: fmt.Sprintf("%d个文件识别结果校验失败", len(order))}
+		for _, fileId := range order {
+			result.Files = append(result.Files, *failures[fileId])
+		}
+		return nil, result
+	}
+
+	var invoiceFiles []models.InvoiceFile
+	if err := json.Unmarshal([]byte(repaired), &invoiceFiles); err != nil {
+		return nil, &FileParseError{Message: "JSON解析失败: " + err.Error()}
+	}
+	return invoiceFiles, nil
+}
+
+// elementFile 定位校验错误所属的文件，优先使用输出中的file_id
+func elementFile(raw []map[string]interface{}, index int, fileIds []string) (string, string) {
+	if index < 0 || index >= len(raw) {
+		return "$", ""
+	}
+	fileName, _ := raw[index]["file_name"].(string)
+	if fileId, ok := raw[index]["file_id"].(string); ok && fileId != "" {
+		return fileId, fileName
+	}
+	if index < len(fileIds) {
+		return fileIds[index], fileName
+	}
+	return fmt.Sprintf("第%d条", index+1), fileName
+}
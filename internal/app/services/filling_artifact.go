@@ -0,0 +1,198 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/playwright-community/playwright-go"
+	log "github.com/sirupsen/logrus"
+
+	"invoice-agent/internal/app/models"
+	"invoice-agent/pkg/config"
+)
+
+// ArtifactDir 填报任务截图、页面快照和追踪文件的保存目录
+const ArtifactDir = "/app/output/artifacts"
+
+// 步骤截图与页面快照的保存时机
+const (
+	CaptureFailure = "failure"
+	CaptureAlways  = "always"
+	CaptureNone    = "none"
+)
+
+const traceFile = "trace.zip"
+
+// artifactPath 任务记录的文件目录，同一任务ID多次执行互不覆盖
+func artifactPath(taskID string, recordID uint64) string {
+	return filepath.Join(ArtifactDir, taskID, strconv.FormatUint(recordID, 10))
+}
+
+// captureMode 步骤配置优先，其次脚本默认，都未配置时只在失败时保存
+func captureMode(script config.FormScript, step config.FormStep) string {
+	switch {
+	case step.Capture != "":
+		return step.Capture
+	case script.Capture != "":
+		return script.Capture
+	default:
+		return CaptureFailure
+	}
+}
+
+// captureStep 按配置保存步骤执行后的截图和HTML快照
+func (s *AutoFillingService) captureStep(instance *AutoFillingInstance, taskInfo *TaskInfo, step config.FormStep, stepErr error) {
+	if instance.artifactDir == "" || errors.Is(stepErr, errPreviewDone) {
+		return
+	}
+	mode := captureMode(instance.script, step)
+	if mode == CaptureNone || (stepErr == nil && mode != CaptureAlways) {
+		return
+	}
+
+	result := "ok"
+	if stepErr != nil {
+		result = "failed"
+	}
+	instance.captureSeq++
+	name := fmt.Sprintf("step-%03d-%s-%s", instance.captureSeq, artifactName(step.Name), result)
+	screenshot := s.saveScreenshot(instance, taskInfo, name+".png", true)
+	snapshot := s.saveHTML(instance, taskInfo, name+".html")
+	if stepErr != nil && (screenshot != "" || snapshot != "") {
+		s.sendProgress(taskInfo, fmt.Sprintf("> 已保存%s出错时的截图和页面快照: %s", step.Name, name))
+	}
+}
+
+// saveScreenshot 保存截图，返回文件名；截图失败不影响任务
+func (s *AutoFillingService) saveScreenshot(instance *AutoFillingInstance, taskInfo *TaskInfo, name string, fullPage bool) string {
+	if !ensureArtifactDir(instance, taskInfo) {
+		return ""
+	}
+	if _, err := instance.page.Screenshot(playwright.PageScreenshotOptions{
+		Path:     playwright.String(filepath.Join(instance.artifactDir, name)),
+		FullPage: playwright.Bool(fullPage),
+	}); err != nil {
+		log.Errorf("[Task %s] 截图失败: %v", taskInfo.ID, err)
+		return ""
+	}
+	return name
+}
+
+// saveHTML 保存当前页面的HTML，返回文件名
+func (s *AutoFillingService) saveHTML(instance *AutoFillingInstance, taskInfo *TaskInfo, name string) string {
+	if !ensureArtifactDir(instance, taskInfo) {
+		return ""
+	}
+	content, err := instance.page.Content()
+	if err != nil {
+		log.Errorf("[Task %s] 获取页面HTML失败: %v", taskInfo.ID, err)
+		return ""
+	}
+	if err := os.WriteFile(filepath.Join(instance.artifactDir, name), []byte(content), 0644); err != nil {
+		log.Errorf("[Task %s] 保存页面HTML失败: %v", taskInfo.ID, err)
+		return ""
+	}
+	return name
+}
+
+// startTrace 按脚本配置开始记录 Playwright 追踪，任务结束清理实例时保存
+func (s *AutoFillingService) startTrace(instance *AutoFillingInstance, taskInfo *TaskInfo) {
+	if !instance.script.Trace || instance.context == nil || !ensureArtifactDir(instance, taskInfo) {
+		return
+	}
+	if err := instance.context.Tracing().Start(playwright.TracingStartOptions{
+		Title:       playwright.String(taskInfo.ID),
+		Screenshots: playwright.Bool(true),
+		Snapshots:   playwright.Bool(true),
+	}); err != nil {
+		log.Errorf("[Task %s] 开始追踪失败: %v", taskInfo.ID, err)
+		return
+	}
+	instance.tracing = true
+}
+
+// stopTrace 保存追踪文件，调用方持有实例锁
+func (instance *AutoFillingInstance) stopTrace() {
+	if !instance.tracing {
+		return
+	}
+	instance.tracing = false
+	if err := instance.context.Tracing().Stop(filepath.Join(instance.artifactDir, traceFile)); err != nil {
+		log.Errorf("[Task %s] 保存追踪文件失败: %v", instance.taskID, err)
+	}
+}
+
+func ensureArtifactDir(instance *AutoFillingInstance, taskInfo *TaskInfo) bool {
+	if instance.artifactDir == "" || instance.page == nil {
+		return false
+	}
+	if err := os.MkdirAll(instance.artifactDir, 0755); err != nil {
+		log.Errorf("[Task %s] 创建任务文件目录失败: %v", taskInfo.ID, err)
+		return false
+	}
+	return true
+}
+
+// artifactName 步骤名称中不能出现在文件名里的字符替换为 _
+func artifactName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == ' ' || r == '.' {
+			return '_'
+		}
+		return r
+	}, name)
+}
+
+// ListArtifacts 获取任务ID最近一次执行保存的全部文件
+func (s *AutoFillingService) ListArtifacts(taskID string) ([]models.TaskArtifact, error) {
+	task, err := s.repo.GetLatestByTaskID(taskID)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(artifactPath(taskID, task.ID))
+	if os.IsNotExist(err) {
+		return []models.TaskArtifact{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取任务文件失败: %w", err)
+	}
+
+	artifacts := make([]models.TaskArtifact, 0, len(entries))
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || entry.IsDir() {
+			continue
+		}
+		artifacts = append(artifacts, models.TaskArtifact{
+			Name:      entry.Name(),
+			Kind:      models.ArtifactKindOf(entry.Name()),
+			Size:      info.Size(),
+			CreatedAt: info.ModTime(),
+		})
+	}
+	sort.Slice(artifacts, func(i, j int) bool {
+		return artifacts[i].Name < artifacts[j].Name
+	})
+	return artifacts, nil
+}
+
+// GetArtifact 获取任务ID最近一次执行保存的文件路径
+func (s *AutoFillingService) GetArtifact(taskID, name string) (string, error) {
+	task, err := s.repo.GetLatestByTaskID(taskID)
+	if err != nil {
+		return "", err
+	}
+	if name == "" || name != filepath.Base(name) {
+		return "", fmt.Errorf("文件名错误: %s", name)
+	}
+	path := filepath.Join(artifactPath(taskID, task.ID), name)
+	if _, err := os.Stat(path); err != nil {
+		return "", fmt.Errorf("文件不存在: %s", name)
+	}
+	return path, nil
+}
@@ -0,0 +1,45 @@
+package services
+
+import (
+	"fmt"
+
+	"invoice-agent/internal/app/models"
+)
+
+// FillingCheck 开始填报前对报销单的检查结果
+type FillingCheck struct {
+	Username   string
+	Password   string
+	Files      []models.InvoiceFile  // 参与报销的票据，不含待人工审核的票据
+	Pending    []models.InvoiceFile  // 待人工审核、本次不报销的票据
+	Duplicates []models.InvoiceFile  // 疑似重复报销、需人工确认的票据
+	CostItems  *[]models.CostItem    // 按费用类别统计的报销明细
+	Violations models.RuleViolations // 不符合报销政策的项目
+}
+
+// Blocked 有疑似重复报销的票据或不符合报销政策时不能填报
+func (c *FillingCheck) Blocked() bool {
+	return len(c.Duplicates) > 0 || c.Violations.HasErrors()
+}
+
+// CheckBeforeFilling 开始填报前重新配对行程单，获取OA账号，并检查重复报销、待审核票据和报销政策；
+// 对话中的“报销”指令和模型调用的 start_filling 工具都使用这里的检查
+func CheckBeforeFilling(sessionId, userId string) (*FillingCheck, error) {
+	// 重新配对行程单，识别后修正过的票据也能正确合并
+	files, err := InvoiceFile.PairItineraries(sessionId)
+	if err != nil {
+		return nil, fmt.Errorf("获取报销单票据失败: %w", err)
+	}
+	check := &FillingCheck{}
+	check.Username, check.Password, err = Credential.GetCredential(userId)
+	if err != nil {
+		return nil, fmt.Errorf("获取OA账号失败: %w", err)
+	}
+	if check.Duplicates = models.BlockedDuplicates(files); len(check.Duplicates) > 0 {
+		return check, nil
+	}
+	check.Files, check.Pending = models.SplitByReview(files)
+	check.CostItems = models.StatByExpenseCategory(check.Files)
+	check.Violations = EvaluateExpensePolicy(*check.CostItems)
+	return check, nil
+}
@@ -0,0 +1,146 @@
+package services
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/playwright-community/playwright-go"
+	log "github.com/sirupsen/logrus"
+
+	"invoice-agent/pkg/config"
+)
+
+// 填报队列未配置时的默认值
+const (
+	DefaultFillingWorkers   = 2
+	DefaultFillingQueueSize = 20
+)
+
+// 测试OA账号时等待空闲浏览器的最长时间
+const loginSlotTimeout = time.Minute
+
+// fillingJob 等待执行的填报任务
+type fillingJob struct {
+	instance *AutoFillingInstance
+	taskInfo *TaskInfo
+}
+
+// startWorkers 按配置启动固定数量的 worker，从队列中依次取任务执行
+func (s *AutoFillingService) startWorkers(conf config.App) {
+	workers := conf.FillingWorkers
+	if workers <= 0 {
+		workers = DefaultFillingWorkers
+	}
+	s.queueSize = conf.FillingQueueSize
+	if s.queueSize <= 0 {
+		s.queueSize = DefaultFillingQueueSize
+	}
+	s.queue = make(chan *fillingJob, s.queueSize)
+	s.slots = make(chan struct{}, workers)
+
+	for i := 0; i < workers; i++ {
+		go s.worker()
+	}
+	log.Infof("自动填报队列已启动, workers: %d, queue_size: %d", workers, s.queueSize)
+}
+
+func (s *AutoFillingService) worker() {
+	for job := range s.queue {
+		// 账号测试占用浏览器时继续排队
+		s.slots <- struct{}{}
+		s.dequeue(job.taskInfo.ID)
+		s.executeTask(job.taskInfo.ID, job.instance, job.taskInfo)
+		<-s.slots
+	}
+}
+
+// acquireSlot 在限定时间内占用一个浏览器名额，填报任务和账号测试共用，同时打开的浏览器上下文不超过 worker 数
+func (s *AutoFillingService) acquireSlot(timeout time.Duration) bool {
+	select {
+	case s.slots <- struct{}{}:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+func (s *AutoFillingService) releaseSlot() {
+	<-s.slots
+}
+
+// reserve 为任务占用一个排队位置，队列已满时返回错误
+func (s *AutoFillingService) reserve(taskID string) error {
+	s.queueMutex.Lock()
+	defer s.queueMutex.Unlock()
+
+	if len(s.waiting) >= s.queueSize {
+		return fmt.Errorf("当前排队的报销任务已满（%d个），请稍后再试", s.queueSize)
+	}
+	s.waiting = append(s.waiting, taskID)
+	return nil
+}
+
+// enqueue 将已占位的任务放入队列，并告知排队位置
+func (s *AutoFillingService) enqueue(job *fillingJob) {
+	// 已通过 reserve 占位，队列容量足够，不会阻塞
+	s.queue <- job
+	s.notifyQueuePositions()
+}
+
+// dequeue 任务开始执行或放弃排队时释放位置，并更新其余任务的排队位置
+func (s *AutoFillingService) dequeue(taskID string) {
+	s.queueMutex.Lock()
+	for i, id := range s.waiting {
+		if id == taskID {
+			s.waiting = append(s.waiting[:i], s.waiting[i+1:]...)
+			break
+		}
+	}
+	s.queueMutex.Unlock()
+	s.notifyQueuePositions()
+}
+
+// notifyQueuePositions 向排队中的任务推送当前位置
+func (s *AutoFillingService) notifyQueuePositions() {
+	s.queueMutex.Lock()
+	waiting := append([]string(nil), s.waiting...)
+	s.queueMutex.Unlock()
+
+	for i, taskID := range waiting {
+		taskInfo, ok := s.loadTask(taskID)
+		if !ok || !taskInfo.setQueuePosition(i+1) {
+			continue
+		}
+		if i == 0 {
+			s.sendProgress(taskInfo, "> ⏳ 排队中，下一个执行")
+		} else {
+			s.sendProgress(taskInfo, fmt.Sprintf("> ⏳ 排队中，前面还有 %d 个任务", i))
+		}
+	}
+}
+
+// sharedBrowser 获取共享的浏览器，首次使用或浏览器断开时重新启动
+func (s *AutoFillingService) sharedBrowser() (playwright.Browser, error) {
+	s.browserMutex.Lock()
+	defer s.browserMutex.Unlock()
+
+	if s.browser != nil && s.browser.IsConnected() {
+		return s.browser, nil
+	}
+	if s.pw == nil {
+		pw, err := playwright.Run()
+		if err != nil {
+			return nil, fmt.Errorf("启动报销任务失败: %w", err)
+		}
+		s.pw = pw
+	}
+	browser, err := s.pw.Chromium.Launch(playwright.BrowserTypeLaunchOptions{
+		Headless: playwright.Bool(true),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("启动浏览器失败: %w", err)
+	}
+	s.browser = browser
+	log.Infoln("浏览器启动成功")
+	return browser, nil
+}
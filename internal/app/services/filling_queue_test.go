@@ -0,0 +1,24 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAcquireSlotWaitsForFreeBrowser(t *testing.T) {
+	s := &AutoFillingService{slots: make(chan struct{}, 1)}
+	if !s.acquireSlot(10 * time.Millisecond) {
+		t.Fatal("有空闲名额时应立即占用")
+	}
+	if s.acquireSlot(10 * time.Millisecond) {
+		t.Fatal("名额已满时应等待超时")
+	}
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		s.releaseSlot()
+	}()
+	if !s.acquireSlot(time.Second) {
+		t.Fatal("名额释放后应能占用")
+	}
+}
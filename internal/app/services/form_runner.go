@@ -0,0 +1,457 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/playwright-community/playwright-go"
+
+	"invoice-agent/internal/app/models"
+	"invoice-agent/pkg/config"
+)
+
+// 表单脚本支持的操作
+const (
+	FormActionGoto   = "goto"
+	FormActionFill   = "fill"
+	FormActionClick  = "click"
+	FormActionWait   = "wait"
+	FormActionSleep  = "sleep"
+	FormActionWheel  = "wheel"
+	FormActionSelect = "select"
+	FormActionUpload = "upload"
+	FormActionTable  = "table"
+	FormActionGroup  = "group"
+)
+
+// 下拉选择策略
+const (
+	SelectBestMatch   = "best_match"
+	SelectExactText   = "exact_text"
+	SelectVisibleText = "visible_text"
+	SelectOption      = "option"
+)
+
+const defaultDropdownOption = ".el-select-dropdown__item"
+
+// errPreviewDone 预览模式执行到提交步骤时停止
+var errPreviewDone = errors.New("预览完成，未提交")
+
+// formVars 表单脚本的占位符取值
+type formVars map[string]string
+
+// newFormVars 由填报请求生成占位符取值
+func newFormVars(script config.FormScript, req *models.AutoFillingRequest) formVars {
+	return formVars{
+		"base_url":         script.BaseURL,
+		"session_id":       req.SessionId,
+		"username":         req.Username,
+		"password":         req.Password,
+		"basic.Category":   req.BasicInfo.Category,
+		"basic.Title":      req.BasicInfo.Title,
+		"basic.UrgentType": req.BasicInfo.UrgentType,
+		"basic.Comment":    req.BasicInfo.Comment,
+		"pay.BusinessDept": req.PayInfo.BusinessDept,
+		"pay.BudgetDept":   req.PayInfo.BudgetDept,
+		"pay.PayDept":      req.PayInfo.PayDept,
+		"pay.ProjectType":  req.PayInfo.ProjectType,
+		"pay.Project":      req.PayInfo.Project,
+	}
+}
+
+// with 复制一份并追加取值，用于表格行、上传文件等局部作用域
+func (v formVars) with(extra map[string]string) formVars {
+	vars := make(formVars, len(v)+len(extra))
+	for key, value := range v {
+		vars[key] = value
+	}
+	for key, value := range extra {
+		vars[key] = value
+	}
+	return vars
+}
+
+// render 替换文本中的 {{key}} 占位符
+func (v formVars) render(text string) string {
+	if !strings.Contains(text, "{{") {
+		return text
+	}
+	pairs := make([]string, 0, len(v)*2)
+	for key, value := range v {
+		pairs = append(pairs, "{{"+key+"}}", value)
+	}
+	return strings.NewReplacer(pairs...).Replace(text)
+}
+
+// runFormScript 按表单脚本登录并执行填报
+func (s *AutoFillingService) runFormScript(instance *AutoFillingInstance, taskInfo *TaskInfo) error {
+	if instance.request.DryRun && !hasSubmitStep(instance.script.Steps) {
+		return fmt.Errorf("表单脚本未标记提交步骤，无法预览")
+	}
+	vars := newFormVars(instance.script, instance.request)
+	if err := s.runFormSteps(instance, taskInfo, instance.script.Login, nil, vars); err != nil {
+		return fmt.Errorf("登录失败: %w", err)
+	}
+	// 登录后再开始追踪，追踪中的DOM快照会记录输入框的值
+	s.startTrace(instance, taskInfo)
+	// 登录步骤不记入计划，避免账号密码出现在计划中
+	if instance.request.DryRun {
+		taskInfo.plan = &models.FillingPlan{Digest: instance.request.Digest()}
+	}
+	err := s.runFormSteps(instance, taskInfo, instance.script.Steps, nil, vars)
+	if errors.Is(err, errPreviewDone) {
+		return nil
+	}
+	return err
+}
+
+// hasSubmitStep 脚本中是否有标记为提交的步骤
+func hasSubmitStep(steps []config.FormStep) bool {
+	for _, step := range steps {
+		if step.Submit || hasSubmitStep(step.Steps) {
+			return true
+		}
+	}
+	return false
+}
+
+// runFormSteps 顺序执行步骤，scope 不为空时元素在 scope 内查找
+func (s *AutoFillingService) runFormSteps(instance *AutoFillingInstance, taskInfo *TaskInfo, steps []config.FormStep, scope playwright.Locator, vars formVars) error {
+	for _, step := range steps {
+		if s.isTaskCancelled(instance) {
+			return fmt.Errorf("任务已被取消: %w", instance.ctx.Err())
+		}
+		if err := instance.checkDeadline(); err != nil {
+			s.sendProgress(taskInfo, fmt.Sprintf("%s未执行: %v", step.Name, err))
+			return err
+		}
+		if step.Submit && taskInfo.plan != nil {
+			s.finishPreview(instance, taskInfo)
+			return errPreviewDone
+		}
+
+		var err error
+		switch step.Action {
+		case FormActionUpload:
+			err = s.runFormUpload(instance, taskInfo, step, scope, vars)
+		case FormActionTable:
+			err = s.runFormTable(instance, taskInfo, step, vars)
+		default:
+			err = s.runFormStep(instance, taskInfo, step, scope, vars)
+		}
+		s.captureStep(instance, taskInfo, step, err)
+		if err == nil {
+			taskInfo.stepDone(step.Name, step.Submit)
+			continue
+		}
+		if s.isTaskCancelled(instance) {
+			return fmt.Errorf("任务已被取消: %w", instance.ctx.Err())
+		}
+		if errors.Is(err, errPreviewDone) {
+			return err
+		}
+		if step.Optional {
+			s.sendProgress(taskInfo, fmt.Sprintf("%s出错: %v", step.Name, err))
+			continue
+		}
+		return fmt.Errorf("%s失败: %w", step.Name, err)
+	}
+	return nil
+}
+
+// runFormStep 执行单个步骤并输出进度
+func (s *AutoFillingService) runFormStep(instance *AutoFillingInstance, taskInfo *TaskInfo, step config.FormStep, scope playwright.Locator, vars formVars) error {
+	if step.Progress != "" {
+		s.sendProgress(taskInfo, vars.render(step.Progress))
+	}
+	err := s.withRetry(instance, taskInfo, step, func() error {
+		instance.applyTimeout(step)
+		if err := s.doFormAction(instance, taskInfo, step, scope, vars); err != nil {
+			return err
+		}
+		return s.waitReady(instance, step, scope, vars)
+	})
+	if err != nil {
+		return err
+	}
+	formDelay(instance.ctx, step)
+	if step.Done != "" {
+		s.sendProgress(taskInfo, vars.render(step.Done))
+	}
+	return nil
+}
+
+func (s *AutoFillingService) doFormAction(instance *AutoFillingInstance, taskInfo *TaskInfo, step config.FormStep, scope playwright.Locator, vars formVars) error {
+	page := instance.page
+	switch step.Action {
+	case FormActionGoto:
+		if _, err := page.Goto(vars.render(step.URL)); err != nil {
+			return fmt.Errorf("导航失败: %w", err)
+		}
+	case FormActionFill:
+		value := vars.render(step.Value)
+		if err := formLocate(page, scope, step.Target, vars).Fill(value); err != nil {
+			return fmt.Errorf("填写失败: %w", err)
+		}
+		s.recordPlanField(instance, taskInfo, step, vars, models.PlanField{Value: value, Match: models.PlanMatchInput})
+	case FormActionClick:
+		if err := formLocate(page, scope, step.Target, vars).Click(); err != nil {
+			return fmt.Errorf("点击失败: %w", err)
+		}
+	case FormActionWait:
+		state := playwright.WaitForSelectorStateVisible
+		if step.State != "" {
+			custom := playwright.WaitForSelectorState(step.State)
+			state = &custom
+		}
+		if err := formLocate(page, scope, step.Target, vars).WaitFor(playwright.LocatorWaitForOptions{
+			State: state,
+		}); err != nil {
+			return fmt.Errorf("等待元素失败: %w", err)
+		}
+	case FormActionSleep:
+	case FormActionWheel:
+		if err := page.Mouse().Wheel(step.X, step.Y); err != nil {
+			return fmt.Errorf("滚动失败: %w", err)
+		}
+	case FormActionSelect:
+		return s.doFormSelect(instance, taskInfo, step, scope, vars)
+	case FormActionGroup:
+		return s.runFormSteps(instance, taskInfo, step.Steps, scope, vars)
+	default:
+		return fmt.Errorf("不支持的操作: %s", step.Action)
+	}
+	return nil
+}
+
+// doFormSelect 点击下拉框后按策略选择选项
+func (s *AutoFillingService) doFormSelect(instance *AutoFillingInstance, taskInfo *TaskInfo, step config.FormStep, scope playwright.Locator, vars formVars) error {
+	page := instance.page
+	value := vars.render(step.Value)
+	if err := formLocate(page, scope, step.Target, vars).Click(); err != nil {
+		return fmt.Errorf("点击%s下拉框失败: %w", step.Name, err)
+	}
+
+	field := models.PlanField{Value: value}
+	switch step.Strategy {
+	case SelectBestMatch, "":
+		// 等待选项展开，超时说明没有选项，由 selectDropdownItem 跳过
+		waitAnyVisible(instance.ctx, page.Locator(instance.dropdownOption()), instance.stepTimeout(step))
+		selected, match, err := s.selectDropdownItem(instance, taskInfo, value, step.Name)
+		if err != nil {
+			return err
+		}
+		field.Selected, field.Match = selected, match
+	case SelectExactText:
+		if err := page.GetByText(value, playwright.PageGetByTextOptions{Exact: playwright.Bool(true)}).Click(); err != nil {
+			return fmt.Errorf("选择%s失败: %w", step.Name, err)
+		}
+		field.Selected, field.Match = value, models.PlanMatchExact
+	case SelectVisibleText:
+		waitAnyVisible(instance.ctx, page.GetByText(value), instance.stepTimeout(step))
+		selected, err := clickFirstVisible(page.GetByText(value), step.Name)
+		if err != nil {
+			return err
+		}
+		field.Selected, field.Match = selected, models.PlanMatchFuzzy
+		if selected == "" {
+			field.Match = models.PlanMatchNone
+		}
+	case SelectOption:
+		optionVars := vars.with(map[string]string{"value": value})
+		if err := formLocate(page, nil, step.Option, optionVars).Click(); err != nil {
+			return fmt.Errorf("选择%s失败: %w", step.Name, err)
+		}
+		field.Match = models.PlanMatchOption
+	default:
+		return fmt.Errorf("不支持的下拉选择策略: %s", step.Strategy)
+	}
+	s.recordPlanField(instance, taskInfo, step, vars, field)
+	return nil
+}
+
+// recordPlanField 预览模式下记录字段取值和匹配方式，并截图
+func (s *AutoFillingService) recordPlanField(instance *AutoFillingInstance, taskInfo *TaskInfo, step config.FormStep, vars formVars, field models.PlanField) {
+	if taskInfo.plan == nil {
+		return
+	}
+	field.Step = step.Name
+	field.Row, _ = strconv.Atoi(vars["row"])
+	field.Screenshot = s.saveScreenshot(instance, taskInfo, fmt.Sprintf("preview-%03d.png", len(taskInfo.plan.Fields)+1), false)
+	taskInfo.plan.AddField(field)
+}
+
+// finishPreview 提交前截取整页截图，结束预览
+func (s *AutoFillingService) finishPreview(instance *AutoFillingInstance, taskInfo *TaskInfo) {
+	taskInfo.plan.Screenshot = s.saveScreenshot(instance, taskInfo, "preview-final.png", true)
+	s.sendProgress(taskInfo, fmt.Sprintf("## 👀 预览完成，共%d个字段，未保存到OA，请确认填报计划", len(taskInfo.plan.Fields)))
+}
+
+// runFormUpload 逐个上传文件，每个文件单独输出进度
+func (s *AutoFillingService) runFormUpload(instance *AutoFillingInstance, taskInfo *TaskInfo, step config.FormStep, scope playwright.Locator, vars formVars) error {
+	for _, file := range instance.formFiles(step.Files) {
+		fileVars := vars.with(map[string]string{"file": file, "file_name": filepath.Base(file)})
+		if step.Progress != "" {
+			s.sendProgress(taskInfo, fileVars.render(step.Progress))
+		}
+		err := s.withRetry(instance, taskInfo, step, func() error {
+			instance.applyTimeout(step)
+			if err := formLocate(instance.page, scope, step.Target, fileVars).SetInputFiles([]string{file}); err != nil {
+				return err
+			}
+			return s.waitReady(instance, step, scope, fileVars)
+		})
+		if err != nil {
+			err = fmt.Errorf("上传文件%s失败: %w", filepath.Base(file), err)
+			if !step.Optional {
+				return err
+			}
+			s.sendProgress(taskInfo, fmt.Sprintf("%s出错: %v", step.Name, err))
+			continue
+		}
+		formDelay(instance.ctx, step)
+		if step.Done != "" {
+			s.sendProgress(taskInfo, fileVars.render(step.Done))
+		}
+	}
+	return nil
+}
+
+// runFormTable 为每一项新增一行，再逐行按列填写
+func (s *AutoFillingService) runFormTable(instance *AutoFillingInstance, taskInfo *TaskInfo, step config.FormStep, vars formVars) error {
+	if step.Progress != "" {
+		s.sendProgress(taskInfo, vars.render(step.Progress))
+	}
+	rows := instance.formRows(step.Rows)
+
+	if !step.AddRow.IsEmpty() {
+		instance.applyTimeout(step)
+		for i := range rows {
+			if err := formLocate(instance.page, nil, step.AddRow, vars).Click(); err != nil {
+				s.sendProgress(taskInfo, fmt.Sprintf("添加明细项出错: %v", err))
+				continue
+			}
+			// 等待新增的行出现
+			if err := formLocate(instance.page, nil, step.Row, vars).Nth(i).WaitFor(); err != nil {
+				s.sendProgress(taskInfo, fmt.Sprintf("等待条件未满足: 明细第 %d 行 %s 未出现: %v", i+1, describeLocator(step.Row, vars), err))
+			}
+		}
+	}
+
+	for i, row := range rows {
+		rowVars := vars.with(row).with(map[string]string{"row": strconv.Itoa(i + 1)})
+		rowLocator := formLocate(instance.page, nil, step.Row, rowVars).Nth(i)
+		for _, column := range step.Columns {
+			cell := rowLocator.Locator("td").Nth(column.Column)
+			if err := s.runFormSteps(instance, taskInfo, []config.FormStep{column}, cell, rowVars); err != nil {
+				if !step.Optional {
+					return err
+				}
+				s.sendProgress(taskInfo, fmt.Sprintf("填写%s第 %d 行出错: %v", step.Name, i+1, err))
+				break
+			}
+		}
+	}
+
+	if step.Done != "" {
+		s.sendProgress(taskInfo, vars.render(step.Done))
+	}
+	return nil
+}
+
+// formDelay 步骤配置的固定等待，页面就绪优先使用 wait_for
+func formDelay(ctx context.Context, step config.FormStep) {
+	if step.Delay > 0 {
+		sleepContext(ctx, step.Delay)
+	}
+}
+
+// formLocate 按脚本中的定位配置查找元素
+func formLocate(page playwright.Page, scope playwright.Locator, l config.FormLocator, vars formVars) playwright.Locator {
+	if l.Within != nil {
+		scope = formLocate(page, scope, *l.Within, vars)
+	}
+
+	var locator playwright.Locator
+	switch {
+	case l.Role != "" && scope != nil:
+		locator = scope.GetByRole(playwright.AriaRole(l.Role), playwright.LocatorGetByRoleOptions{Name: vars.render(l.Name)})
+	case l.Role != "":
+		locator = page.GetByRole(playwright.AriaRole(l.Role), playwright.PageGetByRoleOptions{Name: vars.render(l.Name)})
+	case l.Text != "" && scope != nil:
+		locator = scope.GetByText(vars.render(l.Text), playwright.LocatorGetByTextOptions{Exact: playwright.Bool(l.Exact)})
+	case l.Text != "":
+		locator = page.GetByText(vars.render(l.Text), playwright.PageGetByTextOptions{Exact: playwright.Bool(l.Exact)})
+	case scope != nil:
+		locator = scope.Locator(vars.render(l.Selector))
+	default:
+		locator = page.Locator(vars.render(l.Selector))
+	}
+
+	if l.Last {
+		locator = locator.Last()
+	}
+	return locator
+}
+
+// clickFirstVisible 点击第一个可见的元素，返回其文本，没有可见元素时返回空
+func clickFirstVisible(locator playwright.Locator, desc string) (string, error) {
+	count, err := locator.Count()
+	if err != nil {
+		return "", fmt.Errorf("获取%s选项数量失败: %w", desc, err)
+	}
+	for i := 0; i < count; i++ {
+		item := locator.Nth(i)
+		if visible, err := item.IsVisible(); err != nil || !visible {
+			continue
+		}
+		text, _ := item.TextContent()
+		if err := item.Click(); err != nil {
+			return "", fmt.Errorf("选择%s失败: %w", desc, err)
+		}
+		return strings.TrimSpace(text), nil
+	}
+	return "", nil
+}
+
+// dropdownOption 下拉选项的选择器
+func (instance *AutoFillingInstance) dropdownOption() string {
+	if instance.script.DropdownOption != "" {
+		return instance.script.DropdownOption
+	}
+	return defaultDropdownOption
+}
+
+// formFiles 上传步骤引用的文件列表
+func (instance *AutoFillingInstance) formFiles(name string) []string {
+	switch name {
+	case "invoice_files", "":
+		return instance.request.InvoiceFiles
+	case "other_files":
+		return instance.request.OtherFiles
+	default:
+		return nil
+	}
+}
+
+// formRows 表格步骤引用的数据行
+func (instance *AutoFillingInstance) formRows(name string) []map[string]string {
+	rows := make([]map[string]string, 0)
+	if name != "cost_items" || instance.request.CostItems == nil {
+		return rows
+	}
+	for _, item := range *instance.request.CostItems {
+		rows = append(rows, map[string]string{
+			"item.Category":   item.Category,
+			"item.Name":       item.Name,
+			"item.Comment":    item.Comment,
+			"item.Cost":       item.Cost,
+			"item.BillNumber": item.BillNumber,
+		})
+	}
+	return rows
+}
@@ -0,0 +1,197 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/playwright-community/playwright-go"
+
+	"invoice-agent/pkg/config"
+)
+
+// 表单脚本未配置时的默认值
+const (
+	DefaultStepTimeout  = 30 * time.Second
+	DefaultTaskDeadline = 25 * time.Minute // 从开始执行计算，排队时间不计入
+	pollInterval        = 200 * time.Millisecond
+)
+
+// startDeadline 开始计算任务截止时间
+func (instance *AutoFillingInstance) startDeadline() {
+	deadline := instance.script.Deadline
+	if deadline <= 0 {
+		deadline = DefaultTaskDeadline
+	}
+	instance.deadline = time.Now().Add(deadline)
+}
+
+// checkDeadline 任务超过截止时间时返回错误
+func (instance *AutoFillingInstance) checkDeadline() error {
+	if instance.deadline.IsZero() || time.Now().Before(instance.deadline) {
+		return nil
+	}
+	return fmt.Errorf("任务超过截止时间（%s）", instance.deadline.Format("15:04:05"))
+}
+
+// stepTimeout 步骤超时，不超过任务剩余时间
+func (instance *AutoFillingInstance) stepTimeout(step config.FormStep) time.Duration {
+	timeout := step.Timeout
+	if timeout <= 0 {
+		timeout = instance.script.Timeout
+	}
+	if timeout <= 0 {
+		timeout = DefaultStepTimeout
+	}
+	if !instance.deadline.IsZero() {
+		if remaining := time.Until(instance.deadline); remaining < timeout {
+			timeout = remaining
+		}
+	}
+	if timeout < time.Millisecond {
+		timeout = time.Millisecond
+	}
+	return timeout
+}
+
+// applyTimeout 设置页面操作的默认超时，步骤内的点击、填写、等待都使用该超时
+func (instance *AutoFillingInstance) applyTimeout(step config.FormStep) {
+	ms := float64(instance.stepTimeout(step).Milliseconds())
+	instance.page.SetDefaultTimeout(ms)
+	instance.page.SetDefaultNavigationTimeout(ms)
+}
+
+// retryPolicy 步骤的重试策略，分组和表格由内部步骤各自重试，上传按文件重试
+func (instance *AutoFillingInstance) retryPolicy(step config.FormStep) config.FormRetry {
+	switch step.Action {
+	case FormActionGroup, FormActionTable:
+		return config.FormRetry{Attempts: 1}
+	}
+	if step.Retry != nil {
+		return *step.Retry
+	}
+	return instance.script.Retry
+}
+
+// withRetry 按重试策略执行，重试前输出进度，任务取消或超过截止时间后不再重试
+func (s *AutoFillingService) withRetry(instance *AutoFillingInstance, taskInfo *TaskInfo, step config.FormStep, fn func() error) error {
+	policy := instance.retryPolicy(step)
+	attempts := policy.Attempts
+	if attempts < 1 {
+		attempts = 1
+	}
+	backoff := policy.Backoff
+
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		if err = fn(); err == nil {
+			return nil
+		}
+		if attempt == attempts || s.isTaskCancelled(instance) || instance.checkDeadline() != nil {
+			break
+		}
+
+		s.sendProgress(taskInfo, fmt.Sprintf("> %s第 %d 次失败，%v 后重试: %v", step.Name, attempt, backoff, err))
+		select {
+		case <-instance.ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if policy.MaxBackoff > 0 && backoff > policy.MaxBackoff {
+			backoff = policy.MaxBackoff
+		}
+	}
+	if attempts > 1 {
+		return fmt.Errorf("尝试 %d 次后仍失败: %w", attempts, err)
+	}
+	return err
+}
+
+// waitReady 等待步骤配置的就绪条件，失败时说明哪个条件未满足
+func (s *AutoFillingService) waitReady(instance *AutoFillingInstance, step config.FormStep, scope playwright.Locator, vars formVars) error {
+	cond := step.WaitFor
+	if cond == nil {
+		return nil
+	}
+	page := instance.page
+	timeout := playwright.Float(float64(instance.stepTimeout(step).Milliseconds()))
+
+	if cond.URL != "" {
+		url := vars.render(cond.URL)
+		if err := page.WaitForURL(url, playwright.PageWaitForURLOptions{Timeout: timeout}); err != nil {
+			return fmt.Errorf("等待条件未满足: 页面地址匹配 %s（当前 %s）: %w", url, page.URL(), err)
+		}
+	}
+	if cond.LoadState != "" {
+		state := playwright.LoadState(cond.LoadState)
+		if err := page.WaitForLoadState(playwright.PageWaitForLoadStateOptions{State: &state, Timeout: timeout}); err != nil {
+			return fmt.Errorf("等待条件未满足: 页面加载状态 %s: %w", cond.LoadState, err)
+		}
+	}
+	if !cond.Target.IsEmpty() {
+		state := "visible"
+		if cond.State != "" {
+			state = cond.State
+		}
+		waitState := playwright.WaitForSelectorState(state)
+		if err := formLocate(page, scope, cond.Target, vars).WaitFor(playwright.LocatorWaitForOptions{
+			State:   &waitState,
+			Timeout: timeout,
+		}); err != nil {
+			return fmt.Errorf("等待条件未满足: 元素 %s 状态为 %s: %w", describeLocator(cond.Target, vars), state, err)
+		}
+	}
+	return nil
+}
+
+// waitAnyVisible 轮询等待定位到的元素中至少一个可见，超时或取消返回 false
+func waitAnyVisible(ctx context.Context, locator playwright.Locator, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for ctx.Err() == nil {
+		count, _ := locator.Count()
+		for i := 0; i < count; i++ {
+			if visible, _ := locator.Nth(i).IsVisible(); visible {
+				return true
+			}
+		}
+		if time.Now().After(deadline) {
+			return false
+		}
+		sleepContext(ctx, pollInterval)
+	}
+	return false
+}
+
+// sleepContext 等待指定时间，取消时提前返回
+func sleepContext(ctx context.Context, d time.Duration) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+	case <-timer.C:
+	}
+}
+
+// describeLocator 定位配置的可读描述，用于错误信息
+func describeLocator(l config.FormLocator, vars formVars) string {
+	var desc string
+	switch {
+	case l.Role != "" && l.Name != "":
+		desc = fmt.Sprintf("%s[name=%s]", l.Role, vars.render(l.Name))
+	case l.Role != "":
+		desc = l.Role
+	case l.Text != "":
+		desc = fmt.Sprintf("文本 %q", vars.render(l.Text))
+	default:
+		desc = vars.render(l.Selector)
+	}
+	if l.Last {
+		desc += "（最后一个）"
+	}
+	if l.Within != nil {
+		desc = strings.Join([]string{describeLocator(*l.Within, vars), desc}, " 内的 ")
+	}
+	return desc
+}
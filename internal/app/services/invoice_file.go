@@ -2,6 +2,10 @@
 package services
 
 import (
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+
 	"invoice-agent/internal/app/models"
 	"invoice-agent/internal/app/repositories"
 )
@@ -16,6 +20,12 @@ type IInvoiceFile interface {
 	ListInvoiceFiles(limit, offset int) ([]models.InvoiceFile, error)
 	ListInvoiceFilesByCont(invoiceFile models.InvoiceFile, limit, offset int) ([]models.InvoiceFile, error)
 	DeleteInvoiceFile(id uint64) error
+	ListPendingReview(sessionId string, limit, offset int) ([]models.InvoiceFile, error)
+	CorrectInvoiceFile(id uint64, invoiceFile *models.InvoiceFile, zeroFields ...string) (*models.InvoiceFile, error)
+	ApproveInvoiceFile(id uint64) (*models.InvoiceFile, error)
+	CheckDuplicate(fileId string) (*models.InvoiceFile, error)
+	OverrideDuplicate(id uint64) (*models.InvoiceFile, error)
+	PairItineraries(sessionId string) ([]models.InvoiceFile, error)
 }
 type InvoiceFileService struct {
 	repo *repositories.InvoiceFileRepository
@@ -28,18 +38,49 @@ func NewInvoiceFileService() IInvoiceFile {
 }
 
 func (s *InvoiceFileService) CreateInvoiceFile(invoiceFile *models.InvoiceFile) error {
-	return s.repo.Create(invoiceFile)
+	if err := s.repo.Create(invoiceFile); err != nil {
+		return err
+	}
+	// 校验结果保存失败不影响票据创建，下次更新时会重新校验
+	if err := s.applyInvoiceRules(invoiceFile); err != nil {
+		log.Warnf("票据业务规则校验失败, file_id: %s, err: %v", invoiceFile.FileID, err)
+	}
+	return nil
 }
 
 func (s *InvoiceFileService) CreateInvoiceFilesBatch(invoiceFiles []models.InvoiceFile) error {
-	return s.repo.CreateBatch(invoiceFiles)
+	if err := s.repo.CreateBatch(invoiceFiles); err != nil {
+		return err
+	}
+	for i := range invoiceFiles {
+		if err := s.applyInvoiceRules(&invoiceFiles[i]); err != nil {
+			log.Warnf("票据业务规则校验失败, file_id: %s, err: %v", invoiceFiles[i].FileID, err)
+		}
+	}
+	return nil
 }
 
 func (s *InvoiceFileService) UpdateInvoiceFile(id uint64, invoiceFile *models.InvoiceFile) error {
-	return s.repo.Update(id, invoiceFile)
+	if err := s.repo.Update(id, invoiceFile); err != nil {
+		return err
+	}
+	updated, err := s.revalidate(s.repo.GetByID(id))
+	if err != nil {
+		return err
+	}
+	invoiceFile.Violations = updated.Violations
+	return nil
 }
 func (s *InvoiceFileService) UpdateInvoiceFileByFileId(fileId string, invoiceFile *models.InvoiceFile) error {
-	return s.repo.UpdateByFileId(fileId, invoiceFile)
+	if err := s.repo.UpdateByFileId(fileId, invoiceFile); err != nil {
+		return err
+	}
+	updated, err := s.revalidate(s.repo.GetByFileID(fileId))
+	if err != nil {
+		return err
+	}
+	invoiceFile.Violations = updated.Violations
+	return nil
 }
 func (s *InvoiceFileService) GetInvoiceFileByID(id uint64) (*models.InvoiceFile, error) {
 	return s.repo.GetByID(id)
@@ -60,3 +101,108 @@ func (s *InvoiceFileService) ListInvoiceFilesByCont(invoiceFile models.InvoiceFi
 func (s *InvoiceFileService) DeleteInvoiceFile(id uint64) error {
 	return s.repo.Delete(id)
 }
+
+// ListPendingReview 待人工审核的票据
+func (s *InvoiceFileService) ListPendingReview(sessionId string, limit, offset int) ([]models.InvoiceFile, error) {
+	return s.repo.ListByCont(models.InvoiceFile{
+		SessionId:    sessionId,
+		ServiceType:  models.ServiceType(3),
+		ReviewStatus: models.ReviewStatusPending,
+	}, limit, offset)
+}
+
+// CorrectInvoiceFile 人工修正票据字段，修正过的字段来源记为人工；
+// zeroFields 为修正为0的金额字段，如免税发票的 tax_amount
+func (s *InvoiceFileService) CorrectInvoiceFile(id uint64, correction *models.InvoiceFile, zeroFields ...string) (*models.InvoiceFile, error) {
+	for _, field := range zeroFields {
+		if field != "amount" && field != "tax_amount" && field != "total_amount" {
+			return nil, fmt.Errorf("只有金额字段可以修正为0: %s", field)
+		}
+	}
+	invoiceFile, err := s.repo.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	invoiceFile.SetFieldSource(models.FieldSourceManual, 1, append(correctedFields(correction), zeroFields...)...)
+	correction.FieldMeta = invoiceFile.FieldMeta
+	// 审核状态只能通过 ApproveInvoiceFile 变更
+	correction.ReviewStatus = ""
+	correction.QRCode = ""
+	if err := s.repo.Update(id, correction); err != nil {
+		return nil, err
+	}
+	if len(zeroFields) > 0 {
+		if err := s.repo.ClearAmounts(id, zeroFields); err != nil {
+			return nil, err
+		}
+	}
+	updated, err := s.revalidate(s.repo.GetByID(id))
+	if err != nil {
+		return nil, err
+	}
+	// 修正后票据标识可能变化，重新检查是否重复报销
+	checked, err := s.CheckDuplicate(updated.FileID)
+	if err != nil {
+		log.Warnf("重复报销检测失败, file_id: %s, err: %v", updated.FileID, err)
+		return updated, nil
+	}
+	return checked, nil
+}
+
+// PairItineraries 重新为报销单中的行程单配对发票，返回配对后的全部票据
+func (s *InvoiceFileService) PairItineraries(sessionId string) ([]models.InvoiceFile, error) {
+	files, err := s.repo.ListByCont(models.InvoiceFile{
+		SessionId:   sessionId,
+		ServiceType: models.ServiceType(3),
+	}, 100, 0)
+	if err != nil {
+		return nil, err
+	}
+	pairs := models.PairItineraries(files)
+	for i := range files {
+		parentID := pairs[files[i].ID]
+		if files[i].ParentID == parentID {
+			continue
+		}
+		if err := s.repo.UpdateParentID(files[i].ID, parentID); err != nil {
+			return nil, fmt.Errorf("关联行程单失败: %w", err)
+		}
+		files[i].ParentID = parentID
+	}
+	return files, nil
+}
+
+// ApproveInvoiceFile 审核通过，票据开始计入报销统计
+func (s *InvoiceFileService) ApproveInvoiceFile(id uint64) (*models.InvoiceFile, error) {
+	if err := s.repo.Update(id, &models.InvoiceFile{ReviewStatus: models.ReviewStatusApproved}); err != nil {
+		return nil, err
+	}
+	return s.repo.GetByID(id)
+}
+
+// correctedFields 修正请求中有值的识别字段，与 repository 的部分更新规则一致
+func correctedFields(f *models.InvoiceFile) []string {
+	fields := make([]string, 0)
+	values := map[string]bool{
+		"invoice_type":     f.InvoiceType != "",
+		"invoice_code":     f.InvoiceCode != "",
+		"issue_date":       f.IssueDate != "",
+		"service_type":     f.ServiceType != 0,
+		"amount":           f.Amount != 0,
+		"tax_amount":       f.TaxAmount != 0,
+		"total_amount":     f.TotalAmount != 0,
+		"buyer_name":       f.BuyerName != "",
+		"buyer_id":         f.BuyerID != "",
+		"seller_name":      f.SellerName != "",
+		"seller_id":        f.SellerID != "",
+		"item_name":        f.ItemName != "",
+		"expense_category": f.ExpenseCategory != "",
+	}
+	for _, field := range models.ReviewFields {
+		if values[field] {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
@@ -0,0 +1,222 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"invoice-agent/internal/app/models"
+	"invoice-agent/pkg/config"
+)
+
+// DefaultAmountTolerance 金额+税额与价税合计默认允许的误差
+const DefaultAmountTolerance = 0.01
+
+// invoiceRule 票据业务规则，invoiceOnly 的规则只校验发票类票据
+type invoiceRule struct {
+	Name        string
+	invoiceOnly bool
+	check       func(f *models.InvoiceFile, conf config.App) []models.RuleViolation
+}
+
+var invoiceRules = []invoiceRule{
+	{Name: "amount_sum", invoiceOnly: true, check: checkAmountSum},
+	{Name: "credit_code", invoiceOnly: true, check: checkCreditCodes},
+	{Name: "invoice_number", invoiceOnly: true, check: checkInvoiceNumber},
+	{Name: "issue_date", check: checkIssueDate},
+	{Name: "buyer_name", invoiceOnly: true, check: checkBuyerName},
+}
+
+// ValidateInvoiceRules 按业务规则校验票据，返回全部不符合的结果，尚未识别的票据不校验
+func ValidateInvoiceRules(f *models.InvoiceFile) models.RuleViolations {
+	conf := config.GetAppConf()
+	violations := make(models.RuleViolations, 0)
+	if f.ServiceType == 0 {
+		return violations
+	}
+	for _, rule := range invoiceRules {
+		if rule.invoiceOnly && f.ServiceType != models.ServiceTypeInvoice {
+			continue
+		}
+		for _, violation := range rule.check(f, conf) {
+			violation.Rule = rule.Name
+			violations = append(violations, violation)
+		}
+	}
+	return violations
+}
+
+// applyInvoiceRules 按业务规则校验已保存的票据并记录结果
+func (s *InvoiceFileService) applyInvoiceRules(invoiceFile *models.InvoiceFile) error {
+	violations := ValidateInvoiceRules(invoiceFile)
+	if err := s.repo.UpdateViolations(invoiceFile.ID, violations); err != nil {
+		return fmt.Errorf("保存票据校验结果失败: %w", err)
+	}
+	invoiceFile.Violations = violations
+	return nil
+}
+
+// revalidate 票据更新后用完整的记录重新校验，校验结果保存失败不影响更新
+func (s *InvoiceFileService) revalidate(invoiceFile *models.InvoiceFile, err error) (*models.InvoiceFile, error) {
+	if err != nil {
+		return nil, err
+	}
+	if err := s.applyInvoiceRules(invoiceFile); err != nil {
+		log.Warnf("票据业务规则校验失败, file_id: %s, err: %v", invoiceFile.FileID, err)
+	}
+	return invoiceFile, nil
+}
+
+func checkAmountSum(f *models.InvoiceFile, conf config.App) []models.RuleViolation {
+	if f.Amount <= 0 || f.TotalAmount <= 0 {
+		return nil
+	}
+	tolerance := conf.AmountTolerance
+	if tolerance <= 0 {
+		tolerance = DefaultAmountTolerance
+	}
+	if diff := f.Amount + f.TaxAmount - f.TotalAmount; math.Abs(diff) > tolerance+1e-9 {
+		return []models.RuleViolation{{
+			Field:    "total_amount",
+			Severity: models.RuleSeverityError,
+			Message:  fmt.Sprintf("金额%.2f+税额%.2f与价税合计%.2f相差%.2f", f.Amount, f.TaxAmount, f.TotalAmount, diff),
+		}}
+	}
+	return nil
+}
+
+func checkCreditCodes(f *models.InvoiceFile, _ config.App) []models.RuleViolation {
+	violations := make([]models.RuleViolation, 0)
+	for _, item := range []struct{ field, label, value string }{
+		{"buyer_id", "购买方识别号", f.BuyerID},
+		{"seller_id", "销售方识别号", f.SellerID},
+	} {
+		code := strings.ToUpper(strings.TrimSpace(item.value))
+		if code == "" {
+			continue
+		}
+		if len(code) != 18 {
+			// 个人或早期的纳税人识别号不是统一社会信用代码
+			violations = append(violations, models.RuleViolation{
+				Field:    item.field,
+				Severity: models.RuleSeverityWarning,
+				Message:  fmt.Sprintf("%s %s 不是18位统一社会信用代码", item.label, item.value),
+			})
+			continue
+		}
+		if !validCreditCode(code) {
+			violations = append(violations, models.RuleViolation{
+				Field:    item.field,
+				Severity: models.RuleSeverityError,
+				Message:  fmt.Sprintf("%s %s 校验位错误", item.label, item.value),
+			})
+		}
+	}
+	return violations
+}
+
+// 统一社会信用代码使用的字符（不含 I、O、Z、S、V）和各位的权重，见 GB 32100-2015
+const creditCodeChars = "0123456789ABCDEFGHJKLMNPQRTUWXY"
+
+var creditCodeWeights = [17]int{1, 3, 9, 27, 19, 26, 16, 17, 20, 29, 25, 13, 8, 24, 10, 30, 28}
+
+// validCreditCode 校验18位统一社会信用代码的字符和校验位
+func validCreditCode(code string) bool {
+	if len(code) != 18 {
+		return false
+	}
+	sum := 0
+	for i := 0; i < 17; i++ {
+		n := strings.IndexByte(creditCodeChars, code[i])
+		if n < 0 {
+			return false
+		}
+		sum += n * creditCodeWeights[i]
+	}
+	check := (31 - sum%31) % 31
+	return code[17] == creditCodeChars[check]
+}
+
+// 发票号码：传统发票8位，全电发票20位
+var invoiceNumberPattern = regexp.MustCompile(`^(\d{8}|\d{20})$`)
+
+func checkInvoiceNumber(f *models.InvoiceFile, _ config.App) []models.RuleViolation {
+	code := strings.TrimSpace(f.InvoiceCode)
+	if code == "" {
+		return []models.RuleViolation{{
+			Field:    "invoice_code",
+			Severity: models.RuleSeverityWarning,
+			Message:  "缺少发票号码",
+		}}
+	}
+	if !invoiceNumberPattern.MatchString(code) {
+		return []models.RuleViolation{{
+			Field:    "invoice_code",
+			Severity: models.RuleSeverityError,
+			Message:  fmt.Sprintf("发票号码 %s 应为8位或20位数字", code),
+		}}
+	}
+	return nil
+}
+
+func checkIssueDate(f *models.InvoiceFile, _ config.App) []models.RuleViolation {
+	if strings.TrimSpace(f.IssueDate) == "" {
+		return []models.RuleViolation{{
+			Field:    "issue_date",
+			Severity: models.RuleSeverityWarning,
+			Message:  "缺少开票日期",
+		}}
+	}
+	date, ok := models.ParseIssueDate(f.IssueDate)
+	if !ok {
+		return []models.RuleViolation{{
+			Field:    "issue_date",
+			Severity: models.RuleSeverityError,
+			Message:  fmt.Sprintf("无法识别的开票日期: %s", f.IssueDate),
+		}}
+	}
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+	if date.After(today) {
+		return []models.RuleViolation{{
+			Field:    "issue_date",
+			Severity: models.RuleSeverityError,
+			Message:  fmt.Sprintf("开票日期 %s 晚于今天", f.IssueDate),
+		}}
+	}
+	return nil
+}
+
+func checkBuyerName(f *models.InvoiceFile, conf config.App) []models.RuleViolation {
+	if len(conf.CompanyNames) == 0 {
+		return nil
+	}
+	buyer := normalizeCompanyName(f.BuyerName)
+	if buyer == "" {
+		return []models.RuleViolation{{
+			Field:    "buyer_name",
+			Severity: models.RuleSeverityWarning,
+			Message:  "缺少购买方名称",
+		}}
+	}
+	for _, name := range conf.CompanyNames {
+		if normalizeCompanyName(name) == buyer {
+			return nil
+		}
+	}
+	return []models.RuleViolation{{
+		Field:    "buyer_name",
+		Severity: models.RuleSeverityError,
+		Message:  fmt.Sprintf("购买方 %s 不是本公司：%s", f.BuyerName, strings.Join(conf.CompanyNames, "、")),
+	}}
+}
+
+// normalizeCompanyName 去掉空白并统一全角括号，识别结果中括号的全角半角经常不一致
+func normalizeCompanyName(name string) string {
+	name = strings.NewReplacer("（", "(", "）", ")").Replace(name)
+	return strings.Join(strings.Fields(name), "")
+}
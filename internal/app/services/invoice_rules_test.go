@@ -0,0 +1,74 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"invoice-agent/internal/app/models"
+	"invoice-agent/pkg/config"
+)
+
+func TestValidCreditCode(t *testing.T) {
+	cases := []struct {
+		code  string
+		valid bool
+	}{
+		{"91350100M000100Y43", true}, // GB 32100-2015 中的示例
+		{"91110108MA01ABCD1E", true},
+		{"91350100M000100Y44", false}, // 校验位错误
+		{"91350100M000100I43", false}, // 含有不使用的字符 I
+		{"91350100M000100Y4", false},  // 不足18位
+	}
+	for _, c := range cases {
+		if got := validCreditCode(c.code); got != c.valid {
+			t.Errorf("validCreditCode(%s) = %v，期望 %v", c.code, got, c.valid)
+		}
+	}
+}
+
+func TestInvoiceRules(t *testing.T) {
+	now := time.Now()
+	today, tomorrow := now.Format("2006年01月02日"), now.AddDate(0, 0, 1).Format("2006年01月02日")
+	conf := config.App{CompanyNames: []string{"天宇正清（重庆）科技有限公司"}}
+
+	cases := []struct {
+		name  string
+		check func(*models.InvoiceFile, config.App) []models.RuleViolation
+		file  models.InvoiceFile
+		want  models.RuleSeverity // 期望的结果，为空表示符合规则
+	}{
+		{"统一社会信用代码正确", checkCreditCodes, models.InvoiceFile{SellerID: "91350100m000100y43"}, ""},
+		{"统一社会信用代码校验位错误", checkCreditCodes, models.InvoiceFile{SellerID: "91350100M000100Y44"}, models.RuleSeverityError},
+		{"15位纳税人识别号", checkCreditCodes, models.InvoiceFile{BuyerID: "110108123456789"}, models.RuleSeverityWarning},
+
+		{"8位发票号码", checkInvoiceNumber, models.InvoiceFile{InvoiceCode: "12345678"}, ""},
+		{"20位发票号码", checkInvoiceNumber, models.InvoiceFile{InvoiceCode: "25312000000087654321"}, ""},
+		{"12位发票号码", checkInvoiceNumber, models.InvoiceFile{InvoiceCode: "011002300111"}, models.RuleSeverityError},
+		{"发票号码含字母", checkInvoiceNumber, models.InvoiceFile{InvoiceCode: "1234567A"}, models.RuleSeverityError},
+		{"缺少发票号码", checkInvoiceNumber, models.InvoiceFile{}, models.RuleSeverityWarning},
+
+		{"今天开票", checkIssueDate, models.InvoiceFile{IssueDate: today}, ""},
+		{"明天开票", checkIssueDate, models.InvoiceFile{IssueDate: tomorrow}, models.RuleSeverityError},
+		{"无法识别的开票日期", checkIssueDate, models.InvoiceFile{IssueDate: "三月一日"}, models.RuleSeverityError},
+
+		{"金额与价税合计一致", checkAmountSum, models.InvoiceFile{Amount: 100, TaxAmount: 6, TotalAmount: 106}, ""},
+		{"相差在允许误差内", checkAmountSum, models.InvoiceFile{Amount: 100, TaxAmount: 6, TotalAmount: 106.01}, ""},
+		{"相差超过允许误差", checkAmountSum, models.InvoiceFile{Amount: 100, TaxAmount: 6, TotalAmount: 106.02}, models.RuleSeverityError},
+
+		{"购买方括号全角半角不同", checkBuyerName, models.InvoiceFile{BuyerName: "天宇正清(重庆)科技有限公司"}, ""},
+		{"购买方名称含空白", checkBuyerName, models.InvoiceFile{BuyerName: " 天宇正清（重庆） 科技有限公司"}, ""},
+		{"购买方不是本公司", checkBuyerName, models.InvoiceFile{BuyerName: "天宇正清科技有限公司"}, models.RuleSeverityError},
+	}
+	for _, c := range cases {
+		violations := c.check(&c.file, conf)
+		if c.want == "" {
+			if len(violations) > 0 {
+				t.Errorf("%s: 不应有校验结果: %+v", c.name, violations)
+			}
+			continue
+		}
+		if len(violations) != 1 || violations[0].Severity != c.want {
+			t.Errorf("%s: 校验结果 %+v，期望一条 %s", c.name, violations, c.want)
+		}
+	}
+}
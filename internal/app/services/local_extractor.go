@@ -0,0 +1,158 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"invoice-agent/internal/app/models"
+	"invoice-agent/internal/app/repositories"
+	"invoice-agent/internal/pkg/ofd"
+	"invoice-agent/internal/pkg/qrcode"
+)
+
+var clauseSeparator = regexp.MustCompile(`[，,。；;\n]+`)
+
+// LocalExtractor 本地规则识别，不调用任何模型服务，可离线运行
+type LocalExtractor struct {
+	repo *repositories.InvoiceFileRepository
+}
+
+func NewLocalExtractor() *LocalExtractor {
+	return &LocalExtractor{repo: repositories.NewInvoiceFileRepository()}
+}
+
+func (p *LocalExtractor) Chat(ctx context.Context, req models.ChatRequest) (*string, error) {
+	content, err := p.chatContent(req, req.Input)
+	if err != nil {
+		return nil, err
+	}
+	return &content, nil
+}
+
+func (p *LocalExtractor) ChatStream(ctx context.Context, req models.ChatRequest) (<-chan string, <-chan error) {
+	content, err := p.chatContent(req, req.History)
+	return streamText(ctx, content, err)
+}
+
+func (p *LocalExtractor) FileParseStream(ctx context.Context, req models.ChatRequest) (<-chan string, <-chan error) {
+	invoiceFiles := make([]models.InvoiceFile, 0, len(req.FileIds))
+	for _, fileId := range req.FileIds {
+		stored, err := p.repo.GetByFileID(fileId)
+		if err != nil {
+			log.Errorf("本地识别获取文件失败, file_id: %s, err: %v", fileId, err)
+			continue
+		}
+		invoiceFiles = append(invoiceFiles, p.extractFile(stored))
+	}
+	data, err := json.Marshal(invoiceFiles)
+	return streamText(ctx, string(data), err)
+}
+
+// extractFile 依次尝试OFD/XML解析和二维码识别，都失败时按文件名推断
+func (p *LocalExtractor) extractFile(stored *models.InvoiceFile) models.InvoiceFile {
+	result := models.InvoiceFile{ServiceType: models.ServiceTypeNonInvoice}
+	if ofd.IsSupported(stored.FilePath) {
+		if parsed, err := ofd.ParseFile(stored.FilePath); err == nil {
+			result = *parsed
+		}
+	} else if qrcode.IsSupported(stored.FilePath) {
+		if qr, err := qrcode.DecodeFile(stored.FilePath); err == nil {
+			qr.Seed(&result)
+			result.ServiceType = models.ServiceTypeInvoice
+		}
+	}
+
+	baseName := filepath.Base(stored.FileName)
+	if result.ExpenseCategory == "" {
+		result.ExpenseCategory = ofd.InferExpenseCategory(result.ItemName, baseName)
+	}
+	if result.ExpenseCategory == "" {
+		result.ExpenseCategory = models.ExpenseCategoryOther
+	}
+	if result.InvoiceType == "" {
+		result.InvoiceType = strings.TrimSuffix(baseName, filepath.Ext(baseName))
+	}
+	result.FileID = stored.FileID
+	result.FileName = stored.FileName
+	return result
+}
+
+// chatContent parse模式输出报销信息JSON，否则输出待确认的markdown表格
+func (p *LocalExtractor) chatContent(req models.ChatRequest, parseInput string) (string, error) {
+	if req.Parse {
+		basic, pay := extractSlots(parseInput)
+		data, err := json.Marshal(map[string]map[string]string{
+			"basic_info": basic,
+			"pay_info":   pay,
+		})
+		return string(data), err
+	}
+
+	basic, pay := extractSlots(req.History + "\n" + req.Input)
+	for key, value := range pay {
+		basic[key] = value
+	}
+	return renderSlotSummary(basic), nil
+}
+
+// extractSlots 按规则从用户描述中提取基础信息和支付信息
+func extractSlots(text string) (map[string]string, map[string]string) {
+	clauses := clauseSeparator.Split(text, -1)
+	return extractByRules(clauses, basicSlotRules()), extractByRules(clauses, paySlotRules())
+}
+
+func extractByRules(clauses []string, rules []slotRule) map[string]string {
+	result := make(map[string]string, len(rules))
+	for _, rule := range rules {
+		result[rule.key] = matchSlot(clauses, rule)
+	}
+	return result
+}
+
+func matchSlot(clauses []string, rule slotRule) string {
+	// 1. 带关键字的子句优先
+	for i := len(clauses) - 1; i >= 0; i-- {
+		clause := clauses[i]
+		for _, kw := range rule.keywords {
+			idx := strings.Index(clause, kw)
+			if idx < 0 {
+				continue
+			}
+			rest := clause[idx+len(kw):]
+			if len(rule.values) == 0 {
+				if value := strings.TrimLeft(strings.TrimSpace(rest), "：:为是 "); value != "" {
+					return value
+				}
+				continue
+			}
+			if value := matchValue(clause, rule.values); value != "" {
+				return value
+			}
+		}
+	}
+	// 2. 可选值不易混淆的字段在全文中查找
+	if rule.anywhere {
+		for i := len(clauses) - 1; i >= 0; i-- {
+			if value := matchValue(clauses[i], rule.values); value != "" {
+				return value
+			}
+		}
+	}
+	return rule.defaultValue
+}
+
+// matchValue 返回文本中出现的可选值，有多个时取最长的，如“智能业务部-IT外包项目”优先于“智能业务部”
+func matchValue(text string, values []string) string {
+	matched := ""
+	for _, value := range values {
+		if len(value) > len(matched) && strings.Contains(text, value) {
+			matched = value
+		}
+	}
+	return matched
+}
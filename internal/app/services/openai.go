@@ -9,25 +9,61 @@ import (
 
 	"github.com/openai/openai-go"
 	"github.com/openai/openai-go/option"
+	log "github.com/sirupsen/logrus"
+
+	"invoice-agent/internal/app/models"
+	"invoice-agent/internal/pkg/llmfixture"
+	"invoice-agent/pkg/config"
 )
 
+// IFileClient 模型服务的文件管理
+type IFileClient interface {
+	UploadFile(ctx context.Context, filePath, purpose string) (string, error)
+	DeleteFile(ctx context.Context, fileID string) error
+}
+
 type OpenAiFileClient struct {
 	client openai.Client
 }
 
-var FileClient *OpenAiFileClient
+var FileClient IFileClient
+
+// NewFileClient 根据配置创建文件客户端，离线模式下文件只保存在本地
+func NewFileClient(conf config.Openai) IFileClient {
+	if IsOfflineProvider(conf.Provider) {
+		return &LocalFileClient{}
+	}
+	return NewOpenAIClient(conf)
+}
 
 // NewOpenAIClient 创建新的OpenAI客户端
-func NewOpenAIClient(apiKey string) *OpenAiFileClient {
-	if FileClient == nil {
-		FileClient = &OpenAiFileClient{
-			client: openai.NewClient(
-				option.WithAPIKey(apiKey),
-				option.WithBaseURL("https://dashscope.aliyuncs.com/compatible-mode/v1"),
-			),
-		}
+func NewOpenAIClient(conf config.Openai) *OpenAiFileClient {
+	baseURL := conf.BaseURL
+	if baseURL == "" {
+		baseURL = DashScopeBaseURL
+	}
+	return &OpenAiFileClient{
+		client: openai.NewClient(clientOptions(conf, baseURL)...),
+	}
+}
+
+// clientOptions 模型服务客户端的公共配置，配置了 fixture_mode 时请求经录制/回放 Transport 发送。
+// 录制/回放配置错误时启动失败，不能退回直接请求模型服务
+func clientOptions(conf config.Openai, baseURL string) []option.RequestOption {
+	opts := []option.RequestOption{
+		option.WithAPIKey(conf.ApiKey),
+		option.WithBaseURL(baseURL),
 	}
-	return FileClient
+	if conf.FixtureMode == llmfixture.ModeOff {
+		return opts
+	}
+	transport, err := llmfixture.New(conf.FixtureMode, conf.FixtureDir)
+	if err != nil {
+		log.Errorf("模型请求录制/回放不可用: %v", err)
+		panic(err)
+	}
+	log.Infof("模型请求录制/回放模式: %s，目录: %s", conf.FixtureMode, conf.FixtureDir)
+	return append(opts, option.WithHTTPClient(transport.Client()))
 }
 
 // UploadFile 上传文件并返回文件ID
@@ -116,3 +152,17 @@ func (c *OpenAiFileClient) WaitForFileProcessing(ctx context.Context, fileID str
 		}
 	}
 }
+
+// LocalFileClient 离线模式的文件客户端，只生成本地文件ID
+type LocalFileClient struct{}
+
+func (c *LocalFileClient) UploadFile(ctx context.Context, filePath, purpose string) (string, error) {
+	if _, err := os.Stat(filePath); err != nil {
+		return "", fmt.Errorf("failed to open file: %w", err)
+	}
+	return models.NewLocalFileID(), nil
+}
+
+func (c *LocalFileClient) DeleteFile(ctx context.Context, fileID string) error {
+	return nil
+}
@@ -0,0 +1,62 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+
+	"github.com/openai/openai-go"
+	log "github.com/sirupsen/logrus"
+
+	"invoice-agent/internal/app/models"
+	"invoice-agent/pkg/config"
+)
+
+// OpenAICompatClient 任意OpenAI兼容接口，文件以 file content part 的方式引用
+type OpenAICompatClient struct {
+	*QwenLongClient
+}
+
+// NewOpenAICompatClient 创建OpenAI兼容接口的客户端。该模式没有默认的服务地址，
+// base_url 未配置或格式错误时启动失败，避免请求发往错误的地址
+func NewOpenAICompatClient(conf config.Openai) *OpenAICompatClient {
+	if err := validateBaseURL(conf.BaseURL); err != nil {
+		log.Errorf("OpenAI兼容接口配置错误: %v", err)
+		panic(err)
+	}
+	return &OpenAICompatClient{
+		QwenLongClient: &QwenLongClient{
+			client:    openai.NewClient(clientOptions(conf, conf.BaseURL)...),
+			model:     conf.Model,
+			toolModel: conf.ToolModel,
+		},
+	}
+}
+
+// validateBaseURL 检查服务地址为 http/https 的完整地址
+func validateBaseURL(baseURL string) error {
+	if baseURL == "" {
+		return fmt.Errorf("provider为%s时必须配置base_url", ProviderOpenAI)
+	}
+	u, err := url.Parse(baseURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("base_url格式错误，应为 http(s)://host/path: %s", baseURL)
+	}
+	return nil
+}
+
+func (p *OpenAICompatClient) FileParseStream(ctx context.Context, req models.ChatRequest) (<-chan string, <-chan error) {
+	parts := make([]openai.ChatCompletionContentPartUnionParam, 0, len(req.FileIds)+1)
+	for _, s := range req.FileIds {
+		parts = append(parts, openai.FileContentPart(openai.ChatCompletionContentPartFileFileParam{
+			FileID: openai.String(s),
+		}))
+	}
+	parts = append(parts, openai.TextContentPart(buildFilePrompt(req)))
+
+	msg := []openai.ChatCompletionMessageParamUnion{
+		openai.SystemMessage("You are a helpful assistant."),
+		openai.UserMessage(parts),
+	}
+	return p.stream(ctx, msg, req.Usage)
+}
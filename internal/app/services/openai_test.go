@@ -0,0 +1,41 @@
+package services
+
+import (
+	"testing"
+
+	"invoice-agent/pkg/config"
+)
+
+// 录制/回放配置错误时不能退回直接请求模型服务
+func TestClientOptionsRejectsInvalidFixtureConfig(t *testing.T) {
+	for _, conf := range []config.Openai{
+		{FixtureMode: "replay"},
+		{FixtureMode: "playback", FixtureDir: t.TempDir()},
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("fixture_mode=%q fixture_dir=%q 应启动失败", conf.FixtureMode, conf.FixtureDir)
+				}
+			}()
+			clientOptions(conf, DashScopeBaseURL)
+		}()
+	}
+}
+
+// OpenAI兼容接口没有默认地址，base_url 配置错误时启动失败
+func TestNewOpenAICompatClientRequiresBaseURL(t *testing.T) {
+	for _, baseURL := range []string{"", "api.example.com/v1", "ftp://api.example.com/v1"} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("base_url=%q 应启动失败", baseURL)
+				}
+			}()
+			NewOpenAICompatClient(config.Openai{Provider: ProviderOpenAI, BaseURL: baseURL})
+		}()
+	}
+	if client := NewOpenAICompatClient(config.Openai{Provider: ProviderOpenAI, BaseURL: "http://localhost:8000/v1"}); client == nil {
+		t.Error("配置正确时应创建客户端")
+	}
+}
@@ -4,7 +4,6 @@ import (
 	"context"
 	"fmt"
 	"github.com/openai/openai-go"
-	"github.com/openai/openai-go/option"
 	log "github.com/sirupsen/logrus"
 	"invoice-agent/internal/app/models"
 	"invoice-agent/pkg/config"
@@ -12,38 +11,28 @@ import (
 )
 
 type QwenLongClient struct {
-	client openai.Client
+	client    openai.Client
+	model     string
+	toolModel string // 工具调用使用的模型
 }
 
-var ChatClient *QwenLongClient
-
-func NewChatClient(apiKey string) *QwenLongClient {
-	if ChatClient == nil {
-		ChatClient = &QwenLongClient{
-			client: openai.NewClient(
-				option.WithAPIKey(apiKey),
-				option.WithBaseURL("https://dashscope.aliyuncs.com/compatible-mode/v1"),
-			),
-		}
+// NewQwenLongClient 创建DashScope qwen-long客户端，文件通过 fileid:// 引用
+func NewQwenLongClient(conf config.Openai) *QwenLongClient {
+	baseURL := conf.BaseURL
+	if baseURL == "" {
+		baseURL = DashScopeBaseURL
+	}
+	return &QwenLongClient{
+		client:    openai.NewClient(clientOptions(conf, baseURL)...),
+		model:     conf.Model,
+		toolModel: conf.ToolModel,
 	}
-	return ChatClient
 }
 
 func (p *QwenLongClient) Chat(ctx context.Context, req models.ChatRequest) (*string, error) {
-	msg := make([]openai.ChatCompletionMessageParamUnion, 0)
-	msg = append(msg, openai.SystemMessage("You are a helpful assistant."))
-
-	if req.Parse {
-		prompt := strings.Replace(config.GetOpenaiConf().ParsePrompt, "{{input_question}}", req.Input, 1)
-		msg = append(msg, openai.UserMessage(prompt))
-	} else {
-		history_prompt := strings.Replace(config.GetOpenaiConf().ChatPrompt, "{{history}}", req.History, 1)
-		prompt := strings.Replace(history_prompt, "{{input_question}}", req.Input, 1)
-		msg = append(msg, openai.UserMessage(prompt))
-	}
 	chatCompletion, err := p.client.Chat.Completions.New(ctx, openai.ChatCompletionNewParams{
-		Messages:    msg,
-		Model:       config.GetOpenaiConf().Model,
+		Messages:    buildChatMessages(req, req.Input),
+		Model:       p.model,
 		Temperature: openai.Float(0),
 	})
 	if err != nil {
@@ -55,6 +44,21 @@ func (p *QwenLongClient) Chat(ctx context.Context, req models.ChatRequest) (*str
 }
 
 func (p *QwenLongClient) ChatStream(ctx context.Context, req models.ChatRequest) (<-chan string, <-chan error) {
+	return p.stream(ctx, buildChatMessages(req, req.History), req.Usage)
+}
+
+func (p *QwenLongClient) FileParseStream(ctx context.Context, req models.ChatRequest) (<-chan string, <-chan error) {
+	msg := make([]openai.ChatCompletionMessageParamUnion, 0)
+	msg = append(msg, openai.SystemMessage("You are a helpful assistant."))
+	for _, s := range req.FileIds {
+		msg = append(msg, openai.SystemMessage("fileid://"+s))
+	}
+	msg = append(msg, openai.UserMessage(buildFilePrompt(req)))
+	return p.stream(ctx, msg, req.Usage)
+}
+
+// stream 发起流式请求，按增量内容写入通道，usage 不为空时在关闭通道前写入token用量
+func (p *QwenLongClient) stream(ctx context.Context, msg []openai.ChatCompletionMessageParamUnion, usage *models.TokenUsage) (<-chan string, <-chan error) {
 	contentChan := make(chan string)
 	errorChan := make(chan error, 1) // 缓冲通道，避免goroutine泄漏
 
@@ -62,26 +66,24 @@ func (p *QwenLongClient) ChatStream(ctx context.Context, req models.ChatRequest)
 		defer close(contentChan)
 		defer close(errorChan)
 
-		msg := make([]openai.ChatCompletionMessageParamUnion, 0)
-		msg = append(msg, openai.SystemMessage("You are a helpful assistant."))
-		if req.Parse {
-			prompt := strings.Replace(config.GetOpenaiConf().ParsePrompt, "{{input_question}}", req.History, 1)
-			msg = append(msg, openai.UserMessage(prompt))
-		} else {
-			history_prompt := strings.Replace(config.GetOpenaiConf().ChatPrompt, "{{history}}", req.History, 1)
-			prompt := strings.Replace(history_prompt, "{{input_question}}", req.Input, 1)
-			msg = append(msg, openai.UserMessage(prompt))
-		}
-
 		// 创建流式请求
-		stream := p.client.Chat.Completions.NewStreaming(ctx, openai.ChatCompletionNewParams{
+		params := openai.ChatCompletionNewParams{
 			Messages: msg,
-			Model:    config.GetOpenaiConf().Model,
-		})
+			Model:    p.model,
+		}
+		if usage != nil {
+			params.StreamOptions = openai.ChatCompletionStreamOptionsParam{IncludeUsage: openai.Bool(true)}
+		}
+		stream := p.client.Chat.Completions.NewStreaming(ctx, params)
 
 		// 处理流式响应
 		for stream.Next() {
 			chunk := stream.Current()
+			if usage != nil && chunk.Usage.TotalTokens > 0 {
+				usage.PromptTokens = chunk.Usage.PromptTokens
+				usage.CompletionTokens = chunk.Usage.CompletionTokens
+				usage.TotalTokens = chunk.Usage.TotalTokens
+			}
 			if len(chunk.Choices) > 0 {
 				content := chunk.Choices[0].Delta.Content
 				if content != "" {
@@ -98,47 +100,43 @@ func (p *QwenLongClient) ChatStream(ctx context.Context, req models.ChatRequest)
 	return contentChan, errorChan
 }
 
-func (p *QwenLongClient) FileParseStream(ctx context.Context, req models.ChatRequest) (<-chan string, <-chan error) {
-	contentChan := make(chan string)
-	errorChan := make(chan error, 1) // 缓冲通道，避免goroutine泄漏
-
-	go func() {
-		defer close(contentChan)
-		defer close(errorChan)
-
-		var fileids string
-		msg := make([]openai.ChatCompletionMessageParamUnion, 0)
-		msg = append(msg, openai.SystemMessage("You are a helpful assistant."))
-		for _, s := range req.FileIds {
-			msg = append(msg, openai.SystemMessage("fileid://"+s))
-			fileids += s + ","
-		}
-		prompt := strings.Replace(config.GetOpenaiConf().FilePrompt, "{{file_ids}}", fileids, 1)
-		prompt = strings.Replace(prompt, "{{input_question}}", req.Input, 1)
-		log.Infoln("---------- prompt: ", prompt)
+// buildChatMessages 组装对话消息，parse模式下 parseInput 作为待解析内容
+func buildChatMessages(req models.ChatRequest, parseInput string) []openai.ChatCompletionMessageParamUnion {
+	msg := make([]openai.ChatCompletionMessageParamUnion, 0)
+	msg = append(msg, openai.SystemMessage("You are a helpful assistant."))
+	if req.Parse {
+		prompt := strings.Replace(config.GetOpenaiConf().ParsePrompt, "{{input_question}}", parseInput, 1)
 		msg = append(msg, openai.UserMessage(prompt))
-
-		// 创建流式请求
-		stream := p.client.Chat.Completions.NewStreaming(ctx, openai.ChatCompletionNewParams{
-			Messages: msg,
-			Model:    config.GetOpenaiConf().Model,
-		})
-
-		// 处理流式响应
-		for stream.Next() {
-			chunk := stream.Current()
-			if len(chunk.Choices) > 0 {
-				content := chunk.Choices[0].Delta.Content
-				if content != "" {
-					contentChan <- content
-				}
+	} else {
+		// 已收集的报销信息放在系统提示中，对话历史按轮次作为用户/助手消息
+		prompt := strings.Replace(config.GetOpenaiConf().ChatPrompt, "{{history}}", req.History, 1)
+		prompt = strings.Replace(prompt, "{{input_question}}", "见用户最新的消息", 1)
+		prompt = strings.Replace(prompt, "{{slot_options}}", SlotOptionsPrompt(), 1)
+		msg = append(msg, openai.SystemMessage(prompt))
+		for _, m := range req.Messages {
+			switch m.Role {
+			case models.ChatRoleUser:
+				msg = append(msg, openai.UserMessage(m.Content))
+			case models.ChatRoleAssistant:
+				msg = append(msg, openai.AssistantMessage(m.Content))
 			}
 		}
+		msg = append(msg, openai.UserMessage(req.Input))
+	}
+	return msg
+}
 
-		if err := stream.Err(); err != nil {
-			errorChan <- err
-		}
-	}()
-
-	return contentChan, errorChan
+// buildFilePrompt 组装票据识别提示词
+func buildFilePrompt(req models.ChatRequest) string {
+	var fileids string
+	for _, s := range req.FileIds {
+		fileids += s + ","
+	}
+	prompt := strings.Replace(config.GetOpenaiConf().FilePrompt, "{{file_ids}}", fileids, 1)
+	prompt = strings.Replace(prompt, "{{input_question}}", req.Input, 1)
+	if req.Feedback != "" {
+		prompt += "\n" + req.Feedback
+	}
+	log.Infoln("---------- prompt: ", prompt)
+	return prompt
 }
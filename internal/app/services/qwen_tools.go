@@ -0,0 +1,69 @@
+package services
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/openai/openai-go"
+
+	"invoice-agent/internal/app/models"
+	"invoice-agent/pkg/config"
+)
+
+// maxToolRounds 一轮对话中模型连续调用工具的最大轮数
+const maxToolRounds = 6
+
+// ChatWithTools 允许模型调用工具的对话，模型不再调用工具时返回最终回复
+func (p *QwenLongClient) ChatWithTools(ctx context.Context, req models.ChatRequest, session *ToolSession, notify func(tool string)) (string, error) {
+	msg := buildChatMessages(req, req.History)
+	if prompt := config.GetOpenaiConf().ToolPrompt; prompt != "" {
+		msg = append([]openai.ChatCompletionMessageParamUnion{openai.SystemMessage(prompt)}, msg...)
+	}
+	tools := make([]openai.ChatCompletionToolParam, 0, len(ChatTools()))
+	for _, tool := range ChatTools() {
+		tools = append(tools, openai.ChatCompletionToolParam{
+			Function: openai.FunctionDefinitionParam{
+				Name:        tool.Name,
+				Description: openai.String(tool.Description),
+				Parameters:  tool.Parameters,
+			},
+		})
+	}
+	model := p.toolModel
+	if model == "" {
+		model = p.model
+	}
+
+	for round := 0; round < maxToolRounds; round++ {
+		completion, err := p.client.Chat.Completions.New(ctx, openai.ChatCompletionNewParams{
+			Messages:    msg,
+			Model:       model,
+			Tools:       tools,
+			Temperature: openai.Float(0),
+		})
+		if err != nil {
+			return "", err
+		}
+		if req.Usage != nil {
+			req.Usage.PromptTokens += completion.Usage.PromptTokens
+			req.Usage.CompletionTokens += completion.Usage.CompletionTokens
+			req.Usage.TotalTokens += completion.Usage.TotalTokens
+		}
+		if len(completion.Choices) == 0 {
+			return "", fmt.Errorf("模型未返回结果")
+		}
+
+		message := completion.Choices[0].Message
+		if len(message.ToolCalls) == 0 {
+			return message.Content, nil
+		}
+		msg = append(msg, message.ToParam())
+		for _, call := range message.ToolCalls {
+			if notify != nil {
+				notify(call.Function.Name)
+			}
+			msg = append(msg, openai.ToolMessage(CallTool(session, call.Function.Name, call.Function.Arguments), call.ID))
+		}
+	}
+	return "", fmt.Errorf("工具调用超过%d轮仍未得到回复", maxToolRounds)
+}
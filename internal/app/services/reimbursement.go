@@ -0,0 +1,230 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+
+	"invoice-agent/internal/app/models"
+	"invoice-agent/internal/app/repositories"
+)
+
+type IReimbursement interface {
+	CreateReimbursement(reimbursement *models.Reimbursement) error
+	GetReimbursement(id uint64) (*models.Reimbursement, error)
+	GetReimbursementBySession(sessionId string) (*models.Reimbursement, error)
+	ListReimbursements(status models.ReimbursementStatus, limit, offset int) ([]models.Reimbursement, error)
+	UpdateReimbursement(id uint64, reimbursement *models.Reimbursement) (*models.Reimbursement, error)
+	DeleteReimbursement(id uint64) error
+	TransitionReimbursement(id uint64, to models.ReimbursementStatus, message string) (*models.Reimbursement, error)
+	Advance(sessionId string, to models.ReimbursementStatus, message string)
+	ConfirmFilling(sessionId string, req *models.AutoFillingRequest) error
+}
+
+type ReimbursementService struct {
+	repo     *repositories.ReimbursementRepository
+	fileRepo *repositories.InvoiceFileRepository
+}
+
+func NewReimbursementService() IReimbursement {
+	return &ReimbursementService{
+		repo:     repositories.NewReimbursementRepository(),
+		fileRepo: repositories.NewInvoiceFileRepository(),
+	}
+}
+
+// CreateReimbursement 创建草稿报销单
+func (s *ReimbursementService) CreateReimbursement(reimbursement *models.Reimbursement) error {
+	if reimbursement.SessionId == "" {
+		reimbursement.SessionId = models.NewReimbursementSessionID()
+	}
+	reimbursement.ID = 0
+	reimbursement.Status = models.ReimbursementStatusDraft
+	reimbursement.Error = ""
+	reimbursement.SubmittedAt = nil
+	return s.repo.Create(reimbursement)
+}
+
+// GetReimbursement 获取报销单及关联票据
+func (s *ReimbursementService) GetReimbursement(id uint64) (*models.Reimbursement, error) {
+	reimbursement, err := s.repo.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+	return s.withInvoiceFiles(reimbursement)
+}
+
+// GetReimbursementBySession 根据报销单据编号获取报销单及关联票据
+func (s *ReimbursementService) GetReimbursementBySession(sessionId string) (*models.Reimbursement, error) {
+	reimbursement, err := s.repo.GetBySessionID(sessionId)
+	if err != nil {
+		return nil, err
+	}
+	return s.withInvoiceFiles(reimbursement)
+}
+
+func (s *ReimbursementService) ListReimbursements(status models.ReimbursementStatus, limit, offset int) ([]models.Reimbursement, error) {
+	return s.repo.List(status, limit, offset)
+}
+
+// UpdateReimbursement 修改报销信息，填报中和已填报的报销单不允许修改
+func (s *ReimbursementService) UpdateReimbursement(id uint64, update *models.Reimbursement) (*models.Reimbursement, error) {
+	reimbursement, err := s.repo.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if !isEditable(reimbursement.Status) {
+		return nil, fmt.Errorf("报销单状态为 %s，不允许修改", reimbursement.Status)
+	}
+
+	if update.Title != "" {
+		reimbursement.Title = update.Title
+	}
+	if update.BasicInfo != (models.BasicItem{}) {
+		reimbursement.BasicInfo = update.BasicInfo
+	}
+	if update.PayInfo != (models.PayItem{}) {
+		reimbursement.PayInfo = update.PayInfo
+	}
+	if update.CostItems != nil {
+		reimbursement.CostItems = update.CostItems
+	}
+	if err := s.repo.SaveInfo(reimbursement); err != nil {
+		return nil, err
+	}
+	return s.withInvoiceFiles(reimbursement)
+}
+
+// DeleteReimbursement 删除报销单，填报中的报销单不允许删除
+func (s *ReimbursementService) DeleteReimbursement(id uint64) error {
+	reimbursement, err := s.repo.GetByID(id)
+	if err != nil {
+		return err
+	}
+	if reimbursement.Status == models.ReimbursementStatusSubmitting {
+		return fmt.Errorf("报销单正在填报中，不允许删除")
+	}
+	return s.repo.Delete(id)
+}
+
+// TransitionReimbursement 按状态机流转报销单，message 为失败原因
+func (s *ReimbursementService) TransitionReimbursement(id uint64, to models.ReimbursementStatus, message string) (*models.Reimbursement, error) {
+	reimbursement, err := s.repo.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.transition(reimbursement, to, message); err != nil {
+		return nil, err
+	}
+	return s.withInvoiceFiles(reimbursement)
+}
+
+// Advance 业务流程中推进报销单状态，报销单不存在时自动创建；
+// 不允许的流转只记录日志，不影响主流程
+func (s *ReimbursementService) Advance(sessionId string, to models.ReimbursementStatus, message string) {
+	if sessionId == "" {
+		return
+	}
+	reimbursement, err := s.getOrCreate(sessionId)
+	if err != nil {
+		log.Errorf("获取报销单失败, session_id: %s, err: %v", sessionId, err)
+		return
+	}
+	if reimbursement.Status == to {
+		return
+	}
+	if err := s.transition(reimbursement, to, message); err != nil {
+		log.Warnf("报销单状态未变更, session_id: %s, err: %v", sessionId, err)
+	}
+}
+
+// ConfirmFilling 记录用户确认的报销信息，并将报销单置为已确认，失败时不能开始填报
+func (s *ReimbursementService) ConfirmFilling(sessionId string, req *models.AutoFillingRequest) error {
+	reimbursement, err := s.getOrCreate(sessionId)
+	if err != nil {
+		return err
+	}
+	if !isEditable(reimbursement.Status) {
+		return fmt.Errorf("报销单状态为 %s，不能重新确认", reimbursement.Status)
+	}
+	reimbursement.ApplyFillingRequest(req)
+	if err := s.repo.SaveInfo(reimbursement); err != nil {
+		return err
+	}
+	// 未识别就直接填报时，按状态机依次流转到已确认
+	path := models.TransitionPath(reimbursement.Status, models.ReimbursementStatusConfirmed)
+	if path == nil {
+		return fmt.Errorf("报销单状态不能从 %s 变更为 %s", reimbursement.Status, models.ReimbursementStatusConfirmed)
+	}
+	for _, status := range path {
+		if err := s.transition(reimbursement, status, ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *ReimbursementService) transition(reimbursement *models.Reimbursement, to models.ReimbursementStatus, message string) error {
+	from := reimbursement.Status
+	if err := reimbursement.Transition(to); err != nil {
+		return err
+	}
+
+	updates := map[string]interface{}{}
+	switch to {
+	case models.ReimbursementStatusFailed:
+		reimbursement.Error = message
+		updates["error"] = message
+	case models.ReimbursementStatusSubmitting:
+		reimbursement.Error = ""
+		updates["error"] = nil
+	case models.ReimbursementStatusSubmitted:
+		now := time.Now()
+		reimbursement.SubmittedAt = &now
+		updates["submitted_at"] = now
+	}
+
+	ok, err := s.repo.UpdateStatus(reimbursement.ID, from, to, updates)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("报销单状态已被修改，请刷新后重试")
+	}
+	return nil
+}
+
+func (s *ReimbursementService) getOrCreate(sessionId string) (*models.Reimbursement, error) {
+	reimbursement, err := s.repo.GetBySessionID(sessionId)
+	if err == nil {
+		return reimbursement, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	reimbursement = &models.Reimbursement{SessionId: sessionId}
+	if err := s.CreateReimbursement(reimbursement); err != nil {
+		return nil, err
+	}
+	return reimbursement, nil
+}
+
+func (s *ReimbursementService) withInvoiceFiles(reimbursement *models.Reimbursement) (*models.Reimbursement, error) {
+	files, err := s.fileRepo.ListByCont(models.InvoiceFile{
+		SessionId:   reimbursement.SessionId,
+		ServiceType: models.ServiceType(3),
+	}, 100, 0)
+	if err != nil {
+		return nil, err
+	}
+	reimbursement.InvoiceFiles = files
+	return reimbursement, nil
+}
+
+// isEditable 报销信息是否还能修改
+func isEditable(status models.ReimbursementStatus) bool {
+	return status != models.ReimbursementStatusSubmitting && status != models.ReimbursementStatusSubmitted
+}
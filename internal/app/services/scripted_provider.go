@@ -0,0 +1,76 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"invoice-agent/internal/app/models"
+)
+
+// 脚本类型，对应 fake_script 配置的key
+const (
+	ScriptChat  = "chat"
+	ScriptParse = "parse"
+	ScriptFile  = "file"
+)
+
+// ScriptedProvider 按脚本依次返回预设内容，用于测试和演示
+type ScriptedProvider struct {
+	mutex  sync.Mutex
+	script map[string][]string
+}
+
+func NewScriptedProvider(script map[string][]string) *ScriptedProvider {
+	p := &ScriptedProvider{script: make(map[string][]string)}
+	for kind, contents := range script {
+		p.Push(kind, contents...)
+	}
+	return p
+}
+
+// Push 追加某类请求的返回内容
+func (p *ScriptedProvider) Push(kind string, contents ...string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.script[kind] = append(p.script[kind], contents...)
+}
+
+// next 取出下一条内容，最后一条会被重复使用
+func (p *ScriptedProvider) next(kind string) (string, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	contents := p.script[kind]
+	if len(contents) == 0 {
+		return "", fmt.Errorf("脚本中没有 %s 类型的回复", kind)
+	}
+	if len(contents) > 1 {
+		p.script[kind] = contents[1:]
+	}
+	return contents[0], nil
+}
+
+func (p *ScriptedProvider) Chat(ctx context.Context, req models.ChatRequest) (*string, error) {
+	content, err := p.next(chatScriptKind(req))
+	if err != nil {
+		return nil, err
+	}
+	return &content, nil
+}
+
+func (p *ScriptedProvider) ChatStream(ctx context.Context, req models.ChatRequest) (<-chan string, <-chan error) {
+	content, err := p.next(chatScriptKind(req))
+	return streamText(ctx, content, err)
+}
+
+func (p *ScriptedProvider) FileParseStream(ctx context.Context, req models.ChatRequest) (<-chan string, <-chan error) {
+	content, err := p.next(ScriptFile)
+	return streamText(ctx, content, err)
+}
+
+func chatScriptKind(req models.ChatRequest) string {
+	if req.Parse {
+		return ScriptParse
+	}
+	return ScriptChat
+}
@@ -0,0 +1,378 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+
+	"invoice-agent/internal/app/models"
+	"invoice-agent/internal/app/repositories"
+	"invoice-agent/pkg/config"
+)
+
+// slotRule 报销单字段的本地识别规则
+type slotRule struct {
+	key          string   // 对应 BasicItem/PayItem 的字段名
+	label        string   // 展示名称
+	keywords     []string // 用户描述中指向该字段的关键字
+	values       []string // 可选值，为空时不限制
+	anywhere     bool     // 可选值在全文任意位置出现即可匹配
+	defaultValue string
+}
+
+// basicSlotRules 基本信息字段，可选值见 slot_filling.yaml
+func basicSlotRules() []slotRule {
+	conf := config.GetSlotFilling()
+	return []slotRule{
+		{key: "Category", label: "报销类型", keywords: []string{"报销类型"}, values: conf.Categories, anywhere: true, defaultValue: conf.DefaultCategory},
+		{key: "Title", label: "主题", keywords: []string{"主题", "标题"}},
+		{key: "UrgentType", label: "紧急程度", keywords: []string{"紧急"}, values: conf.UrgentTypes, anywhere: true, defaultValue: conf.DefaultUrgentType},
+		{key: "Comment", label: "用途/说明", keywords: []string{"用途", "说明"}},
+	}
+}
+
+// paySlotRules 支付信息字段，可选值见 slot_filling.yaml
+func paySlotRules() []slotRule {
+	conf := config.GetSlotFilling()
+	return []slotRule{
+		{key: "BusinessDept", label: "业务发生部门", keywords: []string{"业务发生部门", "业务部门"}, values: conf.BusinessDepts, anywhere: true},
+		{key: "BudgetDept", label: "预算承担部门", keywords: []string{"预算"}, values: conf.BudgetDepts, anywhere: true},
+		{key: "PayDept", label: "付款公司", keywords: []string{"付款"}, values: conf.PayCompanies, anywhere: true},
+		{key: "ProjectType", label: "费用归集项目", keywords: []string{"归集", "项目类型"}, values: conf.ProjectTypes},
+		{key: "Project", label: "费用归集子项", keywords: []string{"子项", "项目名称"}},
+	}
+}
+
+// ErrSlotsIncomplete 报销信息未收集完整，不能开始填报
+var ErrSlotsIncomplete = errors.New("报销信息未填写完整")
+
+type ISlotFilling interface {
+	Update(sessionId, input string) (*models.SlotState, models.MissingSlotsEvent, error)
+	SetSlots(sessionId string, values map[string]string) (*models.SlotState, models.MissingSlotsEvent, error)
+	GetState(sessionId string) (*models.SlotState, models.MissingSlotsEvent, error)
+	FillingRequest(sessionId string) (*models.AutoFillingRequest, models.MissingSlotsEvent, error)
+	Reset(sessionId string) error
+}
+
+// SlotFillingService 在服务端维护每个报销单的报销信息，多轮对话逐步补全
+type SlotFillingService struct {
+	repo *repositories.SlotStateRepository
+}
+
+func NewSlotFillingService() ISlotFilling {
+	return &SlotFillingService{repo: repositories.NewSlotStateRepository()}
+}
+
+// Update 从本轮输入中识别提到的字段并更新，未提到的字段保持不变
+func (s *SlotFillingService) Update(sessionId, input string) (*models.SlotState, models.MissingSlotsEvent, error) {
+	state, err := s.getOrCreate(sessionId)
+	if err != nil {
+		return nil, models.MissingSlotsEvent{}, err
+	}
+
+	updates, invalid := mentionedSlots(input, state)
+	updated := make([]string, 0, len(updates))
+	for _, rule := range slotRules() {
+		if value, ok := updates[rule.key]; ok {
+			state.Set(rule.key, value)
+			updated = append(updated, rule.key)
+		}
+	}
+	state.Turns++
+	if err := s.repo.Save(state); err != nil {
+		return nil, models.MissingSlotsEvent{}, err
+	}
+
+	event := evaluateSlots(state)
+	event.Updated = updated
+	event.Invalid = append(invalid, event.Invalid...)
+	event.Complete = event.Complete && len(invalid) == 0
+	return state, event, nil
+}
+
+// SetSlots 直接设置字段，可选值以外的值整体拒绝
+func (s *SlotFillingService) SetSlots(sessionId string, values map[string]string) (*models.SlotState, models.MissingSlotsEvent, error) {
+	state, err := s.getOrCreate(sessionId)
+	if err != nil {
+		return nil, models.MissingSlotsEvent{}, err
+	}
+
+	updated := make([]string, 0, len(values))
+	for key, value := range values {
+		rule, ok := findSlotRule(key)
+		if !ok {
+			return nil, models.MissingSlotsEvent{}, fmt.Errorf("未知的报销信息字段: %s", key)
+		}
+		value = strings.TrimSpace(value)
+		if value != "" && len(rule.values) > 0 && !containsValue(rule.values, value) {
+			return nil, models.MissingSlotsEvent{}, fmt.Errorf("%s只能是：%s", rule.label, strings.Join(rule.values, "、"))
+		}
+		state.Set(key, value)
+		updated = append(updated, key)
+	}
+	if err := s.repo.Save(state); err != nil {
+		return nil, models.MissingSlotsEvent{}, err
+	}
+
+	event := evaluateSlots(state)
+	event.Updated = updated
+	return state, event, nil
+}
+
+// GetState 获取报销单当前的报销信息和缺少的字段
+func (s *SlotFillingService) GetState(sessionId string) (*models.SlotState, models.MissingSlotsEvent, error) {
+	state, err := s.getOrCreate(sessionId)
+	if err != nil {
+		return nil, models.MissingSlotsEvent{}, err
+	}
+	return state, evaluateSlots(state), nil
+}
+
+// FillingRequest 由收集完整的报销信息生成填报请求，票据和费用明细由调用方补充
+func (s *SlotFillingService) FillingRequest(sessionId string) (*models.AutoFillingRequest, models.MissingSlotsEvent, error) {
+	state, event, err := s.GetState(sessionId)
+	if err != nil {
+		return nil, event, err
+	}
+	if !event.Complete {
+		return nil, event, ErrSlotsIncomplete
+	}
+	return &models.AutoFillingRequest{
+		SessionId: sessionId,
+		BasicInfo: state.BasicInfo,
+		PayInfo:   state.PayInfo,
+	}, event, nil
+}
+
+// Reset 清空报销单已收集的报销信息
+func (s *SlotFillingService) Reset(sessionId string) error {
+	return s.repo.DeleteBySessionID(sessionId)
+}
+
+// getOrCreate 获取报销信息收集状态，首次对话时按默认值初始化
+func (s *SlotFillingService) getOrCreate(sessionId string) (*models.SlotState, error) {
+	if sessionId == "" {
+		return nil, fmt.Errorf("session_id不能为空")
+	}
+	state, err := s.repo.GetBySessionID(sessionId)
+	if err == nil {
+		return state, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	state = &models.SlotState{SessionId: sessionId}
+	for _, rule := range slotRules() {
+		if rule.defaultValue != "" {
+			state.Set(rule.key, rule.defaultValue)
+		}
+	}
+	return state, nil
+}
+
+// RenderSlotState 按收集状态输出待确认的报销信息表格
+func RenderSlotState(state *models.SlotState) string {
+	values := make(map[string]string)
+	for _, rule := range slotRules() {
+		values[rule.key] = state.Get(rule.key)
+	}
+	return renderSlotSummary(values)
+}
+
+// renderSlotSummary 输出基本信息和支付信息表格，并提示补充缺少的字段
+func renderSlotSummary(values map[string]string) string {
+	var b strings.Builder
+	b.WriteString("# 感谢您提供的报销信息，报销信息确认\n---\n")
+	missing := writeSlotTable(&b, "## 📋 基本信息", basicSlotRules(), values)
+	b.WriteString("---\n")
+	missing += writeSlotTable(&b, "## 💳 支付信息", paySlotRules(), values)
+	b.WriteString("---\n")
+	if missing == 0 {
+		b.WriteString("✅ **以上信息已根据您的补充内容完成填写。如无其他修改，我们将按此信息继续处理您的报销申请。**\n")
+		b.WriteString("** 预报销请输入：“报销”。**\n")
+	} else {
+		b.WriteString("✅ **以上信息是否完整，请您根据提示补充相关内容，以便我们及时处理您的报销申请。**\n")
+	}
+	return b.String()
+}
+
+// writeSlotTable 输出一组字段的表格，返回缺少的字段数
+func writeSlotTable(b *strings.Builder, title string, rules []slotRule, values map[string]string) int {
+	missing := 0
+	b.WriteString(title + "\n| 项目 | 内容 |\n|------|------|\n")
+	for _, rule := range rules {
+		value := values[rule.key]
+		if value == "" {
+			missing++
+			if len(rule.values) > 0 {
+				value = "⚠️ 请选择：" + strings.Join(rule.values, "、")
+			} else {
+				value = "⚠️ 请填写" + rule.label
+			}
+		}
+		b.WriteString(fmt.Sprintf("| **%s** | %s |\n", rule.label, value))
+	}
+	return missing
+}
+
+// evaluateSlots 列出缺少的字段和不在可选值内的字段
+func evaluateSlots(state *models.SlotState) models.MissingSlotsEvent {
+	event := models.MissingSlotsEvent{
+		Missing: make([]models.SlotItem, 0),
+		Invalid: make([]models.SlotItem, 0),
+	}
+	for _, rule := range slotRules() {
+		value := state.Get(rule.key)
+		switch {
+		case value == "":
+			event.Missing = append(event.Missing, rule.item(""))
+		case len(rule.values) > 0 && !containsValue(rule.values, value):
+			event.Invalid = append(event.Invalid, rule.item(value))
+		}
+	}
+	event.Complete = len(event.Missing) == 0 && len(event.Invalid) == 0
+	return event
+}
+
+// mentionedSlots 识别本轮输入提到的字段。带关键字但值不在可选值内的记为不合法；
+// 可选值在任意位置出现即可匹配的字段只补充尚未填写的，避免覆盖已确认的值
+func mentionedSlots(input string, state *models.SlotState) (map[string]string, []models.SlotItem) {
+	clauses := clauseSeparator.Split(input, -1)
+	updates := make(map[string]string)
+	invalid := make([]models.SlotItem, 0)
+	for _, rule := range slotRules() {
+		value, raw := mentionSlot(clauses, rule, state.Get(rule.key) == "")
+		switch {
+		case value != "":
+			updates[rule.key] = value
+		case raw != "":
+			invalid = append(invalid, rule.item(raw))
+		}
+	}
+	if len(updates) == 0 && len(invalid) == 0 {
+		if key, value, ok := answerOption(strings.TrimSpace(input), state); ok {
+			updates[key] = value
+		}
+	}
+	return updates, invalid
+}
+
+// mentionSlot 返回子句中该字段的值；带关键字但无法识别为可选值时返回原始内容
+func mentionSlot(clauses []string, rule slotRule, empty bool) (string, string) {
+	for i := len(clauses) - 1; i >= 0; i-- {
+		clause := clauses[i]
+		for _, kw := range rule.keywords {
+			idx := strings.Index(clause, kw)
+			if idx < 0 {
+				continue
+			}
+			rest := trimKeywords(clause[idx+len(kw):], rule.keywords)
+			if len(rule.values) == 0 {
+				if rest != "" {
+					return rest, ""
+				}
+				continue
+			}
+			// 关键字后没有内容时可选值在关键字前，如“非常紧急”
+			if rest == "" {
+				if value := matchValue(clause, rule.values); value != "" {
+					return value, ""
+				}
+				continue
+			}
+			if value := matchValue(rest, rule.values); value != "" {
+				return value, ""
+			}
+			return "", rest
+		}
+	}
+	if rule.anywhere && empty {
+		for i := len(clauses) - 1; i >= 0; i-- {
+			if value := matchValue(clauses[i], rule.values); value != "" {
+				return value, ""
+			}
+		}
+	}
+	return "", ""
+}
+
+// trimKeywords 去掉关键字后的分隔符和同一字段的其他关键字，如“用途/说明：出差北京”只保留“出差北京”
+func trimKeywords(rest string, keywords []string) string {
+	for {
+		rest = strings.TrimLeft(strings.TrimSpace(rest), "：:/、为是 ")
+		trimmed := rest
+		for _, kw := range keywords {
+			trimmed = strings.TrimPrefix(trimmed, kw)
+		}
+		if trimmed == rest {
+			return rest
+		}
+		rest = trimmed
+	}
+}
+
+// answerOption 用户只回复了一个可选值时，填入唯一可接受该值的缺少字段
+func answerOption(input string, state *models.SlotState) (string, string, bool) {
+	key := ""
+	for _, rule := range slotRules() {
+		if state.Get(rule.key) != "" || !containsValue(rule.values, input) {
+			continue
+		}
+		if key != "" {
+			return "", "", false
+		}
+		key = rule.key
+	}
+	return key, input, key != ""
+}
+
+func slotRules() []slotRule {
+	return append(basicSlotRules(), paySlotRules()...)
+}
+
+// SlotOptionsPrompt 按配置的可选值输出需要提取的报销信息，替换 chat_prompt 中的 {{slot_options}}
+func SlotOptionsPrompt() string {
+	var b strings.Builder
+	b.WriteString("基本信息：\n")
+	writeSlotOptions(&b, basicSlotRules())
+	b.WriteString("支付信息：\n")
+	writeSlotOptions(&b, paySlotRules())
+	return b.String()
+}
+
+func writeSlotOptions(b *strings.Builder, rules []slotRule) {
+	for i, rule := range rules {
+		b.WriteString(fmt.Sprintf("%d. %s", i+1, rule.label))
+		if len(rule.values) > 0 {
+			b.WriteString("：只能是 " + strings.Join(rule.values, "、"))
+		}
+		if rule.defaultValue != "" {
+			b.WriteString("，默认为" + rule.defaultValue)
+		}
+		b.WriteString("\n")
+	}
+}
+
+func findSlotRule(key string) (slotRule, bool) {
+	for _, rule := range slotRules() {
+		if rule.key == key {
+			return rule, true
+		}
+	}
+	return slotRule{}, false
+}
+
+func (r slotRule) item(value string) models.SlotItem {
+	return models.SlotItem{Key: r.key, Label: r.label, Value: value, Options: r.values}
+}
+
+func containsValue(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,58 @@
+package services
+
+import (
+	"strings"
+	"testing"
+
+	"invoice-agent/internal/app/models"
+	"invoice-agent/pkg/config"
+)
+
+func TestMentionedSlotsUsesConfiguredOptions(t *testing.T) {
+	loadDevConfig(t)
+
+	updates, invalid := mentionedSlots("业务部门智能业务部-IT外包项目，付款公司天宇正清(重庆)科技有限公司，非常紧急", &models.SlotState{})
+	if len(invalid) > 0 {
+		t.Errorf("不应有不合法的字段: %+v", invalid)
+	}
+	want := map[string]string{
+		"BusinessDept": "智能业务部-IT外包项目",
+		"PayDept":      "天宇正清(重庆)科技有限公司",
+		"UrgentType":   "非常紧急",
+	}
+	for key, value := range want {
+		if updates[key] != value {
+			t.Errorf("%s 识别为 %q，期望 %q", key, updates[key], value)
+		}
+	}
+
+	_, invalid = mentionedSlots("付款公司是某某有限公司", &models.SlotState{})
+	if len(invalid) != 1 || invalid[0].Key != "PayDept" || len(invalid[0].Options) != len(config.GetSlotFilling().PayCompanies) {
+		t.Errorf("不在配置内的付款公司应记为不合法: %+v", invalid)
+	}
+}
+
+func TestSlotOptionsPrompt(t *testing.T) {
+	loadDevConfig(t)
+
+	prompt := SlotOptionsPrompt()
+	for _, company := range config.GetSlotFilling().PayCompanies {
+		if !strings.Contains(prompt, company) {
+			t.Errorf("提示词缺少付款公司 %s:\n%s", company, prompt)
+		}
+	}
+	if !strings.Contains(prompt, "紧急程度：只能是 非常紧急、紧急、一般，默认为一般") {
+		t.Errorf("提示词缺少紧急程度的可选值和默认值:\n%s", prompt)
+	}
+}
+
+func TestMentionedSlotsTrimsOtherKeywords(t *testing.T) {
+	loadDevConfig(t)
+
+	for _, input := range []string{"用途说明：出差北京", "用途/说明：出差北京", "说明：出差北京"} {
+		updates, _ := mentionedSlots(input, &models.SlotState{})
+		if updates["Comment"] != "出差北京" {
+			t.Errorf("%s 的用途/说明识别为 %q，期望 %q", input, updates["Comment"], "出差北京")
+		}
+	}
+}
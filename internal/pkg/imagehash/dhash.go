@@ -0,0 +1,118 @@
+// Package imagehash 计算图片的感知哈希，同一张票据重新拍照或扫描后哈希仍然相近，用于发现重复报销
+package imagehash
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// DefaultThreshold 汉明距离不超过该值时认为是同一张图片
+const DefaultThreshold = 6
+
+// ErrUnsupported 不支持计算哈希的文件类型
+var ErrUnsupported = errors.New("不支持的图片类型")
+
+// IsSupported 是否为可计算感知哈希的图片
+func IsSupported(fileName string) bool {
+	switch strings.ToLower(filepath.Ext(fileName)) {
+	case ".png", ".jpg", ".jpeg", ".gif":
+		return true
+	default:
+		return false
+	}
+}
+
+// HashFile 计算图片文件的差值哈希，返回16位十六进制字符串
+func HashFile(filePath string) (string, error) {
+	if !IsSupported(filePath) {
+		return "", ErrUnsupported
+	}
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", fmt.Errorf("打开文件失败: %w", err)
+	}
+	defer file.Close()
+
+	img, _, err := image.Decode(file)
+	if err != nil {
+		return "", fmt.Errorf("解码图片失败: %w", err)
+	}
+	return fmt.Sprintf("%016x", DHash(img)), nil
+}
+
+// DHash 差值哈希：缩小为 9x8 的灰度图，比较每行相邻像素的亮度
+func DHash(img image.Image) uint64 {
+	const width, height = 9, 8
+	var gray [height][width]float64
+	bounds := img.Bounds()
+	for y := 0; y < height; y++ {
+		y0 := bounds.Min.Y + y*bounds.Dy()/height
+		y1 := bounds.Min.Y + (y+1)*bounds.Dy()/height
+		for x := 0; x < width; x++ {
+			x0 := bounds.Min.X + x*bounds.Dx()/width
+			x1 := bounds.Min.X + (x+1)*bounds.Dx()/width
+			gray[y][x] = averageLuma(img, x0, y0, x1, y1)
+		}
+	}
+
+	var hash uint64
+	for y := 0; y < height; y++ {
+		for x := 0; x < width-1; x++ {
+			hash <<= 1
+			if gray[y][x] > gray[y][x+1] {
+				hash |= 1
+			}
+		}
+	}
+	return hash
+}
+
+// averageLuma 区域内像素的平均亮度，区域较大时按步长采样
+func averageLuma(img image.Image, x0, y0, x1, y1 int) float64 {
+	if x1 <= x0 {
+		x1 = x0 + 1
+	}
+	if y1 <= y0 {
+		y1 = y0 + 1
+	}
+	stepX := (x1-x0)/16 + 1
+	stepY := (y1-y0)/16 + 1
+	var sum float64
+	var n int
+	for y := y0; y < y1; y += stepY {
+		for x := x0; x < x1; x += stepX {
+			r, g, b, _ := img.At(x, y).RGBA()
+			sum += 0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b)
+			n++
+		}
+	}
+	return sum / float64(n)
+}
+
+// Distance 两个哈希的汉明距离，哈希格式错误时返回 -1
+func Distance(a, b string) int {
+	x, err := strconv.ParseUint(a, 16, 64)
+	if err != nil {
+		return -1
+	}
+	y, err := strconv.ParseUint(b, 16, 64)
+	if err != nil {
+		return -1
+	}
+	return bits.OnesCount64(x ^ y)
+}
+
+// Similar 两个哈希是否相近
+func Similar(a, b string, threshold int) bool {
+	d := Distance(a, b)
+	return d >= 0 && d <= threshold
+}
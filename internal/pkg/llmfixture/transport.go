@@ -0,0 +1,256 @@
+// Package llmfixture 录制和回放模型服务的HTTP请求，流式响应按SSE事件逐条保存，
+// 用于在无网络的环境下确定性地测试对话与票据识别流程
+package llmfixture
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// 录制/回放模式
+const (
+	ModeOff    = ""       // 直接请求模型服务
+	ModeRecord = "record" // 请求模型服务并保存响应，已有的录制会被覆盖
+	ModeReplay = "replay" // 只从录制文件返回响应，缺少录制时报错
+	ModeAuto   = "auto"   // 有录制时回放，否则请求并录制
+)
+
+// ErrFixtureNotFound 回放模式下没有对应请求的录制
+var ErrFixtureNotFound = errors.New("没有对应请求的录制")
+
+// Fixture 一次请求及其响应的录制内容
+type Fixture struct {
+	Method  string              `json:"method"`
+	Path    string              `json:"path"`
+	Request json.RawMessage     `json:"request,omitempty"` // JSON请求体，便于阅读和排查
+	Status  int                 `json:"status"`
+	Header  map[string][]string `json:"header"`
+	Body    string              `json:"body,omitempty"`
+	Events  []string            `json:"events,omitempty"` // text/event-stream 响应的各个事件
+}
+
+// Transport 录制/回放模型服务请求的 http.RoundTripper
+type Transport struct {
+	Mode string
+	Dir  string
+	Next http.RoundTripper // 实际发送请求的 Transport，为空时使用 http.DefaultTransport
+
+	mutex sync.Mutex
+}
+
+// New 创建录制/回放 Transport
+func New(mode, dir string) (*Transport, error) {
+	switch mode {
+	case ModeRecord, ModeReplay, ModeAuto:
+	default:
+		return nil, fmt.Errorf("未知的录制模式: %s", mode)
+	}
+	if dir == "" {
+		return nil, fmt.Errorf("未配置录制文件目录")
+	}
+	return &Transport{Mode: mode, Dir: dir}, nil
+}
+
+// Client 使用该 Transport 的 http.Client
+func (t *Transport) Client() *http.Client {
+	return &http.Client{Transport: t}
+}
+
+// RoundTrip 按模式回放录制或请求模型服务
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := readRequestBody(req)
+	if err != nil {
+		return nil, err
+	}
+	key := Key(req.Method, req.URL.Path, req.Header.Get("Content-Type"), body)
+	path := filepath.Join(t.Dir, fixtureName(req.URL.Path, key))
+
+	if t.Mode == ModeReplay || t.Mode == ModeAuto {
+		fixture, err := Load(path)
+		if err == nil {
+			return fixture.Response(req), nil
+		}
+		if t.Mode == ModeReplay || !errors.Is(err, ErrFixtureNotFound) {
+			return nil, fmt.Errorf("%s %s: %w", req.Method, req.URL.Path, err)
+		}
+	}
+
+	resp, err := t.next().RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	fixture, err := record(req, body, resp)
+	if err != nil {
+		return nil, err
+	}
+	if err := t.save(path, fixture); err != nil {
+		return nil, err
+	}
+	return fixture.Response(req), nil
+}
+
+func (t *Transport) next() http.RoundTripper {
+	if t.Next != nil {
+		return t.Next
+	}
+	return http.DefaultTransport
+}
+
+func (t *Transport) save(path string, fixture *Fixture) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if err := os.MkdirAll(t.Dir, 0755); err != nil {
+		return fmt.Errorf("创建录制文件目录失败: %w", err)
+	}
+	data, err := json.MarshalIndent(fixture, "", "  ")
+	if err != nil {
+		return fmt.Errorf("序列化录制内容失败: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("保存录制文件失败: %w", err)
+	}
+	return nil
+}
+
+// Load 读取录制文件
+func Load(path string) (*Fixture, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrFixtureNotFound, filepath.Base(path))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取录制文件失败: %w", err)
+	}
+	var fixture Fixture
+	if err := json.Unmarshal(data, &fixture); err != nil {
+		return nil, fmt.Errorf("解析录制文件 %s 失败: %w", filepath.Base(path), err)
+	}
+	return &fixture, nil
+}
+
+// Response 由录制内容构造响应，流式响应按原样还原为SSE事件
+func (f *Fixture) Response(req *http.Request) *http.Response {
+	body := f.Body
+	if len(f.Events) > 0 {
+		body = strings.Join(f.Events, "\n\n") + "\n\n"
+	}
+	header := http.Header{}
+	for k, v := range f.Header {
+		header[k] = v
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", f.Status, http.StatusText(f.Status)),
+		StatusCode:    f.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(strings.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
+
+// record 读取完整响应并转换为录制内容
+func record(req *http.Request, body []byte, resp *http.Response) (*Fixture, error) {
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("读取模型服务响应失败: %w", err)
+	}
+
+	fixture := &Fixture{
+		Method: req.Method,
+		Path:   req.URL.Path,
+		Status: resp.StatusCode,
+		Header: map[string][]string{},
+	}
+	if json.Valid(body) {
+		fixture.Request = body
+	}
+	for k, v := range resp.Header {
+		// 回放时由 Response 重新计算长度，Cookie 等会话信息不保存
+		switch http.CanonicalHeaderKey(k) {
+		case "Content-Length", "Set-Cookie", "Date":
+			continue
+		}
+		fixture.Header[k] = v
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType == "text/event-stream" {
+		text := strings.ReplaceAll(string(data), "\r\n", "\n")
+		for _, event := range strings.Split(text, "\n\n") {
+			if strings.TrimSpace(event) != "" {
+				fixture.Events = append(fixture.Events, event)
+			}
+		}
+	} else {
+		fixture.Body = string(data)
+	}
+	return fixture, nil
+}
+
+// readRequestBody 读取请求体并重置，以便继续发送请求
+func readRequestBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("读取请求体失败: %w", err)
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(body)), nil
+	}
+	return body, nil
+}
+
+// Key 请求的录制键：方法、路径和规范化后的请求体的摘要。
+// JSON请求体按键名重新排序，multipart 请求体去掉随机的分隔符
+func Key(method, path, contentType string, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(method + " " + path + "\n"))
+	h.Write(normalizeBody(contentType, body))
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+func normalizeBody(contentType string, body []byte) []byte {
+	mediaType, params, _ := mime.ParseMediaType(contentType)
+	if strings.HasPrefix(mediaType, "multipart/") && params["boundary"] != "" {
+		return bytes.ReplaceAll(body, []byte(params["boundary"]), []byte("boundary"))
+	}
+	var v interface{}
+	if json.Unmarshal(body, &v) == nil {
+		if normalized, err := json.Marshal(v); err == nil {
+			return normalized
+		}
+	}
+	return body
+}
+
+// fixtureName 录制文件名，由接口路径和录制键组成，如 chat-completions-3f2a....json
+func fixtureName(path, key string) string {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	if len(parts) > 2 {
+		parts = parts[len(parts)-2:]
+	}
+	name := strings.Join(parts, "-")
+	if name == "" {
+		name = "root"
+	}
+	return name + "-" + key + ".json"
+}
@@ -0,0 +1,195 @@
+// Package mockoa 本地模拟的OA报销系统，页面结构与自动填报脚本定位的元素一致，
+// 用于在离线环境下端到端验证 AutoFillingService 的填报结果
+package mockoa
+
+import (
+	_ "embed"
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+//go:embed static/index.html
+var indexHTML string
+
+var indexTemplate = template.Must(template.New("index").Parse(indexHTML))
+
+// Options 模拟OA的登录账号和各下拉框的选项
+type Options struct {
+	Username string // 为空时任意账号密码都能登录
+	Password string
+
+	Categories     []string `json:"categories"`      // 报销类型
+	UrgentTypes    []string `json:"urgent_types"`    // 紧急类型
+	Depts          []string `json:"depts"`           // 业务发生部门、预算承担部门
+	ProjectTypes   []string `json:"project_types"`   // 项目类型
+	Projects       []string `json:"projects"`        // 项目/成本中心
+	Companies      []string `json:"companies"`       // 付款公司
+	CostCategories []string `json:"cost_categories"` // 明细费用类别
+	CostNames      []string `json:"cost_names"`      // 明细费用名称
+}
+
+// DefaultOptions 默认账号和下拉选项
+func DefaultOptions() Options {
+	return Options{
+		Username:       "mock-user",
+		Password:       "mock-password",
+		Categories:     []string{"差旅费报销", "日常费用报销", "业务招待费报销"},
+		UrgentTypes:    []string{"一般", "紧急"},
+		Depts:          []string{"技术研发部", "市场部", "财务部", "综合管理部"},
+		ProjectTypes:   []string{"研发项目", "管理项目", "市场项目"},
+		Projects:       []string{"发票智能体", "OA系统升级", "日常运营"},
+		Companies:      []string{"天宇正清科技有限公司"},
+		CostCategories: []string{"交通费", "住宿费", "餐费", "办公费"},
+		CostNames:      []string{"市内交通费", "出租车费", "飞机票", "火车票", "酒店住宿费", "业务餐费", "办公用品"},
+	}
+}
+
+// Server 模拟OA服务，记录登录、上传和保存的报销单
+type Server struct {
+	URL string
+
+	options     Options
+	httpServer  *httptest.Server
+	mutex       sync.Mutex
+	logins      []string
+	uploads     []string
+	submissions []Submission
+}
+
+// NewServer 启动模拟OA服务，使用完毕后调用 Close
+func NewServer(options Options) *Server {
+	s := &Server{options: options}
+	s.httpServer = httptest.NewServer(s.Handler())
+	s.URL = s.httpServer.URL + "/"
+	log.Infof("模拟OA已启动: %s", s.URL)
+	return s
+}
+
+// Close 停止服务
+func (s *Server) Close() {
+	s.httpServer.Close()
+}
+
+// Handler 模拟OA的路由，可挂载到其他 http.Server 上
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", s.index)
+	mux.HandleFunc("/api/login", s.login)
+	mux.HandleFunc("/api/upload", s.upload)
+	mux.HandleFunc("/api/reimbursement", s.saveReimbursement)
+	return mux
+}
+
+// Logins 成功登录的账号
+func (s *Server) Logins() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]string(nil), s.logins...)
+}
+
+// Uploads 上传的文件名
+func (s *Server) Uploads() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]string(nil), s.uploads...)
+}
+
+// Submissions 保存的报销单，按保存顺序
+func (s *Server) Submissions() []Submission {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]Submission(nil), s.submissions...)
+}
+
+// LastSubmission 最近保存的报销单
+func (s *Server) LastSubmission() (Submission, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if len(s.submissions) == 0 {
+		return Submission{}, false
+	}
+	return s.submissions[len(s.submissions)-1], true
+}
+
+// Reset 清空记录
+func (s *Server) Reset() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.logins, s.uploads, s.submissions = nil, nil, nil
+}
+
+func (s *Server) index(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := indexTemplate.Execute(w, s.options); err != nil {
+		log.Errorf("模拟OA页面渲染失败: %v", err)
+	}
+}
+
+func (s *Server) login(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}
+	if r.Method != http.MethodPost || json.NewDecoder(r.Body).Decode(&req) != nil {
+		http.Error(w, "参数错误", http.StatusBadRequest)
+		return
+	}
+	if s.options.Username != "" && (req.Username != s.options.Username || req.Password != s.options.Password) {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"message": "账号或密码错误"})
+		return
+	}
+
+	s.mutex.Lock()
+	s.logins = append(s.logins, req.Username)
+	s.mutex.Unlock()
+	writeJSON(w, http.StatusOK, map[string]string{"message": "登录成功"})
+}
+
+func (s *Server) upload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "参数错误", http.StatusBadRequest)
+		return
+	}
+	_, header, err := r.FormFile("file")
+	if err != nil {
+		http.Error(w, "缺少文件", http.StatusBadRequest)
+		return
+	}
+
+	name := filepath.Base(header.Filename)
+	s.mutex.Lock()
+	s.uploads = append(s.uploads, name)
+	s.mutex.Unlock()
+	writeJSON(w, http.StatusOK, map[string]string{"name": name})
+}
+
+func (s *Server) saveReimbursement(w http.ResponseWriter, r *http.Request) {
+	var submission Submission
+	if r.Method != http.MethodPost || json.NewDecoder(r.Body).Decode(&submission) != nil {
+		http.Error(w, "参数错误", http.StatusBadRequest)
+		return
+	}
+	submission.SubmittedAt = time.Now()
+
+	s.mutex.Lock()
+	s.submissions = append(s.submissions, submission)
+	s.mutex.Unlock()
+	writeJSON(w, http.StatusOK, map[string]string{"message": "保存成功"})
+}
+
+func writeJSON(w http.ResponseWriter, code int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(data)
+}
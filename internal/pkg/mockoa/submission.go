@@ -0,0 +1,71 @@
+package mockoa
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"invoice-agent/internal/app/models"
+)
+
+// Submission 模拟OA中保存的报销单，字段与页面上的表单项一一对应
+type Submission struct {
+	BasicInfo   models.BasicItem `json:"basic_info"`
+	PayInfo     models.PayItem   `json:"pay_info"`
+	CostItems   []CostItem       `json:"cost_items"`
+	Files       []string         `json:"files"`
+	SubmittedAt time.Time        `json:"submitted_at"`
+}
+
+// CostItem 报销明细的一行
+type CostItem struct {
+	Category   string `json:"category"`
+	Name       string `json:"name"`
+	Comment    string `json:"comment"`
+	Cost       string `json:"cost"`
+	BillNumber string `json:"bill_number"`
+}
+
+// Diff 与填报请求比较，返回不一致的字段，全部一致时返回空
+// 表单中没有报销标题，不比较 BasicInfo.Title；文件只比较文件名
+func (s Submission) Diff(req *models.AutoFillingRequest) []string {
+	var diffs []string
+	check := func(field, want, got string) {
+		if want != got {
+			diffs = append(diffs, fmt.Sprintf("%s: 期望 %q，实际 %q", field, want, got))
+		}
+	}
+
+	check("报销类型", req.BasicInfo.Category, s.BasicInfo.Category)
+	check("紧急类型", req.BasicInfo.UrgentType, s.BasicInfo.UrgentType)
+	check("报销说明", req.BasicInfo.Comment, s.BasicInfo.Comment)
+	check("业务发生部门", req.PayInfo.BusinessDept, s.PayInfo.BusinessDept)
+	check("预算承担部门", req.PayInfo.BudgetDept, s.PayInfo.BudgetDept)
+	check("付款公司", req.PayInfo.PayDept, s.PayInfo.PayDept)
+	check("项目类型", req.PayInfo.ProjectType, s.PayInfo.ProjectType)
+	check("项目", req.PayInfo.Project, s.PayInfo.Project)
+
+	var items []models.CostItem
+	if req.CostItems != nil {
+		items = *req.CostItems
+	}
+	if len(items) != len(s.CostItems) {
+		diffs = append(diffs, fmt.Sprintf("报销明细: 期望 %d 行，实际 %d 行", len(items), len(s.CostItems)))
+	}
+	for i := 0; i < len(items) && i < len(s.CostItems); i++ {
+		row := fmt.Sprintf("明细第%d行", i+1)
+		check(row+"费用类别", items[i].Category, s.CostItems[i].Category)
+		check(row+"费用名称", items[i].Name, s.CostItems[i].Name)
+		check(row+"费用说明", items[i].Comment, s.CostItems[i].Comment)
+		check(row+"报销金额", items[i].Cost, s.CostItems[i].Cost)
+		check(row+"发票张数", items[i].BillNumber, s.CostItems[i].BillNumber)
+	}
+
+	if len(req.InvoiceFiles) != len(s.Files) {
+		diffs = append(diffs, fmt.Sprintf("发票文件: 期望 %d 个，实际 %d 个", len(req.InvoiceFiles), len(s.Files)))
+	}
+	for i := 0; i < len(req.InvoiceFiles) && i < len(s.Files); i++ {
+		check(fmt.Sprintf("第%d个发票文件", i+1), filepath.Base(req.InvoiceFiles[i]), s.Files[i])
+	}
+	return diffs
+}
@@ -0,0 +1,185 @@
+package ofd
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"invoice-agent/internal/app/models"
+)
+
+// eInvoice 全电发票（数电票）标准XML结构，只映射需要的字段
+type eInvoice struct {
+	XMLName xml.Name `xml:"EInvoice"`
+	Header  struct {
+		EIid          string `xml:"EIid"`
+		InherentLabel struct {
+			EInvoiceType struct {
+				LabelCode string `xml:"LabelCode"`
+				LabelName string `xml:"LabelName"`
+			} `xml:"EInvoiceType"`
+		} `xml:"InherentLabel"`
+	} `xml:"Header"`
+	Data struct {
+		Seller struct {
+			IdNum string `xml:"SellerIdNum"`
+			Name  string `xml:"SellerName"`
+		} `xml:"SellerInformation"`
+		Buyer struct {
+			IdNum string `xml:"BuyerIdNum"`
+			Name  string `xml:"BuyerName"`
+		} `xml:"BuyerInformation"`
+		Basic struct {
+			TotalAmWithoutTax      string `xml:"TotalAmWithoutTax"`
+			TotalTaxAm             string `xml:"TotalTaxAm"`
+			TotalTaxIncludedAmount string `xml:"TotalTax-includedAmount"`
+		} `xml:"BasicInformation"`
+		Items []struct {
+			ItemName string `xml:"ItemName"`
+			MeaUnits string `xml:"MeaUnits"`
+			Quantity string `xml:"Quantity"`
+			Amount   string `xml:"Amount"`
+			TaxRate  string `xml:"TaxRate"`
+			TaxAm    string `xml:"ComTaxAm"`
+		} `xml:"IssuItemInformation"`
+	} `xml:"EInvoiceData"`
+	TaxSupervision struct {
+		InvoiceNumber string `xml:"InvoiceNumber"`
+		IssueTime     string `xml:"IssueTime"`
+	} `xml:"TaxSupervisionInfo"`
+}
+
+// 费用类别关键字，按顺序匹配项目名称
+var categoryKeywords = []struct {
+	keywords []string
+	category models.ExpenseCategory
+}{
+	{[]string{"航空", "机票", "铁路", "火车", "住宿", "旅客运输"}, models.ExpenseCategoryTravel},
+	{[]string{"餐饮", "餐费", "酒", "烟", "食品"}, models.ExpenseCategoryEntertainment},
+	{[]string{"出租", "客运", "运输服务", "打车", "停车", "通行费"}, models.ExpenseCategoryTransport},
+}
+
+// parseEInvoice 解析全电发票XML并转换为InvoiceFile
+func parseEInvoice(data []byte) (*models.InvoiceFile, error) {
+	var inv eInvoice
+	if err := xml.Unmarshal(data, &inv); err != nil {
+		return nil, fmt.Errorf("解析发票XML失败: %w", err)
+	}
+
+	invoiceCode := strings.TrimSpace(inv.TaxSupervision.InvoiceNumber)
+	if invoiceCode == "" {
+		invoiceCode = strings.TrimSpace(inv.Header.EIid)
+	}
+	if invoiceCode == "" {
+		return nil, ErrNoInvoiceData
+	}
+
+	items := make([]models.InvoiceItem, 0, len(inv.Data.Items))
+	for _, it := range inv.Data.Items {
+		items = append(items, models.InvoiceItem{
+			Name:      strings.TrimSpace(it.ItemName),
+			Unit:      strings.TrimSpace(it.MeaUnits),
+			Quantity:  parseAmount(it.Quantity),
+			Amount:    parseAmount(it.Amount),
+			TaxRate:   strings.TrimSpace(it.TaxRate),
+			TaxAmount: parseAmount(it.TaxAm),
+		})
+	}
+
+	amount := parseAmount(inv.Data.Basic.TotalAmWithoutTax)
+	taxAmount := parseAmount(inv.Data.Basic.TotalTaxAm)
+	totalAmount := parseAmount(inv.Data.Basic.TotalTaxIncludedAmount)
+	if totalAmount == 0 {
+		totalAmount = amount + taxAmount
+	}
+
+	invoiceType := "电子发票"
+	if label := strings.TrimSpace(inv.Header.InherentLabel.EInvoiceType.LabelName); label != "" {
+		invoiceType = fmt.Sprintf("电子发票（%s）", label)
+	}
+
+	invoiceFile := &models.InvoiceFile{
+		InvoiceType:     invoiceType,
+		InvoiceCode:     invoiceCode,
+		IssueDate:       formatIssueDate(inv.TaxSupervision.IssueTime),
+		ServiceType:     models.ServiceTypeInvoice,
+		Amount:          amount,
+		TaxAmount:       taxAmount,
+		TotalAmount:     totalAmount,
+		BuyerName:       strings.TrimSpace(inv.Data.Buyer.Name),
+		BuyerID:         strings.TrimSpace(inv.Data.Buyer.IdNum),
+		SellerName:      strings.TrimSpace(inv.Data.Seller.Name),
+		SellerID:        strings.TrimSpace(inv.Data.Seller.IdNum),
+		ItemName:        joinItemNames(items),
+		ExpenseCategory: InferExpenseCategory(itemNames(items)...),
+		Items:           items,
+	}
+	invoiceFile.SetFieldSource(models.FieldSourceOFD, 1, models.ReviewFields...)
+	// 费用类别由项目名称推断，推断不出时需要人工确认
+	if invoiceFile.ExpenseCategory == "" {
+		invoiceFile.SetFieldSource(models.FieldSourceOFD, 0, "expense_category")
+	}
+	return invoiceFile, nil
+}
+
+func parseAmount(s string) float64 {
+	s = strings.TrimSpace(strings.ReplaceAll(s, ",", ""))
+	if s == "" {
+		return 0
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0
+	}
+	return v
+}
+
+// formatIssueDate 统一为提示词中约定的“YYYY年MM月DD日”格式
+func formatIssueDate(s string) string {
+	s = strings.TrimSpace(s)
+	for _, layout := range []string{"2006-01-02 15:04:05", "2006-01-02", "20060102"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.Format("2006年01月02日")
+		}
+	}
+	return s
+}
+
+// joinItemNames 合并项目名称，长度受限于 item_name 字段
+func joinItemNames(items []models.InvoiceItem) string {
+	names := make([]string, 0, len(items))
+	for _, it := range items {
+		if it.Name != "" {
+			names = append(names, it.Name)
+		}
+	}
+	joined := []rune(strings.Join(names, ","))
+	if len(joined) > 100 {
+		joined = joined[:100]
+	}
+	return string(joined)
+}
+
+func itemNames(items []models.InvoiceItem) []string {
+	names := make([]string, 0, len(items))
+	for _, it := range items {
+		names = append(names, it.Name)
+	}
+	return names
+}
+
+// InferExpenseCategory 根据项目名称或文件名等文本推断费用类别
+func InferExpenseCategory(texts ...string) models.ExpenseCategory {
+	for _, rule := range categoryKeywords {
+		for _, text := range texts {
+			for _, kw := range rule.keywords {
+				if strings.Contains(text, kw) {
+					return rule.category
+				}
+			}
+		}
+	}
+	return ""
+}
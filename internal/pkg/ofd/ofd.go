@@ -0,0 +1,99 @@
+// Package ofd 本地解析OFD/XML格式的全电发票，不依赖大模型
+package ofd
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"invoice-agent/internal/app/models"
+)
+
+// ErrNoInvoiceData 文件中没有可识别的发票结构化数据，需要回退到大模型识别
+var ErrNoInvoiceData = errors.New("未找到发票结构化数据")
+
+// IsSupported 是否为可本地解析的文件类型
+func IsSupported(fileName string) bool {
+	switch strings.ToLower(filepath.Ext(fileName)) {
+	case ".ofd", ".xml":
+		return true
+	default:
+		return false
+	}
+}
+
+// ParseFile 解析OFD或XML发票文件
+func ParseFile(filePath string) (*models.InvoiceFile, error) {
+	switch strings.ToLower(filepath.Ext(filePath)) {
+	case ".ofd":
+		return parseOFD(filePath)
+	case ".xml":
+		data, err := os.ReadFile(filePath)
+		if err != nil {
+			return nil, fmt.Errorf("读取文件失败: %w", err)
+		}
+		return Parse(data)
+	default:
+		return nil, fmt.Errorf("不支持的文件类型: %s", filepath.Ext(filePath))
+	}
+}
+
+// Parse 解析全电发票XML内容
+func Parse(data []byte) (*models.InvoiceFile, error) {
+	if rootName(data) != "EInvoice" {
+		return nil, ErrNoInvoiceData
+	}
+	return parseEInvoice(data)
+}
+
+// parseOFD OFD是zip包，发票XML一般以附件形式内嵌在 Doc_0/Attachs 下
+func parseOFD(filePath string) (*models.InvoiceFile, error) {
+	reader, err := zip.OpenReader(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("打开OFD文件失败: %w", err)
+	}
+	defer reader.Close()
+
+	for _, f := range reader.File {
+		if !strings.EqualFold(filepath.Ext(f.Name), ".xml") {
+			continue
+		}
+		data, err := readZipFile(f)
+		if err != nil {
+			return nil, err
+		}
+		if rootName(data) == "EInvoice" {
+			return parseEInvoice(data)
+		}
+	}
+	return nil, ErrNoInvoiceData
+}
+
+func readZipFile(f *zip.File) ([]byte, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, fmt.Errorf("读取OFD内容失败: %w", err)
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
+
+// rootName 返回XML根节点名称（不含命名空间）
+func rootName(data []byte) string {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return ""
+		}
+		if start, ok := token.(xml.StartElement); ok {
+			return start.Name.Local
+		}
+	}
+}
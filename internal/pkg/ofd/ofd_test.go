@@ -0,0 +1,114 @@
+package ofd
+
+import (
+	"errors"
+	"math"
+	"testing"
+
+	"invoice-agent/internal/app/models"
+)
+
+func TestParseFileXML(t *testing.T) {
+	invoice, err := ParseFile("testdata/hotel.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if invoice.InvoiceCode != "25312000000087654321" || invoice.InvoiceType != "电子发票（普通发票）" {
+		t.Errorf("发票号码或类型不正确: %s %s", invoice.InvoiceCode, invoice.InvoiceType)
+	}
+	if invoice.IssueDate != "2025年03月12日" {
+		t.Errorf("开票日期 %s，期望 2025年03月12日", invoice.IssueDate)
+	}
+	if !almostEqual(invoice.Amount, 1226.42) || !almostEqual(invoice.TaxAmount, 73.58) || !almostEqual(invoice.TotalAmount, 1300) {
+		t.Errorf("金额不正确: %.2f + %.2f = %.2f", invoice.Amount, invoice.TaxAmount, invoice.TotalAmount)
+	}
+	if invoice.SellerName != "上海浦东某某酒店管理有限公司" || invoice.BuyerName != "示例科技有限公司" {
+		t.Errorf("购买方或销售方不正确: %s / %s", invoice.BuyerName, invoice.SellerName)
+	}
+	if invoice.ExpenseCategory != models.ExpenseCategoryTravel {
+		t.Errorf("费用类别 %s，期望 %s", invoice.ExpenseCategory, models.ExpenseCategoryTravel)
+	}
+	if invoice.ItemName != "*住宿服务*住宿费,*餐饮服务*早餐" {
+		t.Errorf("项目名称 %s", invoice.ItemName)
+	}
+
+	want := models.InvoiceItems{
+		{Name: "*住宿服务*住宿费", Unit: "晚", Quantity: 2, Amount: 1132.08, TaxRate: "6%", TaxAmount: 67.92},
+		{Name: "*餐饮服务*早餐", Unit: "份", Quantity: 4, Amount: 94.34, TaxRate: "6%", TaxAmount: 5.66},
+	}
+	if len(invoice.Items) != len(want) {
+		t.Fatalf("明细%d行，期望%d行", len(invoice.Items), len(want))
+	}
+	for i := range want {
+		if invoice.Items[i] != want[i] {
+			t.Errorf("明细第%d行 %+v，期望 %+v", i+1, invoice.Items[i], want[i])
+		}
+	}
+	if invoice.MinConfidence() != 1 {
+		t.Errorf("本地解析的字段置信度应为1，实际 %v", invoice.MinConfidence())
+	}
+}
+
+func TestParseFileOFDAttachment(t *testing.T) {
+	invoice, err := ParseFile("testdata/taxi.ofd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if invoice.InvoiceCode != "25119111389000881684" || invoice.IssueDate != "2025年02月28日" {
+		t.Errorf("发票号码或日期不正确: %s %s", invoice.InvoiceCode, invoice.IssueDate)
+	}
+	if !almostEqual(invoice.TotalAmount, 24.37) || invoice.ExpenseCategory != models.ExpenseCategoryTransport {
+		t.Errorf("金额或费用类别不正确: %.2f %s", invoice.TotalAmount, invoice.ExpenseCategory)
+	}
+	if len(invoice.Items) != 1 || invoice.Items[0].TaxRate != "0.03" {
+		t.Errorf("明细不正确: %+v", invoice.Items)
+	}
+}
+
+func TestParseFileWithoutInvoiceData(t *testing.T) {
+	for _, path := range []string{"testdata/not_invoice.xml", "testdata/scanned.ofd"} {
+		if _, err := ParseFile(path); !errors.Is(err, ErrNoInvoiceData) {
+			t.Errorf("%s: 错误 %v，期望 ErrNoInvoiceData", path, err)
+		}
+	}
+	if _, err := ParseFile("testdata/hotel.pdf"); err == nil {
+		t.Error("不支持的文件类型应返回错误")
+	}
+}
+
+func TestInvoiceItemsValue(t *testing.T) {
+	items := models.InvoiceItems{{Name: "*住宿服务*住宿费", Unit: "晚", Quantity: 2, Amount: 1132.08, TaxRate: "6%", TaxAmount: 67.92}}
+	value, err := items.Value()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var scanned models.InvoiceItems
+	if err := scanned.Scan(value); err != nil {
+		t.Fatal(err)
+	}
+	if len(scanned) != 1 || scanned[0] != items[0] {
+		t.Errorf("保存后读取的明细 %+v，期望 %+v", scanned, items)
+	}
+
+	if value, _ := models.InvoiceItems(nil).Value(); value != nil {
+		t.Errorf("没有明细时应保存为NULL，实际 %v", value)
+	}
+}
+
+func TestInferExpenseCategory(t *testing.T) {
+	cases := map[string]models.ExpenseCategory{
+		"*旅客运输服务*国内航空":  models.ExpenseCategoryTravel,
+		"*餐饮服务*餐费":      models.ExpenseCategoryEntertainment,
+		"*运输服务*客运服务费":   models.ExpenseCategoryTransport,
+		"*信息技术服务*软件服务费": "",
+	}
+	for text, want := range cases {
+		if got := InferExpenseCategory(text); got != want {
+			t.Errorf("%s: 费用类别 %q，期望 %q", text, got, want)
+		}
+	}
+}
+
+func almostEqual(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
@@ -0,0 +1,145 @@
+// Package qrcode 本地识别PDF/图片发票上的二维码，用于预填和校验识别结果
+package qrcode
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/makiuchi-d/gozxing"
+	zxingqr "github.com/makiuchi-d/gozxing/qrcode"
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+)
+
+// ErrNotFound 文件中没有识别到发票二维码
+var ErrNotFound = errors.New("未识别到发票二维码")
+
+// 小图放大到的最小边长，PDF内嵌的二维码图片通常很小
+const minDecodeSize = 300
+
+// IsSupported 是否为可识别二维码的文件类型
+func IsSupported(fileName string) bool {
+	switch strings.ToLower(filepath.Ext(fileName)) {
+	case ".pdf", ".png", ".jpg", ".jpeg", ".gif":
+		return true
+	default:
+		return false
+	}
+}
+
+// DecodeFile 识别文件中的发票二维码
+func DecodeFile(filePath string) (*InvoiceQR, error) {
+	var images []image.Image
+	var err error
+	if strings.EqualFold(filepath.Ext(filePath), ".pdf") {
+		images, err = pdfImages(filePath)
+	} else {
+		images, err = fileImage(filePath)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, img := range images {
+		text, err := decodeImage(img)
+		if err != nil {
+			continue
+		}
+		if qr, err := ParsePayload(text); err == nil {
+			return qr, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func fileImage(filePath string) ([]image.Image, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("打开文件失败: %w", err)
+	}
+	defer file.Close()
+
+	img, _, err := image.Decode(file)
+	if err != nil {
+		return nil, fmt.Errorf("解码图片失败: %w", err)
+	}
+	return []image.Image{img}, nil
+}
+
+// pdfImages 提取PDF首页内嵌的图片，发票二维码位于首页左上角
+func pdfImages(filePath string) ([]image.Image, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("打开文件失败: %w", err)
+	}
+	defer file.Close()
+
+	pages, err := api.ExtractImagesRaw(file, []string{"1"}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("提取PDF图片失败: %w", err)
+	}
+
+	images := make([]image.Image, 0)
+	for _, page := range pages {
+		for _, raw := range page {
+			img, _, err := image.Decode(io.Reader(raw))
+			if err != nil {
+				continue
+			}
+			images = append(images, img)
+		}
+	}
+	return images, nil
+}
+
+func decodeImage(img image.Image) (string, error) {
+	bmp, err := gozxing.NewBinaryBitmapFromImage(prepare(img))
+	if err != nil {
+		return "", err
+	}
+	hints := map[gozxing.DecodeHintType]interface{}{
+		gozxing.DecodeHintType_TRY_HARDER: true,
+	}
+	result, err := zxingqr.NewQRCodeReader().Decode(bmp, hints)
+	if err != nil {
+		return "", err
+	}
+	return result.GetText(), nil
+}
+
+// prepare 为小图添加白边并放大，提高识别率
+func prepare(img image.Image) image.Image {
+	bounds := img.Bounds()
+	size := bounds.Dx()
+	if bounds.Dy() < size {
+		size = bounds.Dy()
+	}
+	if size <= 0 || size >= minDecodeSize {
+		return img
+	}
+
+	scale := (minDecodeSize + size - 1) / size
+	margin := 4 * scale
+	dst := image.NewGray(image.Rect(0, 0, bounds.Dx()*scale+2*margin, bounds.Dy()*scale+2*margin))
+	draw.Draw(dst, dst.Bounds(), &image.Uniform{C: color.White}, image.Point{}, draw.Src)
+	for y := 0; y < bounds.Dy(); y++ {
+		for x := 0; x < bounds.Dx(); x++ {
+			c := img.At(bounds.Min.X+x, bounds.Min.Y+y)
+			for dy := 0; dy < scale; dy++ {
+				for dx := 0; dx < scale; dx++ {
+					dst.Set(margin+x*scale+dx, margin+y*scale+dy, c)
+				}
+			}
+		}
+	}
+	return dst
+}
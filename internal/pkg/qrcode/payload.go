@@ -0,0 +1,153 @@
+package qrcode
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"invoice-agent/internal/app/models"
+)
+
+// 发票种类代码
+var invoiceTypeNames = map[string]string{
+	"01": "增值税专用发票",
+	"04": "增值税普通发票",
+	"08": "增值税电子专用发票",
+	"10": "增值税电子普通发票",
+	"31": "电子发票（增值税专用发票）",
+	"32": "电子发票（普通发票）",
+}
+
+// 金额比对容差
+const amountTolerance = 0.01
+
+// InvoiceQR 发票二维码内容
+// 格式：版本,发票种类,发票代码,发票号码,开票金额,开票日期,校验码,加密串
+type InvoiceQR struct {
+	Raw           string  `json:"raw"`
+	TypeCode      string  `json:"type_code"`
+	InvoiceCode   string  `json:"invoice_code"` // 发票代码，数电票为空
+	InvoiceNumber string  `json:"invoice_number"`
+	Amount        float64 `json:"amount"`
+	IssueDate     string  `json:"issue_date"` // YYYYMMDD
+	CheckCode     string  `json:"check_code"`
+}
+
+// TaxIncluded 二维码金额是否为价税合计，数电票为价税合计，其他发票为不含税金额
+func (q *InvoiceQR) TaxIncluded() bool {
+	return q.TypeCode == "31" || q.TypeCode == "32" || q.InvoiceCode == ""
+}
+
+// ParsePayload 解析发票二维码文本
+func ParsePayload(raw string) (*InvoiceQR, error) {
+	fields := strings.Split(strings.TrimSpace(raw), ",")
+	if len(fields) < 7 || fields[0] != "01" {
+		return nil, fmt.Errorf("不是发票二维码: %s", raw)
+	}
+	for i := range fields {
+		fields[i] = strings.TrimSpace(fields[i])
+	}
+	if fields[3] == "" {
+		return nil, fmt.Errorf("二维码缺少发票号码: %s", raw)
+	}
+	if _, err := time.Parse("20060102", fields[5]); err != nil {
+		return nil, fmt.Errorf("二维码开票日期格式错误: %s", fields[5])
+	}
+	amount, err := strconv.ParseFloat(fields[4], 64)
+	if err != nil {
+		return nil, fmt.Errorf("二维码金额格式错误: %s", fields[4])
+	}
+
+	return &InvoiceQR{
+		Raw:           strings.TrimSpace(raw),
+		TypeCode:      fields[1],
+		InvoiceCode:   fields[2],
+		InvoiceNumber: fields[3],
+		Amount:        amount,
+		IssueDate:     fields[5],
+		CheckCode:     fields[6],
+	}, nil
+}
+
+// Seed 用二维码内容预填发票信息
+func (q *InvoiceQR) Seed(f *models.InvoiceFile) {
+	f.QRCode = q.Raw
+	f.InvoiceCode = q.InvoiceNumber
+	f.IssueDate = q.formatIssueDate()
+	f.SetFieldSource(models.FieldSourceQR, 1, "invoice_code", "issue_date")
+	if q.TaxIncluded() {
+		f.TotalAmount = q.Amount
+		f.SetFieldSource(models.FieldSourceQR, 1, "total_amount")
+	} else {
+		f.Amount = q.Amount
+		f.SetFieldSource(models.FieldSourceQR, 1, "amount")
+	}
+	if name, ok := invoiceTypeNames[q.TypeCode]; ok {
+		f.InvoiceType = name
+		f.SetFieldSource(models.FieldSourceQR, 1, "invoice_type")
+	}
+}
+
+// Reconcile 比对大模型识别结果与二维码内容，不一致时以二维码为准并记录差异
+func (q *InvoiceQR) Reconcile(f *models.InvoiceFile) []string {
+	mismatches := make([]string, 0)
+
+	if f.InvoiceCode != q.InvoiceNumber {
+		mismatches = append(mismatches, fmt.Sprintf("发票号码: 识别为%q, 二维码为%q", f.InvoiceCode, q.InvoiceNumber))
+		f.InvoiceCode = q.InvoiceNumber
+	}
+
+	if digits(f.IssueDate) != q.IssueDate {
+		mismatches = append(mismatches, fmt.Sprintf("开票日期: 识别为%q, 二维码为%q", f.IssueDate, q.formatIssueDate()))
+		f.IssueDate = q.formatIssueDate()
+	}
+
+	f.SetFieldSource(models.FieldSourceQR, 1, "invoice_code", "issue_date")
+
+	// 数电票二维码金额为价税合计，其他发票为不含税金额
+	switch {
+	case q.Amount <= 0:
+	case q.TaxIncluded() && amountEqual(f.TotalAmount, q.Amount):
+		f.SetFieldSource(models.FieldSourceQR, 1, "total_amount")
+	case q.TaxIncluded():
+		mismatches = append(mismatches, fmt.Sprintf("价税合计: 识别为%.2f, 二维码为%.2f", f.TotalAmount, q.Amount))
+		f.TotalAmount = q.Amount
+		f.Amount = q.Amount - f.TaxAmount
+		f.SetFieldSource(models.FieldSourceQR, 1, "total_amount")
+	case amountEqual(f.Amount, q.Amount):
+		f.SetFieldSource(models.FieldSourceQR, 1, "amount")
+	default:
+		mismatches = append(mismatches, fmt.Sprintf("金额: 识别为%.2f, 二维码为%.2f", f.Amount, q.Amount))
+		f.Amount = q.Amount
+		f.TotalAmount = q.Amount + f.TaxAmount
+		f.SetFieldSource(models.FieldSourceQR, 1, "amount")
+	}
+
+	f.QRCode = q.Raw
+	f.QRMismatch = strings.Join(mismatches, "; ")
+	return mismatches
+}
+
+func (q *InvoiceQR) formatIssueDate() string {
+	t, err := time.Parse("20060102", q.IssueDate)
+	if err != nil {
+		return q.IssueDate
+	}
+	return t.Format("2006年01月02日")
+}
+
+func amountEqual(a, b float64) bool {
+	return math.Abs(a-b) < amountTolerance
+}
+
+func digits(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if r >= '0' && r <= '9' {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,110 @@
+package qrcode
+
+import (
+	"math"
+	"testing"
+
+	"invoice-agent/internal/app/models"
+)
+
+func TestParsePayload(t *testing.T) {
+	qr, err := ParsePayload(" 01,32,,25312000000087654321,1300.00,20250312,,A1B2, \n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if qr.TypeCode != "32" || qr.InvoiceCode != "" || qr.InvoiceNumber != "25312000000087654321" {
+		t.Errorf("发票种类或号码不正确: %+v", qr)
+	}
+	if qr.Amount != 1300 || qr.IssueDate != "20250312" || qr.formatIssueDate() != "2025年03月12日" {
+		t.Errorf("金额或日期不正确: %.2f %s", qr.Amount, qr.IssueDate)
+	}
+	if !qr.TaxIncluded() {
+		t.Error("数电票二维码金额应为价税合计")
+	}
+
+	qr, err = ParsePayload("01,04,011002300111,12345678,100.00,20240105,12345678901234567890,ABCD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if qr.InvoiceCode != "011002300111" || qr.CheckCode != "12345678901234567890" || qr.TaxIncluded() {
+		t.Errorf("普通发票解析不正确: %+v", qr)
+	}
+
+	invalid := map[string]string{
+		"不是发票二维码": "https://example.com/invoice?id=1",
+		"版本号错误":   "02,04,011002300111,12345678,100.00,20240105,123456",
+		"字段不足":    "01,04,011002300111,12345678,100.00",
+		"缺少发票号码":  "01,04,011002300111,,100.00,20240105,123456",
+		"日期格式错误":  "01,04,011002300111,12345678,100.00,2024-01-05,123456",
+		"金额格式错误":  "01,04,011002300111,12345678,一百元,20240105,123456",
+	}
+	for name, raw := range invalid {
+		if _, err := ParsePayload(raw); err == nil {
+			t.Errorf("%s: 应返回错误", name)
+		}
+	}
+}
+
+func TestReconcileDigitalInvoice(t *testing.T) {
+	qr, err := ParsePayload("01,32,,25312000000087654321,1300.00,20250312,,")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 价税合计一致，不应把税额再加一遍
+	f := &models.InvoiceFile{InvoiceCode: "25312000000087654321", IssueDate: "2025年03月12日", Amount: 1226.42, TaxAmount: 73.58, TotalAmount: 1300}
+	if mismatches := qr.Reconcile(f); len(mismatches) > 0 {
+		t.Errorf("识别结果与二维码一致时不应有差异: %v", mismatches)
+	}
+	if !almostEqual(f.Amount, 1226.42) || !almostEqual(f.TotalAmount, 1300) {
+		t.Errorf("金额被修改为 %.2f + %.2f = %.2f", f.Amount, f.TaxAmount, f.TotalAmount)
+	}
+
+	// 价税合计识别错误时以二维码为准，不含税金额按税额倒推
+	f = &models.InvoiceFile{InvoiceCode: "25312000000087654321", IssueDate: "2025年03月12日", Amount: 1226.42, TaxAmount: 73.58, TotalAmount: 1800}
+	if mismatches := qr.Reconcile(f); len(mismatches) != 1 {
+		t.Errorf("应记录价税合计不一致: %v", mismatches)
+	}
+	if !almostEqual(f.Amount, 1226.42) || !almostEqual(f.TotalAmount, 1300) {
+		t.Errorf("金额应修正为 1226.42 + 73.58 = 1300.00，实际 %.2f + %.2f = %.2f", f.Amount, f.TaxAmount, f.TotalAmount)
+	}
+}
+
+func TestReconcileTraditionalInvoice(t *testing.T) {
+	qr, err := ParsePayload("01,04,011002300111,12345678,100.00,20240105,12345678901234567890,ABCD")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f := &models.InvoiceFile{InvoiceCode: "12345679", IssueDate: "2024年01月05日", Amount: 108, TaxAmount: 6, TotalAmount: 114}
+	mismatches := qr.Reconcile(f)
+	if len(mismatches) != 2 {
+		t.Errorf("发票号码和金额都应记录差异: %v", mismatches)
+	}
+	if f.InvoiceCode != "12345678" || !almostEqual(f.Amount, 100) || !almostEqual(f.TotalAmount, 106) {
+		t.Errorf("应以二维码为准: %s %.2f + %.2f = %.2f", f.InvoiceCode, f.Amount, f.TaxAmount, f.TotalAmount)
+	}
+	if f.QRMismatch == "" || f.QRCode != qr.Raw {
+		t.Errorf("应保存二维码内容和差异: %+v", f)
+	}
+}
+
+func TestSeedByInvoiceKind(t *testing.T) {
+	digital, _ := ParsePayload("01,32,,25312000000087654321,1300.00,20250312,,")
+	f := &models.InvoiceFile{}
+	digital.Seed(f)
+	if f.TotalAmount != 1300 || f.Amount != 0 || f.InvoiceType != "电子发票（普通发票）" {
+		t.Errorf("数电票应预填价税合计: %+v", f)
+	}
+
+	traditional, _ := ParsePayload("01,04,011002300111,12345678,100.00,20240105,123456")
+	f = &models.InvoiceFile{}
+	traditional.Seed(f)
+	if f.Amount != 100 || f.TotalAmount != 0 || f.IssueDate != "2024年01月05日" {
+		t.Errorf("普通发票应预填不含税金额: %+v", f)
+	}
+}
+
+func almostEqual(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
@@ -0,0 +1,129 @@
+package schema
+
+import (
+	"strings"
+)
+
+// Repair 修复模型输出中常见的格式问题：markdown代码块、前后说明文字、注释、多余的逗号
+func Repair(content string) string {
+	content = stripFences(strings.TrimSpace(content))
+	content = extractJSON(content)
+	content = stripComments(content)
+	content = stripTrailingCommas(content)
+	return strings.TrimSpace(content)
+}
+
+// stripFences 去掉 ```json ... ``` 代码块标记
+func stripFences(content string) string {
+	start := strings.Index(content, "```")
+	if start < 0 {
+		return content
+	}
+	body := content[start+3:]
+	if nl := strings.Index(body, "\n"); nl >= 0 {
+		body = body[nl+1:]
+	}
+	if end := strings.LastIndex(body, "```"); end >= 0 {
+		body = body[:end]
+	}
+	return body
+}
+
+// extractJSON 截取第一个 [ 或 { 到最后一个对应括号之间的内容
+func extractJSON(content string) string {
+	start := strings.IndexAny(content, "[{")
+	if start < 0 {
+		return content
+	}
+	closing := "]"
+	if content[start] == '{' {
+		closing = "}"
+	}
+	end := strings.LastIndex(content, closing)
+	if end < start {
+		return content[start:]
+	}
+	return content[start : end+1]
+}
+
+// stripComments 去掉字符串之外的 // 与 /* */ 注释
+func stripComments(content string) string {
+	var b strings.Builder
+	inString, escaped := false, false
+	for i := 0; i < len(content); i++ {
+		c := content[i]
+		if inString {
+			b.WriteByte(c)
+			switch {
+			case escaped:
+				escaped = false
+			case c == '\\':
+				escaped = true
+			case c == '"':
+				inString = false
+			}
+			continue
+		}
+		if c == '"' {
+			inString = true
+			b.WriteByte(c)
+			continue
+		}
+		if c == '/' && i+1 < len(content) {
+			if content[i+1] == '/' {
+				for i < len(content) && content[i] != '\n' {
+					i++
+				}
+				if i < len(content) {
+					b.WriteByte('\n')
+				}
+				continue
+			}
+			if content[i+1] == '*' {
+				end := strings.Index(content[i+2:], "*/")
+				if end < 0 {
+					break
+				}
+				i += end + 3
+				continue
+			}
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
+// stripTrailingCommas 去掉 ] 或 } 之前多余的逗号
+func stripTrailingCommas(content string) string {
+	var b strings.Builder
+	inString, escaped := false, false
+	for i := 0; i < len(content); i++ {
+		c := content[i]
+		if inString {
+			switch {
+			case escaped:
+				escaped = false
+			case c == '\\':
+				escaped = true
+			case c == '"':
+				inString = false
+			}
+			b.WriteByte(c)
+			continue
+		}
+		if c == '"' {
+			inString = true
+		}
+		if c == ',' {
+			j := i + 1
+			for j < len(content) && strings.IndexByte(" \t\r\n", content[j]) >= 0 {
+				j++
+			}
+			if j < len(content) && (content[j] == ']' || content[j] == '}') {
+				continue
+			}
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
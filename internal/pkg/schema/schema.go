@@ -0,0 +1,218 @@
+// Package schema 由结构体生成JSON Schema，并校验大模型输出的JSON
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// JSON Schema 类型
+const (
+	TypeObject  = "object"
+	TypeArray   = "array"
+	TypeString  = "string"
+	TypeInteger = "integer"
+	TypeNumber  = "number"
+	TypeBoolean = "boolean"
+)
+
+// Schema JSON Schema 的子集，足够描述模型输出结构
+type Schema struct {
+	Type       string             `json:"type"`
+	Properties map[string]*Schema `json:"properties,omitempty"`
+	Required   []string           `json:"required,omitempty"`
+	Items      *Schema            `json:"items,omitempty"`
+	Enum       []string           `json:"enum,omitempty"`
+	MinLength  int                `json:"minLength,omitempty"`
+}
+
+// Violation 字段级别的校验错误
+type Violation struct {
+	Index   int    `json:"index"` // 顶层数组元素下标，非数组元素为-1
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+func (v Violation) String() string {
+	return fmt.Sprintf("%s: %s", v.Path, v.Message)
+}
+
+// FromStruct 根据结构体的 json 与 schema 标签生成对象Schema
+// 只有带 schema 标签的字段会出现在Schema中，标签格式：schema:"required,enum=1|2,minLength=1"
+func FromStruct(v interface{}) *Schema {
+	t := reflect.TypeOf(v)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	s := &Schema{Type: TypeObject, Properties: make(map[string]*Schema)}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag, ok := field.Tag.Lookup("schema")
+		if !ok {
+			continue
+		}
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "" {
+			name = field.Name
+		}
+		prop := &Schema{Type: kindType(field.Type.Kind())}
+		for _, opt := range strings.Split(tag, ",") {
+			switch {
+			case opt == "required":
+				s.Required = append(s.Required, name)
+			case strings.HasPrefix(opt, "enum="):
+				prop.Enum = strings.Split(strings.TrimPrefix(opt, "enum="), "|")
+			case strings.HasPrefix(opt, "minLength="):
+				prop.MinLength, _ = strconv.Atoi(strings.TrimPrefix(opt, "minLength="))
+			}
+		}
+		s.Properties[name] = prop
+	}
+	return s
+}
+
+// ArrayOf 生成元素为 item 的数组Schema
+func ArrayOf(item *Schema) *Schema {
+	return &Schema{Type: TypeArray, Items: item}
+}
+
+func kindType(kind reflect.Kind) string {
+	switch kind {
+	case reflect.String:
+		return TypeString
+	case reflect.Bool:
+		return TypeBoolean
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return TypeInteger
+	case reflect.Float32, reflect.Float64:
+		return TypeNumber
+	case reflect.Slice, reflect.Array:
+		return TypeArray
+	default:
+		return TypeObject
+	}
+}
+
+// ValidateJSON 解析并校验JSON文本
+func (s *Schema) ValidateJSON(data []byte) ([]Violation, error) {
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return nil, err
+	}
+	return s.Validate(value), nil
+}
+
+// Validate 校验 json.Unmarshal 得到的数据
+func (s *Schema) Validate(value interface{}) []Violation {
+	violations := make([]Violation, 0)
+	s.validate(value, "$", -1, &violations)
+	return violations
+}
+
+func (s *Schema) validate(value interface{}, path string, index int, violations *[]Violation) {
+	add := func(format string, args ...interface{}) {
+		*violations = append(*violations, Violation{Index: index, Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	switch s.Type {
+	case TypeArray:
+		arr, ok := value.([]interface{})
+		if !ok {
+			add("应为数组，实际为%s", typeName(value))
+			return
+		}
+		if s.Items == nil {
+			return
+		}
+		for i, item := range arr {
+			itemIndex := index
+			if itemIndex < 0 {
+				itemIndex = i
+			}
+			s.Items.validate(item, fmt.Sprintf("%s[%d]", path, i), itemIndex, violations)
+		}
+	case TypeObject:
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			add("应为对象，实际为%s", typeName(value))
+			return
+		}
+		for _, name := range s.Required {
+			if _, exists := obj[name]; !exists {
+				*violations = append(*violations, Violation{Index: index, Path: path + "." + name, Message: "缺少必填字段"})
+			}
+		}
+		names := make([]string, 0, len(s.Properties))
+		for name := range s.Properties {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if v, exists := obj[name]; exists {
+				s.Properties[name].validate(v, path+"."+name, index, violations)
+			}
+		}
+	case TypeString:
+		str, ok := value.(string)
+		if !ok {
+			add("应为字符串，实际为%s", typeName(value))
+			return
+		}
+		if len([]rune(str)) < s.MinLength {
+			add("不能为空")
+			return
+		}
+		s.validateEnum(str, add)
+	case TypeInteger:
+		num, ok := value.(float64)
+		if !ok || num != float64(int64(num)) {
+			add("应为整数，实际为%s", typeName(value))
+			return
+		}
+		s.validateEnum(strconv.FormatInt(int64(num), 10), add)
+	case TypeNumber:
+		if _, ok := value.(float64); !ok {
+			add("应为数字，实际为%s", typeName(value))
+		}
+	case TypeBoolean:
+		if _, ok := value.(bool); !ok {
+			add("应为布尔值，实际为%s", typeName(value))
+		}
+	}
+}
+
+func (s *Schema) validateEnum(value string, add func(format string, args ...interface{})) {
+	if len(s.Enum) == 0 {
+		return
+	}
+	for _, e := range s.Enum {
+		if e == value {
+			return
+		}
+	}
+	add("取值%q不在可选范围[%s]内", value, strings.Join(s.Enum, "/"))
+}
+
+func typeName(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case string:
+		return fmt.Sprintf("字符串%q", v)
+	case float64:
+		return "数字" + strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return "布尔值"
+	case []interface{}:
+		return "数组"
+	case map[string]interface{}:
+		return "对象"
+	default:
+		return fmt.Sprintf("%T", v)
+	}
+}
@@ -0,0 +1,65 @@
+// Package vault 使用主密钥加密保存敏感信息（如OA账号密码）
+package vault
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrNoMasterKey 未配置主密钥
+var ErrNoMasterKey = errors.New("未配置凭据加密主密钥")
+
+// Vault AES-256-GCM 加解密，密文格式为 base64(nonce|ciphertext)
+type Vault struct {
+	aead cipher.AEAD
+}
+
+// New 由主密钥创建 Vault，主密钥经 SHA-256 派生为 32 字节的 AES 密钥
+func New(masterKey string) (*Vault, error) {
+	if masterKey == "" {
+		return nil, ErrNoMasterKey
+	}
+	key := sha256.Sum256([]byte(masterKey))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, fmt.Errorf("创建加密器失败: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("创建加密器失败: %w", err)
+	}
+	return &Vault{aead: aead}, nil
+}
+
+// Encrypt 加密明文
+func (v *Vault) Encrypt(plaintext string) (string, error) {
+	nonce := make([]byte, v.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", fmt.Errorf("生成随机数失败: %w", err)
+	}
+	sealed := v.aead.Seal(nonce, nonce, []byte(plaintext), nil)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt 解密密文，主密钥不一致或密文被篡改时返回错误
+func (v *Vault) Decrypt(ciphertext string) (string, error) {
+	data, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil {
+		return "", fmt.Errorf("密文格式错误: %w", err)
+	}
+	nonceSize := v.aead.NonceSize()
+	if len(data) < nonceSize {
+		return "", errors.New("密文长度错误")
+	}
+	plaintext, err := v.aead.Open(nil, data[:nonceSize], data[nonceSize:], nil)
+	if err != nil {
+		return "", fmt.Errorf("解密失败: %w", err)
+	}
+	return string(plaintext), nil
+}
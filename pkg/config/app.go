@@ -9,8 +9,15 @@ var AppConf App
 
 // App viper的yaml格式使用mapstructure进行序列化和反序列化，tag为yaml实际不生效，使用默认小写
 type App struct {
-	Servername string `mapstructure:"servername"`
-	Port       int    `mapstructure:"port"`
+	Servername    string `mapstructure:"servername"`
+	Port          int    `mapstructure:"port"`
+	CredentialKey string `mapstructure:"credential_key"` // OA账号密码的加密主密钥，更换后已保存的密码无法解密
+
+	FillingWorkers   int `mapstructure:"filling_workers"`    // 同时执行的自动填报任务数
+	FillingQueueSize int `mapstructure:"filling_queue_size"` // 排队任务上限，队列已满时拒绝新任务
+
+	CompanyNames    []string `mapstructure:"company_names"`    // 公司名称，票据的购买方必须是其中之一，为空时不校验
+	AmountTolerance float64  `mapstructure:"amount_tolerance"` // 金额+税额与价税合计允许的误差
 }
 
 func GetAppConf() App {
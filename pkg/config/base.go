@@ -33,4 +33,7 @@ func Init(runMode string) {
 	loadConf(v, "app", &AppConf)
 	loadConf(v, "mysql", &mysqlConf)
 	loadConf(v, "openai", &myopenai)
+	loadConf(v, "form_script", &formScript)
+	loadConf(v, "expense_policy", &expensePolicy)
+	loadConf(v, "slot_filling", &slotFilling)
 }
@@ -0,0 +1,42 @@
+package config
+
+var expensePolicy ExpensePolicy
+
+// ExpensePolicy 公司报销政策，开始填报前按报销单的全部票据检查，金额单位为元
+type ExpensePolicy struct {
+	Enabled      bool                `mapstructure:"enabled"`
+	CategoryCaps map[string]float64  `mapstructure:"category_caps"` // 费用类别 -> 单次报销的金额上限
+	CityTiers    map[string][]string `mapstructure:"city_tiers"`    // 城市等级 -> 城市，按销售方名称中的城市判断
+	DefaultTier  string              `mapstructure:"default_tier"`  // 销售方名称中没有已配置城市时的等级
+	DailyLimits  []PolicyDailyLimit  `mapstructure:"daily_limits"`
+	Disallowed   []PolicyKeyword     `mapstructure:"disallowed"`
+	Attachments  []PolicyAttachment  `mapstructure:"attachments"`
+}
+
+// PolicyDailyLimit 按城市等级的每日限额。配置了 Units 时按发票明细的数量折算为每天的金额，如住宿按晚数；
+// 否则同一开票日期、同一城市等级的票据金额合计计算
+type PolicyDailyLimit struct {
+	Name     string             `mapstructure:"name"`
+	Keywords []string           `mapstructure:"keywords"` // 项目名称包含其中之一的发票或明细计入
+	Units    []string           `mapstructure:"units"`    // 明细的计量单位为其中之一时，数量即为天数，如 天/晚/间夜
+	Limits   map[string]float64 `mapstructure:"limits"`   // 城市等级 -> 每日限额，未配置的等级不限
+}
+
+// PolicyKeyword 不允许报销的项目，Categories 为空时对所有费用类别生效
+type PolicyKeyword struct {
+	Keyword    string   `mapstructure:"keyword"`
+	Exclude    []string `mapstructure:"exclude"` // 包含关键字但不属于该项目的词，如“酒”排除“酒店”
+	Categories []string `mapstructure:"categories"`
+	Message    string   `mapstructure:"message"`
+}
+
+// PolicyAttachment 必须附带的票据，如出租车发票需要附行程单
+type PolicyAttachment struct {
+	Name     string   `mapstructure:"name"`
+	Keywords []string `mapstructure:"keywords"` // 项目名称或发票类型包含其中之一的发票需要附件
+	Requires []string `mapstructure:"requires"` // 关联到该发票的非发票类票据，项目名称、类型或文件名包含其中之一即视为附件
+}
+
+func GetExpensePolicy() ExpensePolicy {
+	return expensePolicy
+}
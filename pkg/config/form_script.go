@@ -0,0 +1,93 @@
+package config
+
+import "time"
+
+var formScript FormScript
+
+// FormScript OA报销表单的自动化脚本：页面地址、登录步骤、字段与选择器的对应关系，由通用执行器按顺序执行
+type FormScript struct {
+	Name           string        `mapstructure:"name"`
+	BaseURL        string        `mapstructure:"base_url"`
+	Timeout        time.Duration `mapstructure:"timeout"`         // 每步操作及等待条件的默认超时
+	Deadline       time.Duration `mapstructure:"deadline"`        // 整个任务的截止时间，从启动浏览器开始计算
+	Retry          FormRetry     `mapstructure:"retry"`           // 默认重试策略，分组和表格不整体重试，上传按文件重试
+	DropdownOption string        `mapstructure:"dropdown_option"` // 下拉选项的选择器，best_match 策略使用
+	RequirePreview bool          `mapstructure:"require_preview"` // 正式填报前必须先预览并确认填报计划
+	Capture        string        `mapstructure:"capture"`         // 步骤截图与HTML快照的默认时机：failure(默认)/always/none
+	Trace          bool          `mapstructure:"trace"`           // 为每个任务记录 Playwright 追踪文件
+	Login          []FormStep    `mapstructure:"login"`           // 登录步骤，测试OA账号时单独执行
+	Steps          []FormStep    `mapstructure:"steps"`           // 登录后的填报步骤
+}
+
+// FormStep 脚本中的一步操作，文本类字段支持 {{basic.Title}}、{{pay.PayDept}}、{{item.Cost}} 等占位符
+type FormStep struct {
+	Name     string        `mapstructure:"name"`
+	Action   string        `mapstructure:"action"`   // goto/fill/click/wait/sleep/wheel/select/upload/table/group
+	Progress string        `mapstructure:"progress"` // 执行前输出的进度
+	Done     string        `mapstructure:"done"`     // 执行成功后输出的进度
+	Optional bool          `mapstructure:"optional"` // 失败时输出进度并继续执行后续步骤
+	Delay    time.Duration `mapstructure:"delay"`    // 操作后固定等待，仅用于无法用 wait_for 描述的场景
+
+	WaitFor *FormCondition `mapstructure:"wait_for"` // 操作后等待页面就绪
+	Timeout time.Duration  `mapstructure:"timeout"`  // 覆盖默认超时
+	Retry   *FormRetry     `mapstructure:"retry"`    // 覆盖默认重试策略
+	Submit  bool           `mapstructure:"submit"`   // 提交类步骤，预览模式执行到此处停止
+	Capture string         `mapstructure:"capture"`  // 覆盖脚本的截图与HTML快照时机
+
+	Target FormLocator `mapstructure:"target"`
+	State  string      `mapstructure:"state"` // wait: visible(默认)/hidden/attached/detached
+	URL    string      `mapstructure:"url"`   // goto
+	Value  string      `mapstructure:"value"` // fill/select
+	X      float64     `mapstructure:"x"`     // wheel
+	Y      float64     `mapstructure:"y"`     // wheel
+
+	// select: best_match 精确→模糊→第一个选项；exact_text 按文本精确点击；visible_text 点击第一个可见的文本；option 按 Option 定位
+	Strategy string      `mapstructure:"strategy"`
+	Option   FormLocator `mapstructure:"option"`
+
+	Files string `mapstructure:"files"` // upload: invoice_files/other_files，逐个文件上传
+
+	// table: 按 Rows 的每一项新增一行并填写各列，Columns 中的步骤以 Column 指定的单元格为作用域
+	Rows    string      `mapstructure:"rows"` // cost_items
+	AddRow  FormLocator `mapstructure:"add_row"`
+	Row     FormLocator `mapstructure:"row"`
+	Columns []FormStep  `mapstructure:"columns"`
+	Column  int         `mapstructure:"column"`
+
+	Steps []FormStep `mapstructure:"steps"` // group
+}
+
+// FormCondition 页面就绪条件，配置多项时须全部满足
+type FormCondition struct {
+	Target    FormLocator `mapstructure:"target"`     // 元素达到 State 状态
+	State     string      `mapstructure:"state"`      // visible(默认)/hidden/attached/detached
+	LoadState string      `mapstructure:"load_state"` // load/domcontentloaded/networkidle
+	URL       string      `mapstructure:"url"`        // 页面地址匹配，支持 glob，如 **/#/reimbursement/**
+}
+
+// FormRetry 失败重试策略，每次重试前的等待从 Backoff 开始倍增，不超过 MaxBackoff
+type FormRetry struct {
+	Attempts   int           `mapstructure:"attempts"` // 总尝试次数，0 和 1 都表示不重试
+	Backoff    time.Duration `mapstructure:"backoff"`
+	MaxBackoff time.Duration `mapstructure:"max_backoff"`
+}
+
+// FormLocator 元素定位，Role/Text/Selector 三选一，Within 指定查找范围
+type FormLocator struct {
+	Selector string       `mapstructure:"selector"`
+	Role     string       `mapstructure:"role"`
+	Name     string       `mapstructure:"name"`
+	Text     string       `mapstructure:"text"`
+	Exact    bool         `mapstructure:"exact"`
+	Last     bool         `mapstructure:"last"`
+	Within   *FormLocator `mapstructure:"within"`
+}
+
+// IsEmpty 是否未配置定位
+func (l FormLocator) IsEmpty() bool {
+	return l.Selector == "" && l.Role == "" && l.Text == ""
+}
+
+func GetFormScript() FormScript {
+	return formScript
+}
@@ -3,13 +3,29 @@ package config
 var myopenai Openai
 
 type Openai struct {
-	ApiKey      string `mapstructure:"apikey"`
-	Model       string `mapstructure:"model"`
-	ChatPrompt  string `mapstructure:"chat_prompt"`
-	Prompt      string `mapstructure:"prompt"`
-	ParsePrompt string `mapstructure:"parse_prompt"`
-	FilePrompt  string `mapstructure:"file_prompt"`
-	TestPrompt  string `mapstructure:"test_prompt"`
+	Provider    string              `mapstructure:"provider"` // dashscope/openai/local/fake
+	BaseURL     string              `mapstructure:"base_url"`
+	FakeScript  map[string][]string `mapstructure:"fake_script"` // fake模式下按 chat/parse/file 依次返回的内容
+	ApiKey      string              `mapstructure:"apikey"`
+	Model       string              `mapstructure:"model"`
+	ChatPrompt  string              `mapstructure:"chat_prompt"`
+	Prompt      string              `mapstructure:"prompt"`
+	ParsePrompt string              `mapstructure:"parse_prompt"`
+	FilePrompt  string              `mapstructure:"file_prompt"`
+	TestPrompt  string              `mapstructure:"test_prompt"`
+
+	RepairPrompt    string `mapstructure:"repair_prompt"`     // 识别结果校验失败后重新识别的提示
+	ParseMaxRetries *int   `mapstructure:"parse_max_retries"` // 校验失败后重新识别的最大次数，0 表示不重试，不配置时使用默认值
+
+	ReviewThreshold *float64 `mapstructure:"review_threshold"` // 字段置信度低于该值时票据进入人工审核，0 表示不审核，不配置时使用默认值
+	HistoryMessages int      `mapstructure:"history_messages"` // 对话时携带的最近消息条数
+
+	Tools      bool   `mapstructure:"tools"`       // 对话时允许模型调用工具查询票据、开始填报
+	ToolModel  string `mapstructure:"tool_model"`  // 工具调用使用的模型，为空时使用 model
+	ToolPrompt string `mapstructure:"tool_prompt"` // 工具调用时附加的系统提示
+
+	FixtureMode string `mapstructure:"fixture_mode"` // 模型请求录制/回放：record/replay/auto，为空时不启用
+	FixtureDir  string `mapstructure:"fixture_dir"`  // 录制文件目录
 }
 
 func GetOpenaiConf() Openai {
@@ -0,0 +1,23 @@
+package config
+
+var slotFilling SlotFilling
+
+// SlotFilling 报销单字段的可选值，对话识别、校验报销信息和 chat_prompt 的 {{slot_options}} 都使用这里的配置
+type SlotFilling struct {
+	// KeywordReply 本轮输入提到报销信息字段（如“紧急”“预算”“付款”）时，按规则更新后直接回复确认表格，不再调用模型；
+	// 关闭后规则识别的结果仍会保存，回复交给模型
+	KeywordReply bool `mapstructure:"keyword_reply"`
+
+	Categories        []string `mapstructure:"categories"`          // 报销类型
+	DefaultCategory   string   `mapstructure:"default_category"`    // 首次对话时默认的报销类型
+	UrgentTypes       []string `mapstructure:"urgent_types"`        // 紧急程度
+	DefaultUrgentType string   `mapstructure:"default_urgent_type"` // 首次对话时默认的紧急程度
+	BusinessDepts     []string `mapstructure:"business_depts"`      // 业务发生部门
+	BudgetDepts       []string `mapstructure:"budget_depts"`        // 预算承担部门
+	PayCompanies      []string `mapstructure:"pay_companies"`       // 付款公司
+	ProjectTypes      []string `mapstructure:"project_types"`       // 费用归集项目
+}
+
+func GetSlotFilling() SlotFilling {
+	return slotFilling
+}
@@ -2,9 +2,11 @@ package util
 
 import (
 	"crypto/md5"
+	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
 	"io"
+	"mime/multipart"
 	"os"
 )
 
@@ -28,3 +30,38 @@ func CalculateFileMD5(filePath string) (string, error) {
 
 	return hex.EncodeToString(hash.Sum(nil)), nil
 }
+
+// FileDigest 文件的MD5和SHA-256摘要，均为小写十六进制
+type FileDigest struct {
+	MD5    string
+	SHA256 string
+}
+
+// SaveUploadedFileToTemp 把上传的文件保存为 dir 下的临时文件，写入磁盘的同时计算摘要，
+// 返回临时文件路径，并发上传同名文件时互不影响
+func SaveUploadedFileToTemp(fileHeader *multipart.FileHeader, dir string) (string, *FileDigest, error) {
+	src, err := fileHeader.Open()
+	if err != nil {
+		return "", nil, err
+	}
+	defer src.Close()
+
+	out, err := os.CreateTemp(dir, ".uploading-*")
+	if err != nil {
+		return "", nil, err
+	}
+	md5Hash, sha256Hash := md5.New(), sha256.New()
+	_, err = io.Copy(io.MultiWriter(out, md5Hash, sha256Hash), src)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(out.Name())
+		return "", nil, err
+	}
+
+	return out.Name(), &FileDigest{
+		MD5:    hex.EncodeToString(md5Hash.Sum(nil)),
+		SHA256: hex.EncodeToString(sha256Hash.Sum(nil)),
+	}, nil
+}
@@ -0,0 +1,150 @@
+package util
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// 单个流最多缓存的事件数，超出后丢弃最早的事件
+	sseBufferSize = 2000
+	// 流结束后保留多久，供断线的客户端补发
+	sseRetention = 10 * time.Minute
+)
+
+// SSEEventRecord 已发送的事件，ID 在流内单调递增
+type SSEEventRecord struct {
+	ID   uint64
+	Data []byte
+}
+
+// SSEStream 一个会话或任务的事件流，缓存已发送的事件以便按 Last-Event-ID 补发
+type SSEStream struct {
+	Key string
+
+	mu       sync.Mutex
+	nextID   uint64
+	events   []SSEEventRecord
+	changed  chan struct{}
+	closed   bool
+	closedAt time.Time
+}
+
+// SSEStreamWriter 带事件流的 ResponseWriter，WriteSSE 通过它为事件分配ID并缓存
+type SSEStreamWriter interface {
+	http.ResponseWriter
+	SSEStream() *SSEStream
+}
+
+var sseStreams sync.Map // key -> *SSEStream
+
+// OpenSSEStream 为 key 创建新的事件流，替换同一 key 上已有的流
+func OpenSSEStream(key string) *SSEStream {
+	cleanupSSEStreams()
+	stream := &SSEStream{Key: key, changed: make(chan struct{})}
+	if old, loaded := sseStreams.Swap(key, stream); loaded {
+		old.(*SSEStream).Close()
+	}
+	return stream
+}
+
+// GetSSEStream 获取 key 对应的事件流
+func GetSSEStream(key string) (*SSEStream, bool) {
+	stream, ok := sseStreams.Load(key)
+	if !ok {
+		return nil, false
+	}
+	return stream.(*SSEStream), true
+}
+
+func cleanupSSEStreams() {
+	cutoff := time.Now().Add(-sseRetention)
+	sseStreams.Range(func(key, value interface{}) bool {
+		stream := value.(*SSEStream)
+		stream.mu.Lock()
+		expired := stream.closed && stream.closedAt.Before(cutoff)
+		stream.mu.Unlock()
+		if expired {
+			sseStreams.CompareAndDelete(key, stream)
+		}
+		return true
+	})
+}
+
+// Append 缓存一条事件并返回分配的ID
+func (s *SSEStream) Append(data []byte) uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.nextID++
+	s.events = append(s.events, SSEEventRecord{ID: s.nextID, Data: data})
+	if len(s.events) > sseBufferSize {
+		s.events = s.events[len(s.events)-sseBufferSize:]
+	}
+	s.notify()
+	return s.nextID
+}
+
+// Close 标记流结束，等待中的补发连接随之结束
+func (s *SSEStream) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return
+	}
+	s.closed = true
+	s.closedAt = time.Now()
+	s.notify()
+}
+
+func (s *SSEStream) notify() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+// Since 返回ID大于 lastID 的事件、下一次变化的通知通道，以及流是否已结束
+func (s *SSEStream) Since(lastID uint64) ([]SSEEventRecord, <-chan struct{}, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	events := make([]SSEEventRecord, 0)
+	for _, event := range s.events {
+		if event.ID > lastID {
+			events = append(events, event)
+		}
+	}
+	return events, s.changed, s.closed
+}
+
+// Replay 向重连的客户端补发 lastID 之后的事件，并持续转发新事件直到流结束或客户端断开
+func (s *SSEStream) Replay(w http.ResponseWriter, lastID uint64, clientGone <-chan struct{}) {
+	for {
+		events, changed, closed := s.Since(lastID)
+		for _, event := range events {
+			writeSSEEvent(w, event.ID, event.Data)
+			lastID = event.ID
+		}
+		if closed {
+			return
+		}
+		select {
+		case <-changed:
+		case <-clientGone:
+			return
+		}
+	}
+}
+
+func writeSSEEvent(w http.ResponseWriter, id uint64, data []byte) {
+	if id > 0 {
+		_, _ = fmt.Fprintf(w, "id: %d\ndata: %s\n\n", id, data)
+	} else {
+		_, _ = fmt.Fprintf(w, "data: %s\n\n", data)
+	}
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
@@ -41,6 +41,20 @@ func WriteSSE(w http.ResponseWriter, eventType string, data interface{}) error {
 			"resultId": v.ResultID,
 			"list":     v.List,
 		}
+	case models.ParseErrorEvent:
+		event = map[string]interface{}{
+			"type":    eventType,
+			"message": v.Message,
+			"detail":  v.Detail,
+		}
+	case models.MissingSlotsEvent:
+		event = map[string]interface{}{
+			"type":     eventType,
+			"complete": v.Complete,
+			"updated":  v.Updated,
+			"missing":  v.Missing,
+			"invalid":  v.Invalid,
+		}
 	default:
 		// 回退：尝试将 data 转为 map 并加入 type（不推荐）
 		if m, ok := data.(map[string]interface{}); ok {
@@ -56,13 +70,18 @@ func WriteSSE(w http.ResponseWriter, eventType string, data interface{}) error {
 		return err
 	}
 
-	_, _ = fmt.Fprintf(w, "data: %s\n\n", bytes)
-	if f, ok := w.(http.Flusher); ok {
-		f.Flush()
-	}
+	writeSSEEvent(w, recordSSEEvent(w, bytes), bytes)
 	return nil
 }
 
+// recordSSEEvent 写入带事件流的连接时缓存事件并返回事件ID，否则返回0（不输出id字段）
+func recordSSEEvent(w http.ResponseWriter, data []byte) uint64 {
+	if sw, ok := w.(SSEStreamWriter); ok {
+		return sw.SSEStream().Append(data)
+	}
+	return 0
+}
+
 // ===== 以下快捷函数保持完全不变（调用方无感知）=====
 
 func WriteBalance(w http.ResponseWriter, balance int64) error {
@@ -91,9 +110,21 @@ func WriteSetReference(w http.ResponseWriter, resultID string, list []models.Ref
 	})
 }
 
+func WriteParseError(w http.ResponseWriter, message string, detail interface{}) error {
+	return WriteSSE(w, "parse-error", models.ParseErrorEvent{
+		Message: message,
+		Detail:  detail,
+	})
+}
+
+func WriteMissingSlots(w http.ResponseWriter, event models.MissingSlotsEvent) error {
+	return WriteSSE(w, "missing-slots", event)
+}
+
 func WriteDone(w http.ResponseWriter) {
-	_, _ = fmt.Fprintf(w, "data: [DONE]\n\n")
-	if f, ok := w.(http.Flusher); ok {
-		f.Flush()
+	done := []byte("[DONE]")
+	writeSSEEvent(w, recordSSEEvent(w, done), done)
+	if sw, ok := w.(SSEStreamWriter); ok {
+		sw.SSEStream().Close()
 	}
 }